@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How much sample history the monitor keeps, and the window used for
+// the statistics shown in the UI and attached to events
+const (
+	activityHistoryWindow = 15 * time.Minute
+	activityStatsWindow   = 5 * time.Minute
+)
+
+// IdleProvider reports how long the system has been without user input
+type IdleProvider interface {
+	IdleTime() (time.Duration, error)
+}
+
+// Clock provides the current time, so monitoring can run on simulated time
+type Clock interface {
+	Now() time.Time
+}
+
+// systemIdleProvider reads idle time from the operating system
+type systemIdleProvider struct{}
+
+func (systemIdleProvider) IdleTime() (time.Duration, error) {
+	return getSystemIdleTime()
+}
+
+// systemClock is the real wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ActivitySample is a single reading of the system idle time
+type ActivitySample struct {
+	Time   time.Time
+	Idle   time.Duration
+	Active bool  // Input happened within the last check interval
+	Err    error // Set when the OS could not be queried and Idle is estimated
+}
+
+// ActivityStats summarises recent samples
+type ActivityStats struct {
+	Window                 time.Duration // Period actually covered by samples
+	Samples                int
+	ActiveSecondsPerMinute float64
+	LongestIdleStreak      time.Duration
+}
+
+// ActivitySummary is the form of ActivityStats sent in event payloads
+type ActivitySummary struct {
+	WindowSecs             int     `json:"window_secs"`
+	ActiveSecondsPerMinute float64 `json:"active_secs_per_min"`
+	LongestIdleSecs        int     `json:"longest_idle_secs"`
+}
+
+// SystemActivityMonitor detects user activity at the OS level.
+// Each call to Sample queries the OS exactly once; Check and IdleTime
+// report on that sample, so the two can never disagree within a tick.
+// Recent samples are kept in a ring buffer for activity statistics.
+type SystemActivityMonitor struct {
+	config   *SharedConfig
+	provider IdleProvider
+	clock    Clock
+
+	mu           sync.Mutex
+	lastActivity time.Time
+	samples      []ActivitySample
+	next         int
+	count        int
+}
+
+// NewSystemActivityMonitor creates a monitor reading the operating system's idle time
+func NewSystemActivityMonitor(config *SharedConfig) *SystemActivityMonitor {
+	return NewSystemActivityMonitorWith(config, systemIdleProvider{}, systemClock{})
+}
+
+// NewSystemActivityMonitorWith creates a monitor using the given idle source and clock
+func NewSystemActivityMonitorWith(config *SharedConfig, provider IdleProvider, clock Clock) *SystemActivityMonitor {
+	return &SystemActivityMonitor{
+		config:       config,
+		provider:     provider,
+		clock:        clock,
+		lastActivity: clock.Now(),
+		samples:      make([]ActivitySample, activityBufferSize(config.Load().CheckInterval)),
+	}
+}
+
+// activityBufferSize returns how many samples cover the history window
+func activityBufferSize(interval time.Duration) int {
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+	size := int(activityHistoryWindow / interval)
+	if size < 60 {
+		size = 60
+	} else if size > 10000 {
+		size = 10000
+	}
+	return size
+}
+
+// Sample reads the system idle time once and records the result
+func (m *SystemActivityMonitor) Sample() ActivitySample {
+	idleTime, err := m.provider.IdleTime()
+	now := m.clock.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sample := ActivitySample{Time: now, Idle: idleTime, Err: err}
+	if err != nil {
+		// Fall back to our own tracking
+		sample.Idle = now.Sub(m.lastActivity)
+	} else if idleTime < m.config.Load().CheckInterval {
+		// Input happened since our last check
+		sample.Active = true
+		m.lastActivity = now
+	}
+
+	m.samples[m.next] = sample
+	m.next = (m.next + 1) % len(m.samples)
+	if m.count < len(m.samples) {
+		m.count++
+	}
+
+	return sample
+}
+
+// Check takes a sample and returns true if there has been activity since the last check
+func (m *SystemActivityMonitor) Check() bool {
+	sample := m.Sample()
+	if sample.Err != nil {
+		fmt.Printf("Error getting system idle time: %v\n", sample.Err)
+	}
+	return sample.Active
+}
+
+// Latest returns the most recent sample, taking one if none exists yet
+func (m *SystemActivityMonitor) Latest() ActivitySample {
+	m.mu.Lock()
+	if m.count == 0 {
+		m.mu.Unlock()
+		return m.Sample()
+	}
+	sample := m.samples[(m.next-1+len(m.samples))%len(m.samples)]
+	m.mu.Unlock()
+	return sample
+}
+
+// IdleTime returns how long it had been since the last activity at the latest sample
+func (m *SystemActivityMonitor) IdleTime() time.Duration {
+	return m.Latest().Idle
+}
+
+// UpdateLastActivity updates the last activity timestamp
+func (m *SystemActivityMonitor) UpdateLastActivity() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastActivity = m.clock.Now()
+}
+
+// Now returns the current time according to the monitor's clock
+func (m *SystemActivityMonitor) Now() time.Time {
+	return m.clock.Now()
+}
+
+// Samples returns the recorded samples within window, oldest first
+func (m *SystemActivityMonitor) Samples(window time.Duration) []ActivitySample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := m.clock.Now().Add(-window)
+	var samples []ActivitySample
+	for i := 0; i < m.count; i++ {
+		sample := m.samples[(m.next-m.count+i+len(m.samples))%len(m.samples)]
+		if sample.Time.After(cutoff) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// Stats computes activity statistics over the samples within window.
+// Each active sample counts as one check interval of activity.
+func (m *SystemActivityMonitor) Stats(window time.Duration) ActivityStats {
+	samples := m.Samples(window)
+	stats := ActivityStats{Samples: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	interval := m.config.Load().CheckInterval
+	start := samples[0].Time.Add(-interval)
+	stats.Window = samples[len(samples)-1].Time.Sub(start)
+
+	var active time.Duration
+	for _, sample := range samples {
+		if sample.Active {
+			active += interval
+		}
+
+		// Only count the part of an idle streak that falls inside the window
+		streak := sample.Idle
+		if inWindow := sample.Time.Sub(start); streak > inWindow {
+			streak = inWindow
+		}
+		if streak > stats.LongestIdleStreak {
+			stats.LongestIdleStreak = streak
+		}
+	}
+
+	if stats.Window > 0 {
+		stats.ActiveSecondsPerMinute = active.Seconds() / stats.Window.Minutes()
+	}
+	return stats
+}
+
+// Summary converts the statistics to their payload form
+func (s ActivityStats) Summary() *ActivitySummary {
+	if s.Samples == 0 {
+		return nil
+	}
+	return &ActivitySummary{
+		WindowSecs:             int(s.Window.Seconds()),
+		ActiveSecondsPerMinute: float64(int(s.ActiveSecondsPerMinute*10)) / 10,
+		LongestIdleSecs:        int(s.LongestIdleStreak.Seconds()),
+	}
+}
+
+// describeActivityStats formats the statistics for display in the UI
+func describeActivityStats(stats ActivityStats) string {
+	if stats.Samples == 0 {
+		return "Activity: no samples yet"
+	}
+	return fmt.Sprintf("Activity: %.0f s/min over %s, longest idle %s",
+		stats.ActiveSecondsPerMinute, formatDuration(stats.Window), formatDuration(stats.LongestIdleStreak))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var testDay = time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC)
+
+// at returns the given time of day on testDay
+func at(hour, minute int) time.Time {
+	return testDay.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+// newTestMonitor creates a monitor over a scripted timeline starting at start
+func newTestMonitor(start time.Time, interval time.Duration) (*SystemActivityMonitor, *fakeIdleProvider, *fakeClock) {
+	config := NewAppConfig()
+	config.CheckInterval = interval
+	clock := newFakeClock(start)
+	provider := newFakeIdleProvider(clock)
+	return NewSystemActivityMonitorWith(NewSharedConfig(config), provider, clock), provider, clock
+}
+
+// countingProvider counts how often the OS would be queried
+type countingProvider struct {
+	IdleProvider
+	calls int
+}
+
+func (p *countingProvider) IdleTime() (time.Duration, error) {
+	p.calls++
+	return p.IdleProvider.IdleTime()
+}
+
+func TestMonitorCheckDetectsActivity(t *testing.T) {
+	monitor, provider, clock := newTestMonitor(at(9, 0), 2*time.Second)
+	provider.Active(at(9, 0), at(9, 5))
+
+	clock.Advance(time.Minute)
+	if !monitor.Check() {
+		t.Fatal("Check() = false during activity, want true")
+	}
+	if !monitor.lastActivity.Equal(at(9, 1)) {
+		t.Errorf("lastActivity = %v, want %v", monitor.lastActivity, at(9, 1))
+	}
+
+	clock.Advance(10 * time.Minute)
+	if monitor.Check() {
+		t.Fatal("Check() = true after five idle minutes, want false")
+	}
+	if !monitor.lastActivity.Equal(at(9, 1)) {
+		t.Errorf("lastActivity moved to %v without activity", monitor.lastActivity)
+	}
+}
+
+func TestMonitorCheckUsesConfiguredInterval(t *testing.T) {
+	monitor, provider, clock := newTestMonitor(at(9, 0), 30*time.Second)
+	provider.Active(at(9, 0), at(9, 1))
+
+	// Ten seconds idle is activity within a 30 second check interval
+	clock.now = at(9, 1).Add(10 * time.Second)
+	if !monitor.Check() {
+		t.Error("Check() = false 10s after input with a 30s interval, want true")
+	}
+
+	clock.now = at(9, 1).Add(40 * time.Second)
+	if monitor.Check() {
+		t.Error("Check() = true 40s after input with a 30s interval, want false")
+	}
+}
+
+func TestMonitorCheckFailsClosed(t *testing.T) {
+	monitor, provider, clock := newTestMonitor(at(9, 0), 2*time.Second)
+	provider.
+		Active(at(9, 0), at(10, 0)).
+		Failing(at(9, 30), at(9, 40))
+
+	clock.Advance(35 * time.Minute)
+	if monitor.Check() {
+		t.Fatal("Check() = true while the provider fails, want false")
+	}
+}
+
+func TestMonitorIdleTime(t *testing.T) {
+	monitor, provider, clock := newTestMonitor(at(9, 0), 2*time.Second)
+	provider.Active(at(9, 0), at(9, 10))
+
+	tests := []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		{at(9, 5), 0},
+		{at(9, 10), 0},
+		{at(9, 25), 15 * time.Minute},
+		{at(11, 10), 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		clock.now = tt.now
+		monitor.Sample()
+		if got := monitor.IdleTime(); got != tt.want {
+			t.Errorf("IdleTime() at %s = %v, want %v", tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestMonitorIdleTimeFallsBackToLastActivity(t *testing.T) {
+	monitor, provider, clock := newTestMonitor(at(9, 0), 2*time.Second)
+	provider.
+		Active(at(9, 0), at(12, 0)).
+		Failing(at(10, 0), at(11, 0))
+
+	clock.now = at(9, 50)
+	monitor.Check()
+
+	clock.now = at(10, 30)
+	sample := monitor.Sample()
+	if sample.Err == nil {
+		t.Fatal("Sample() has no error while the provider fails")
+	}
+	if got, want := monitor.IdleTime(), 40*time.Minute; got != want {
+		t.Errorf("IdleTime() with failing provider = %v, want %v since last activity", got, want)
+	}
+}
+
+func TestMonitorQueriesOncePerSample(t *testing.T) {
+	config := NewAppConfig()
+	clock := newFakeClock(at(9, 0))
+	provider := &countingProvider{IdleProvider: newFakeIdleProvider(clock).Active(at(9, 0), at(10, 0))}
+	monitor := NewSystemActivityMonitorWith(NewSharedConfig(config), provider, clock)
+
+	clock.Advance(time.Minute)
+	sample := monitor.Sample()
+	monitor.IdleTime()
+	monitor.Latest()
+
+	if provider.calls != 1 {
+		t.Errorf("provider queried %d times for one sample, want 1", provider.calls)
+	}
+	if !sample.Active || monitor.IdleTime() != sample.Idle {
+		t.Errorf("IdleTime() = %v disagrees with sample %+v", monitor.IdleTime(), sample)
+	}
+}
+
+func TestMonitorStats(t *testing.T) {
+	monitor, provider, clock := newTestMonitor(at(9, 0), 2*time.Second)
+	// Active for the first half of each minute, idle for the second half
+	for minute := 0; minute < 5; minute++ {
+		start := at(9, minute)
+		provider.Active(start, start.Add(30*time.Second))
+	}
+
+	for clock.Now().Before(at(9, 5)) {
+		clock.Advance(2 * time.Second)
+		monitor.Sample()
+	}
+
+	stats := monitor.Stats(5 * time.Minute)
+	if stats.Samples != 150 {
+		t.Errorf("Samples = %d, want 150", stats.Samples)
+	}
+	// The sample taken as input stops still counts as active
+	if stats.ActiveSecondsPerMinute < 30 || stats.ActiveSecondsPerMinute > 32 {
+		t.Errorf("ActiveSecondsPerMinute = %.1f, want about 30", stats.ActiveSecondsPerMinute)
+	}
+	if got, want := stats.LongestIdleStreak, 30*time.Second; got != want {
+		t.Errorf("LongestIdleStreak = %v, want %v", got, want)
+	}
+}
+
+func TestMonitorRingBufferKeepsRecentSamples(t *testing.T) {
+	monitor, _, clock := newTestMonitor(at(9, 0), 2*time.Second)
+	size := len(monitor.samples)
+
+	for i := 0; i < size+10; i++ {
+		clock.Advance(2 * time.Second)
+		monitor.Sample()
+	}
+
+	samples := monitor.Samples(24 * time.Hour)
+	if len(samples) != size {
+		t.Fatalf("kept %d samples, want buffer size %d", len(samples), size)
+	}
+	if !samples[len(samples)-1].Time.Equal(clock.Now()) {
+		t.Errorf("newest sample at %v, want %v", samples[len(samples)-1].Time, clock.Now())
+	}
+	for i := 1; i < len(samples); i++ {
+		if !samples[i].Time.After(samples[i-1].Time) {
+			t.Fatalf("samples out of order at %d", i)
+		}
+	}
+}
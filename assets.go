@@ -0,0 +1,349 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Package types a release asset can have
+const (
+	PackageBinary   = "binary" // The executable itself, with .exe on Windows
+	PackageTarGz    = "tar.gz"
+	PackageZip      = "zip"
+	PackageDeb      = "deb"
+	PackageRPM      = "rpm"
+	PackageAppImage = "AppImage"
+	PackageDMG      = "dmg"
+)
+
+// ReleaseAsset is one downloadable file of a release
+type ReleaseAsset struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Size    int64  `json:"size,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	OS      string `json:"os,omitempty"`      // GOOS; read from the name if empty
+	Arch    string `json:"arch,omitempty"`    // GOARCH; read from the name if empty
+	Package string `json:"package,omitempty"` // One of the Package constants; read from the name if empty
+
+	Patches []UpdatePatch `json:"patches,omitempty"` // Patches from earlier versions of this asset
+}
+
+// Architecture names used in asset names, by GOARCH
+var assetArchNames = map[string][]string{
+	"amd64": {"amd64", "x86_64", "x64"},
+	"386":   {"386", "i386", "i686", "x86"},
+	"arm64": {"arm64", "aarch64"},
+	"arm":   {"arm", "armv7", "armhf", "armv7l"},
+}
+
+// Operating system names used in asset names, by GOOS
+var assetOSNames = map[string][]string{
+	"windows": {"windows", "win", "win32", "win64"},
+	"darwin":  {"darwin", "macos", "mac", "osx"},
+	"linux":   {"linux"},
+}
+
+// Suffixes of package types, checked in order
+var assetPackageSuffixes = []struct{ suffix, pkg string }{
+	{".tar.gz", PackageTarGz},
+	{".tgz", PackageTarGz},
+	{".zip", PackageZip},
+	{".deb", PackageDeb},
+	{".rpm", PackageRPM},
+	{".appimage", PackageAppImage},
+	{".dmg", PackageDMG},
+	{".exe", PackageBinary},
+}
+
+// Extensions of release files that are not the app
+var nonAssetExtensions = map[string]bool{
+	".sha256": true, ".sig": true, ".asc": true, ".json": true, ".txt": true, ".md": true,
+	".ps1": true, ".bat": true, ".sh": true, ".nsi": true, ".msi": true, ".pem": true,
+	patchAssetSuffix: true,
+}
+
+// classifyAsset fills in the asset's OS, architecture and package type from
+// its name where they are not given. It returns false for files that are
+// not installable, such as checksums, signatures and setup programs.
+func classifyAsset(asset *ReleaseAsset) bool {
+	lower := strings.ToLower(asset.Name)
+	if nonAssetExtensions[filepath.Ext(lower)] {
+		return false
+	}
+	base := lower
+	for _, known := range assetPackageSuffixes {
+		if strings.HasSuffix(lower, known.suffix) {
+			base = strings.TrimSuffix(lower, known.suffix)
+			if asset.Package == "" {
+				asset.Package = known.pkg
+			}
+			break
+		}
+	}
+	if asset.Package == "" {
+		// Bare executables carry no extension, or only a version like "_1.2.0"
+		asset.Package = PackageBinary
+	}
+	// Setup programs install rather than replace the app
+	if strings.Contains(base, "setup") || strings.Contains(base, "installer") {
+		return false
+	}
+
+	// Some package types imply the OS
+	if asset.OS == "" {
+		switch {
+		case strings.HasSuffix(lower, ".exe"):
+			asset.OS = "windows"
+		case asset.Package == PackageDeb || asset.Package == PackageRPM || asset.Package == PackageAppImage:
+			asset.OS = "linux"
+		case asset.Package == PackageDMG:
+			asset.OS = "darwin"
+		}
+	}
+
+	// x86_64 would otherwise split into "x86" and "64"
+	base = strings.ReplaceAll(base, "x86_64", "amd64")
+	words := strings.FieldsFunc(base, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	for _, word := range words {
+		if asset.OS == "" {
+			asset.OS = lookupAssetName(assetOSNames, word)
+		}
+		if asset.Arch == "" {
+			asset.Arch = lookupAssetName(assetArchNames, word)
+		}
+	}
+	return true
+}
+
+// lookupAssetName returns the key whose names include word, or ""
+func lookupAssetName(names map[string][]string, word string) string {
+	for key, aliases := range names {
+		for _, alias := range aliases {
+			if word == alias {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// preferredPackages returns the package types this installation can use,
+// best first. Installations from a .deb or .rpm should be updated by the
+// same package manager, and an AppImage by a new AppImage.
+func preferredPackages(goos, kind string) []string {
+	switch goos {
+	case "windows":
+		return []string{PackageBinary, PackageZip}
+	case "darwin":
+		return []string{PackageBinary, PackageTarGz, PackageZip, PackageDMG}
+	}
+	switch kind {
+	case PackageAppImage:
+		return []string{PackageAppImage}
+	case PackageDeb:
+		return []string{PackageDeb}
+	case PackageRPM:
+		return []string{PackageRPM}
+	}
+	return []string{PackageBinary, PackageTarGz, PackageAppImage}
+}
+
+// selectReleaseAsset picks the asset for goos and goarch in the most
+// preferred package type. Assets without an architecture in their name are
+// taken only when no asset names goarch, and assets without an OS, such as
+// a bare "attendance-tracker", only when no asset names goos.
+func selectReleaseAsset(assets []ReleaseAsset, goos, goarch string, packages []string) (*ReleaseAsset, bool) {
+	osNamed := false
+	for i := range assets {
+		asset := assets[i]
+		if classifyAsset(&asset) && asset.OS == goos {
+			osNamed = true
+			break
+		}
+	}
+
+	var best *ReleaseAsset
+	bestRank := 0
+	for i := range assets {
+		asset := assets[i]
+		if !classifyAsset(&asset) {
+			continue
+		}
+		if asset.OS != goos && (asset.OS != "" || osNamed) {
+			continue
+		}
+		if asset.Arch != "" && asset.Arch != goarch {
+			continue
+		}
+
+		rank := -1
+		for j, pkg := range packages {
+			if asset.Package == pkg {
+				rank = j * 2
+				break
+			}
+		}
+		if rank < 0 {
+			continue
+		}
+		if asset.Arch == "" {
+			rank++ // Prefer an exact architecture match
+		}
+		if best == nil || rank < bestRank {
+			best, bestRank = &asset, rank
+		}
+	}
+	return best, best != nil
+}
+
+// selectUpdateAsset picks the asset for this platform and installation
+func selectUpdateAsset(assets []ReleaseAsset) (*ReleaseAsset, bool) {
+	return selectReleaseAsset(assets, runtime.GOOS, runtime.GOARCH, preferredPackages(runtime.GOOS, installationKind()))
+}
+
+// installationKind reports how this copy of the app was installed:
+// PackageAppImage when running from an AppImage, PackageDeb or PackageRPM
+// when the executable belongs to a system package, or PackageBinary
+func installationKind() string {
+	if runtime.GOOS != "linux" {
+		return PackageBinary
+	}
+	if os.Getenv("APPIMAGE") != "" {
+		return PackageAppImage
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return PackageBinary
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	if !strings.HasPrefix(exe, "/usr/") && !strings.HasPrefix(exe, "/opt/") {
+		return PackageBinary
+	}
+	if exec.Command("dpkg", "-S", exe).Run() == nil {
+		return PackageDeb
+	}
+	if exec.Command("rpm", "-qf", exe).Run() == nil {
+		return PackageRPM
+	}
+	return PackageBinary
+}
+
+// updateTarget returns the file an update replaces: the AppImage when
+// running from one, otherwise the executable
+func updateTarget() (string, error) {
+	if appImage := os.Getenv("APPIMAGE"); appImage != "" && runtime.GOOS == "linux" {
+		return appImage, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+// isSelfInstallable reports whether the app can install a package itself,
+// rather than handing it to the system's installer
+func isSelfInstallable(pkg string) bool {
+	switch pkg {
+	case PackageBinary, PackageTarGz, PackageZip, PackageAppImage:
+		return true
+	}
+	return false
+}
+
+// extractUpdateBinary returns the executable to install from the verified
+// download at path, extracting it next to path from a .tar.gz or .zip
+func extractUpdateBinary(path, pkg string) (string, error) {
+	switch pkg {
+	case PackageTarGz:
+		return extractFromTarGz(path, path+".bin")
+	case PackageZip:
+		return extractFromZip(path, path+".bin")
+	}
+	return path, nil
+}
+
+// isArchivedExecutable reports whether an archive entry is the app's
+// executable
+func isArchivedExecutable(name string, mode os.FileMode) bool {
+	if strings.HasPrefix(filepath.Base(name), ".") {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.HasSuffix(strings.ToLower(name), ".exe")
+	}
+	return mode&0111 != 0
+}
+
+func extractFromTarGz(path, dest string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return "", errors.New("the archive has no executable")
+		}
+		if err != nil {
+			return "", err
+		}
+		if header.Typeflag == tar.TypeReg && isArchivedExecutable(header.Name, header.FileInfo().Mode()) {
+			return dest, writeExtractedBinary(archive, dest)
+		}
+	}
+}
+
+func extractFromZip(path, dest string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+	for _, entry := range archive.File {
+		if entry.Mode().IsRegular() && isArchivedExecutable(entry.Name, entry.Mode()) {
+			in, err := entry.Open()
+			if err != nil {
+				return "", err
+			}
+			defer in.Close()
+			return dest, writeExtractedBinary(in, dest)
+		}
+	}
+	return "", errors.New("the archive has no executable")
+}
+
+func writeExtractedBinary(in io.Reader, dest string) error {
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("could not extract the update: %v", err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Assets named the way the Makefile and packaging scripts name them
+var testReleaseAssets = []ReleaseAsset{
+	{Name: "Attendance Tracker.exe"},
+	{Name: "Attendance Tracker.exe.sha256"},
+	{Name: "Attendance Tracker Setup.exe"},
+	{Name: "attendance-tracker_1.2.0_windows_386.exe"},
+	{Name: "attendance-tracker_1.2.0_windows_amd64.exe"},
+	{Name: "attendance-tracker_1.2.0_linux_amd64"},
+	{Name: "attendance-tracker_1.2.0_linux_arm64.tar.gz"},
+	{Name: "attendance-tracker_1.2.0_darwin_amd64.tar.gz"},
+	{Name: "attendance-tracker_1.2.0_darwin_arm64"},
+	{Name: "attendance-tracker_1.2.0_amd64.deb"},
+	{Name: "attendance-tracker-1.2.0-1.fc39.x86_64.rpm"},
+	{Name: "AttendanceTracker-1.2.0-x86_64.AppImage"},
+	{Name: "AttendanceTracker-1.2.0.dmg"},
+	{Name: "manifest.json"},
+	{Name: "manifest.json.sig"},
+}
+
+func TestSelectReleaseAsset(t *testing.T) {
+	cases := []struct {
+		goos, goarch, kind string
+		want               string
+	}{
+		{"windows", "amd64", PackageBinary, "attendance-tracker_1.2.0_windows_amd64.exe"},
+		{"windows", "386", PackageBinary, "attendance-tracker_1.2.0_windows_386.exe"},
+		{"windows", "arm64", PackageBinary, "Attendance Tracker.exe"}, // No arm64 build, take the generic one
+		{"linux", "amd64", PackageBinary, "attendance-tracker_1.2.0_linux_amd64"},
+		{"linux", "arm64", PackageBinary, "attendance-tracker_1.2.0_linux_arm64.tar.gz"},
+		{"linux", "amd64", PackageDeb, "attendance-tracker_1.2.0_amd64.deb"},
+		{"linux", "amd64", PackageRPM, "attendance-tracker-1.2.0-1.fc39.x86_64.rpm"},
+		{"linux", "amd64", PackageAppImage, "AttendanceTracker-1.2.0-x86_64.AppImage"},
+		{"darwin", "arm64", PackageBinary, "attendance-tracker_1.2.0_darwin_arm64"},
+		{"darwin", "amd64", PackageBinary, "attendance-tracker_1.2.0_darwin_amd64.tar.gz"},
+		{"linux", "386", PackageBinary, ""},
+		{"linux", "arm64", PackageRPM, ""},
+	}
+	for _, c := range cases {
+		asset, found := selectReleaseAsset(testReleaseAssets, c.goos, c.goarch, preferredPackages(c.goos, c.kind))
+		got := ""
+		if found {
+			got = asset.Name
+		}
+		if got != c.want {
+			t.Errorf("%s/%s (%s): selected %q, want %q", c.goos, c.goarch, c.kind, got, c.want)
+		}
+	}
+}
+
+func TestSelectReleaseAssetWithoutOS(t *testing.T) {
+	// Older releases named only the Windows and macOS builds
+	assets := []ReleaseAsset{
+		{Name: "Attendance Tracker.exe"},
+		{Name: "attendance-tracker_darwin_arm64"},
+		{Name: "attendance-tracker_amd64.tar.gz"},
+		{Name: "attendance-tracker"},
+		{Name: "attendance-tracker.sha256"},
+	}
+	cases := []struct {
+		goos, goarch string
+		packages     []string
+		want         string
+	}{
+		{"linux", "amd64", preferredPackages("linux", PackageBinary), "attendance-tracker"},
+		{"linux", "amd64", []string{PackageTarGz}, "attendance-tracker_amd64.tar.gz"},
+		{"linux", "arm64", []string{PackageTarGz}, ""},
+		{"darwin", "arm64", preferredPackages("darwin", PackageBinary), "attendance-tracker_darwin_arm64"},
+		{"windows", "amd64", preferredPackages("windows", PackageBinary), "Attendance Tracker.exe"},
+	}
+	for _, c := range cases {
+		asset, found := selectReleaseAsset(assets, c.goos, c.goarch, c.packages)
+		got := ""
+		if found {
+			got = asset.Name
+		}
+		if got != c.want {
+			t.Errorf("%s/%s %v: selected %q, want %q", c.goos, c.goarch, c.packages, got, c.want)
+		}
+	}
+}
+
+func TestClassifyAssetKeepsGivenFields(t *testing.T) {
+	// Custom servers may name assets freely and say what they are
+	asset := ReleaseAsset{Name: "tracker-latest", OS: "darwin", Arch: "arm64", Package: PackageZip}
+	if !classifyAsset(&asset) || asset.OS != "darwin" || asset.Arch != "arm64" || asset.Package != PackageZip {
+		t.Errorf("classified as %+v", asset)
+	}
+}
+
+func TestExtractUpdateBinaryFromTarGz(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("looks for an .exe on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "attendance-tracker_1.2.0_linux_amd64.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+	entries := []struct {
+		name string
+		mode int64
+		body string
+	}{
+		{"README.md", 0644, "read me"},
+		{"attendance-tracker", 0755, "new version"},
+	}
+	for _, entry := range entries {
+		archive.WriteHeader(&tar.Header{Name: entry.name, Mode: entry.mode, Size: int64(len(entry.body)), Typeflag: tar.TypeReg})
+		archive.Write([]byte(entry.body))
+	}
+	archive.Close()
+	gz.Close()
+	file.Close()
+
+	binary, err := extractUpdateBinary(path, PackageTarGz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(binary)
+	if err != nil || string(data) != "new version" {
+		t.Errorf("extracted %q, %v, want the executable", data, err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ways of authenticating requests to the server
+const (
+	AuthBearer = "bearer" // Authorization: Bearer <token>
+	AuthHMAC   = "hmac"   // Each request signed with a shared secret
+)
+
+// Credentials authenticate this device to one attendance server. They are
+// issued by the server when the device signs in and kept in the OS keyring.
+type Credentials struct {
+	Server     string    `json:"server"`     // Origin the credentials belong to, e.g. https://attendance.example.com
+	UserID     string    `json:"user_id"`    // User that signed in
+	Type       string    `json:"token_type"` // AuthBearer or AuthHMAC
+	Token      string    `json:"token,omitempty"`
+	KeyID      string    `json:"key_id,omitempty"`
+	Secret     string    `json:"secret,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// How long enrollment waits for the server
+const enrollTimeout = 15 * time.Second
+
+// serverOrigin returns the scheme and host of endpoint, which identify the
+// server that credentials belong to
+func serverOrigin(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// getEnrollEndpoint returns the sign-in URL next to the events endpoint,
+// so https://example.com/api/v1/events signs in at https://example.com/api/v1/enroll
+func getEnrollEndpoint(eventsEndpoint string) (string, error) {
+	u, err := url.Parse(eventsEndpoint)
+	if err != nil {
+		return "", err
+	}
+	return u.ResolveReference(&url.URL{Path: "enroll"}).String(), nil
+}
+
+// check reports whether the credentials are complete
+func (c *Credentials) check() error {
+	switch c.Type {
+	case AuthBearer:
+		if c.Token == "" {
+			return errors.New("bearer credentials have no token")
+		}
+	case AuthHMAC:
+		if c.KeyID == "" || c.Secret == "" {
+			return errors.New("hmac credentials need a key_id and secret")
+		}
+	default:
+		return fmt.Errorf("unsupported token type %q", c.Type)
+	}
+	return nil
+}
+
+// Expired reports whether the server's expiry time has passed
+func (c *Credentials) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt)
+}
+
+// authorize adds the authentication header for body to req.
+//
+// HMAC requests carry
+//
+//	Authorization: AttendanceHMAC key_id="<id>", timestamp="<unix seconds>", signature="<base64>"
+//
+// where the signature is HMAC-SHA256 with the shared secret over the method,
+// request URI, timestamp and hex SHA-256 of the body, joined by newlines.
+func (c *Credentials) authorize(req *http.Request, body []byte, now time.Time) {
+	switch c.Type {
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case AuthHMAC:
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		signature := signRequest(c.Secret, req.Method, req.URL.RequestURI(), timestamp, body)
+		req.Header.Set("Authorization", fmt.Sprintf(`AttendanceHMAC key_id="%s", timestamp="%s", signature="%s"`,
+			c.KeyID, timestamp, signature))
+	}
+}
+
+// signRequest computes the HMAC signature of a request
+func signRequest(secret, method, requestURI, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// enrollDevice signs in to the server behind endpoint with the user's
+// password or a one-time enrollment code and returns the issued credentials.
+//
+// The request is POST {"user_id", "device_id", "password"} and the response
+// {"token_type": "bearer", "token"} or {"token_type": "hmac", "key_id", "secret"},
+// optionally with an RFC 3339 "expires_at".
+func enrollDevice(endpoint, userID, deviceID, password string) (*Credentials, error) {
+	enrollURL, err := getEnrollEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"user_id":   userID,
+		"device_id": deviceID,
+		"password":  password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", enrollURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AttendanceTracker/"+Version)
+
+	client := &http.Client{Timeout: enrollTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxServerResponseSize))
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, errors.New("the server did not accept the password or enrollment code")
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("the server does not support signing in at %s", enrollURL)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		if len(respBody) > 1024 {
+			respBody = respBody[:1024]
+		}
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+
+	var credentials Credentials
+	if err := json.Unmarshal(respBody, &credentials); err != nil {
+		return nil, fmt.Errorf("could not read the server's response: %v", err)
+	}
+	credentials.Type = strings.ToLower(credentials.Type)
+	if err := credentials.check(); err != nil {
+		return nil, fmt.Errorf("the server returned unusable credentials: %v", err)
+	}
+	credentials.Server = serverOrigin(endpoint)
+	credentials.UserID = userID
+	credentials.EnrolledAt = time.Now()
+	return &credentials, nil
+}
+
+// loadCredentials reads the credentials for server from store, returning
+// nil if the device has not signed in to it
+func loadCredentials(store CredentialStore, server string) (*Credentials, error) {
+	data, err := store.Get(server)
+	if errors.Is(err, errCredentialNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials Credentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("stored credentials for %s are damaged: %v", server, err)
+	}
+	if err := credentials.check(); err != nil {
+		return nil, fmt.Errorf("stored credentials for %s are damaged: %v", server, err)
+	}
+	return &credentials, nil
+}
+
+// saveCredentials stores credentials under their server
+func saveCredentials(store CredentialStore, credentials *Credentials) error {
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	return store.Set(credentials.Server, data)
+}
+
+// describeCredentials formats the sign-in state for display in Settings
+func describeCredentials(credentials *Credentials, endpoint string, store CredentialStore) string {
+	if credentials == nil {
+		return fmt.Sprintf("Not signed in to %s. Events are sent without authentication.", serverOrigin(endpoint))
+	}
+	description := fmt.Sprintf("Signed in to %s as %s (%s, stored in %s)",
+		credentials.Server, credentials.UserID, credentials.Type, store.Name())
+	if credentials.Expired(time.Now()) {
+		description += ". The sign-in has expired; sign in again."
+	}
+	return description
+}
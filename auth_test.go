@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sendWithCredentials sends one event to a test server and returns the
+// request it received
+func sendWithCredentials(t *testing.T, credentials func(server string) *Credentials) (*http.Request, []byte) {
+	t.Helper()
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	config := NewAppConfig()
+	config.ServerEndpoint = server.URL + "/api/v1/events"
+	sender := NewEventSender(NewSharedConfig(config))
+	sender.SetCredentials(credentials(serverOrigin(server.URL)))
+
+	if err := sender.Send(NewStatusPayload(config, EventCheckIn, SourceManual, time.Now())); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	return received, body
+}
+
+func TestEventSenderBearerToken(t *testing.T) {
+	req, _ := sendWithCredentials(t, func(server string) *Credentials {
+		return &Credentials{Server: server, Type: AuthBearer, Token: "token-123"}
+	})
+	if got := req.Header.Get("Authorization"); got != "Bearer token-123" {
+		t.Errorf("Authorization = %q, want the bearer token", got)
+	}
+}
+
+func TestEventSenderHMACSignature(t *testing.T) {
+	req, body := sendWithCredentials(t, func(server string) *Credentials {
+		return &Credentials{Server: server, Type: AuthHMAC, KeyID: "key-1", Secret: "shared-secret"}
+	})
+
+	header := req.Header.Get("Authorization")
+	match := regexp.MustCompile(`^AttendanceHMAC key_id="key-1", timestamp="(\d+)", signature="([^"]+)"$`).FindStringSubmatch(header)
+	if match == nil {
+		t.Fatalf("Authorization = %q, want an AttendanceHMAC header", header)
+	}
+	if want := signRequest("shared-secret", "POST", "/api/v1/events", match[1], body); match[2] != want {
+		t.Errorf("signature = %s, want %s", match[2], want)
+	}
+	if match[2] == signRequest("shared-secret", "POST", "/api/v1/events", match[1], append(body, ' ')) {
+		t.Error("signature does not cover the body")
+	}
+}
+
+func TestEventSenderKeepsCredentialsToTheirServer(t *testing.T) {
+	req, _ := sendWithCredentials(t, func(string) *Credentials {
+		return &Credentials{Server: "https://other.example.com", Type: AuthBearer, Token: "token-123"}
+	})
+	if got := req.Header.Get("Authorization"); got != "" {
+		t.Errorf("credentials for another server sent: %q", got)
+	}
+}
+
+func TestUnauthorizedEventsStayQueued(t *testing.T) {
+	if !isRetryableStatus(http.StatusUnauthorized) {
+		t.Error("401 responses would set events aside instead of keeping them until sign-in")
+	}
+}
+
+func TestEnrollDevice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/enroll" {
+			http.NotFound(w, r)
+			return
+		}
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		if request["password"] != "correct" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if request["user_id"] != "user-test" || request["device_id"] != "device-test" {
+			t.Errorf("enrollment request %v", request)
+		}
+		w.Write([]byte(`{"token_type": "HMAC", "key_id": "key-1", "secret": "shared-secret"}`))
+	}))
+	defer server.Close()
+
+	endpoint := server.URL + "/api/v1/events"
+	credentials, err := enrollDevice(endpoint, "user-test", "device-test", "correct")
+	if err != nil {
+		t.Fatalf("enrollDevice: %v", err)
+	}
+	if credentials.Type != AuthHMAC || credentials.KeyID != "key-1" || credentials.Server != serverOrigin(server.URL) || credentials.UserID != "user-test" {
+		t.Errorf("credentials = %+v", credentials)
+	}
+
+	if _, err := enrollDevice(endpoint, "user-test", "device-test", "wrong"); err == nil || !strings.Contains(err.Error(), "did not accept") {
+		t.Errorf("wrong password: err = %v", err)
+	}
+}
+
+func TestEnrollDeviceRejectsIncompleteCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token_type": "bearer"}`))
+	}))
+	defer server.Close()
+
+	if _, err := enrollDevice(server.URL+"/events", "user-test", "device-test", "pw"); err == nil {
+		t.Error("bearer credentials without a token accepted")
+	}
+}
+
+func TestFileCredentialStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	store := &fileCredentialStore{path: path, key: []byte("test key")}
+
+	if _, err := store.Get("https://a.example.com"); !errors.Is(err, errCredentialNotFound) {
+		t.Fatalf("Get on an empty store: err = %v", err)
+	}
+
+	credentials := &Credentials{Server: "https://a.example.com", UserID: "user-test", Type: AuthBearer, Token: "token-123"}
+	if err := saveCredentials(store, credentials); err != nil {
+		t.Fatalf("saveCredentials: %v", err)
+	}
+	loaded, err := loadCredentials(store, "https://a.example.com")
+	if err != nil || loaded == nil || loaded.Token != "token-123" {
+		t.Fatalf("loadCredentials = %+v, %v", loaded, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "token-123") {
+		t.Error("token stored in plain text")
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		t.Errorf("credentials file mode %v, want readable by the owner only", info.Mode().Perm())
+	}
+
+	// Another key, such as on another machine, cannot read the file
+	other := &fileCredentialStore{path: path, key: []byte("other key")}
+	if _, err := other.Get("https://a.example.com"); err == nil || errors.Is(err, errCredentialNotFound) {
+		t.Errorf("Get with the wrong key: err = %v", err)
+	}
+
+	if err := store.Delete("https://a.example.com"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if loaded, err := loadCredentials(store, "https://a.example.com"); loaded != nil || err != nil {
+		t.Errorf("after Delete: %+v, %v", loaded, err)
+	}
+}
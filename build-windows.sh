@@ -66,7 +66,8 @@ if ! command -v fyne &> /dev/null; then
 fi
 
 # Create versions
-VERSION_LDFLAGS="-X main.Version=${VERSION} -X main.BuildDate=${BUILD_DATE} -X main.CommitSHA=${COMMIT_SHA}"
+# UPDATE_KEY is the base64 ed25519 public key update manifests are verified with
+VERSION_LDFLAGS="-X main.Version=${VERSION} -X main.BuildDate=${BUILD_DATE} -X main.CommitSHA=${COMMIT_SHA} -X main.UpdateSigningKey=${UPDATE_KEY}"
 
 # Create output directory
 mkdir -p ./releases/windows
@@ -110,6 +111,27 @@ fi
 echo "Generating checksums..."
 cd ./releases/windows
 sha256sum "$APP_NAME.exe" > "$APP_NAME.exe.sha256"
+
+# Write a patch from the previous release for delta updates if it is given
+# (PREVIOUS_VERSION and the absolute path of its executable in PREVIOUS_EXE;
+# requires bsdiff)
+if [ -n "$PREVIOUS_VERSION" ] && [ -n "$PREVIOUS_EXE" ]; then
+    if command -v bsdiff >/dev/null 2>&1; then
+        bsdiff "$PREVIOUS_EXE" "$APP_NAME.exe" "$APP_NAME.exe.from-$PREVIOUS_VERSION.bsdiff"
+    else
+        echo "Warning: bsdiff not found, no patch from $PREVIOUS_VERSION written"
+    fi
+fi
+
+# Write the release manifest, and sign it if the private key is available
+# (UPDATE_SIGNING_KEY is the path of an ed25519 PEM key; requires OpenSSL 3)
+printf '{"version": "%s", "files": {"%s.exe": "%s"}}\n' \
+    "$VERSION" "$APP_NAME" "$(cut -d' ' -f1 "$APP_NAME.exe.sha256")" > manifest.json
+if [ -n "$UPDATE_SIGNING_KEY" ]; then
+    openssl pkeyutl -sign -inkey "$UPDATE_SIGNING_KEY" -rawin -in manifest.json | base64 | tr -d '\n' > manifest.json.sig
+else
+    echo "Warning: UPDATE_SIGNING_KEY not set, manifest.json is unsigned and the app will not install this release"
+fi
 cd ../..
 
 # Copy verification tools
@@ -240,6 +262,10 @@ echo "-------------------------------------------"
 echo "Files available in ./releases/windows:"
 echo "- $APP_NAME.exe"
 echo "- $APP_NAME.exe.sha256 (Checksum)"
+echo "- manifest.json and manifest.json.sig (Signed update manifest)"
+if [ -n "$PREVIOUS_VERSION" ]; then
+    echo "- $APP_NAME.exe.from-$PREVIOUS_VERSION.bsdiff (Patch from $PREVIOUS_VERSION, if bsdiff was found)"
+fi
 echo "-------------------------------------------"
 echo "To build the installer, run makensis on the install.nsi file:"
 echo "makensis ./releases/windows/install.nsi"
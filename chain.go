@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ChainHead identifies the latest record of the history chain. It is sent
+// with every event, so the server can tell when the history it has seen
+// was later rewritten or cut short.
+type ChainHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"` // Hex SHA-256 of the record's line
+}
+
+// Keyring account holding the key that signs the history
+const historyKeyAccount = "history-signing-key"
+
+// loadHistoryKey reads the device's history signing key from store,
+// generating and storing one on first use if create is set
+func loadHistoryKey(store CredentialStore, create bool) ([]byte, error) {
+	key, err := store.Get(historyKeyAccount)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, errCredentialNotFound) || !create {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := store.Set(historyKeyAccount, key); err != nil {
+		return nil, err
+	}
+	logActivity(fmt.Sprintf("Created history signing key in %s", store.Name()))
+	return key, nil
+}
+
+// openHistoryKey returns the history signing key from the keyring, or from
+// the encrypted file if the keyring cannot be used. Without either, records
+// are written without a MAC, and verification reports them as unsigned.
+func openHistoryKey(store CredentialStore) []byte {
+	key, err := loadHistoryKey(store, true)
+	if err == nil {
+		return key
+	}
+	logActivity(fmt.Sprintf("Error reading history signing key from %s: %v", store.Name(), err))
+
+	if _, isFile := store.(*fileCredentialStore); !isFile {
+		if key, err := loadHistoryKey(newFileCredentialStore(getCredentialsFilePath()), true); err == nil {
+			return key
+		}
+	}
+	logActivity("History records will not be signed")
+	return nil
+}
+
+// historyKeyID identifies a signing key without revealing it
+func historyKeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("history key id\n"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// signHistoryRecord fills in the record's key ID and MAC and returns its
+// line. Without a key both are left empty.
+func signHistoryRecord(record HistoryRecord, key []byte) ([]byte, error) {
+	record.KeyID = ""
+	record.MAC = ""
+	if len(key) == 0 {
+		return json.Marshal(record)
+	}
+	record.KeyID = historyKeyID(key)
+	unsigned, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	record.MAC = historyMAC(unsigned, key)
+	return json.Marshal(record)
+}
+
+// historyMAC computes the MAC of a record encoded without its mac field
+func historyMAC(unsigned []byte, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(unsigned)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashHistoryLine returns the hash the next record links to
+func hashHistoryLine(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// readChainHead finds the end of the chain in the history file. A last line
+// cut short by a crash is terminated, so the next record starts on a line
+// of its own.
+func readChainHead(path string) (ChainHead, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ChainHead{}, err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return ChainHead{}, err
+		}
+		_, err = file.Write([]byte{'\n'})
+		file.Close()
+		if err != nil {
+			return ChainHead{}, err
+		}
+	}
+
+	var head ChainHead
+	err = scanHistoryLines(bytes.NewReader(data), func(_ int, line []byte, record *HistoryRecord) {
+		if record == nil {
+			return
+		}
+		// Older unchained records are linked to as well, anchoring them
+		// to the first chained record
+		head.Hash = hashHistoryLine(line)
+		if record.Seq > 0 {
+			head.Seq = record.Seq
+		}
+	})
+	return head, err
+}
+
+// scanHistoryLines calls fn for every non-empty line of r with its 1-based
+// line number, passing a nil record for lines that cannot be parsed
+func scanHistoryLines(r io.Reader, fn func(lineNo int, line []byte, record *HistoryRecord)) error {
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record HistoryRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			fn(lineNo, line, nil)
+			continue
+		}
+		fn(lineNo, line, &record)
+	}
+	return scanner.Err()
+}
+
+// HistoryVerification is the outcome of checking the history chain
+type HistoryVerification struct {
+	Records  int // Chained records checked
+	Legacy   int // Records from before chaining, which cannot be checked
+	Cut      int // Records cut short by a crash, which the chain skips
+	Head     ChainHead
+	Problems []string // Empty if the history is intact
+}
+
+// verifyHistory checks every record of the history file at path against the
+// chain and key, reporting gaps, edits, insertions and unreadable lines
+func verifyHistory(path string, key []byte) (*HistoryVerification, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	v := &HistoryVerification{}
+	keyID := ""
+	if len(key) > 0 {
+		keyID = historyKeyID(key)
+	}
+	foreignKey, unsigned := 0, 0
+
+	// A record cut short by a crash is left in place, and the next record
+	// written links past it to the last complete one. An unreadable line is
+	// only a problem if the chain does not continue around it that way.
+	var unreadable []int
+	reportUnreadable := func() {
+		for _, lineNo := range unreadable {
+			v.Problems = append(v.Problems, fmt.Sprintf("line %d: unreadable record (edited)", lineNo))
+		}
+		unreadable = nil
+	}
+
+	err = scanHistoryLines(file, func(lineNo int, line []byte, record *HistoryRecord) {
+		if record == nil {
+			unreadable = append(unreadable, lineNo)
+			return
+		}
+		if record.Seq > 0 && record.Prev == v.Head.Hash {
+			v.Cut += len(unreadable)
+			unreadable = nil
+		} else {
+			reportUnreadable()
+		}
+
+		hash := hashHistoryLine(line)
+		if record.Seq == 0 {
+			if v.Head.Seq > 0 {
+				v.Problems = append(v.Problems, fmt.Sprintf("line %d: unsigned record inside the chain (inserted)", lineNo))
+			} else {
+				v.Legacy++
+			}
+			v.Head.Hash = hash
+			return
+		}
+
+		v.Records++
+		var reasons []string
+		switch {
+		case v.Head.Seq == 0 && record.Seq != 1:
+			reasons = append(reasons, fmt.Sprintf("chain starts at record %d (earlier records removed)", record.Seq))
+		case v.Head.Seq > 0 && record.Seq != v.Head.Seq+1:
+			reasons = append(reasons, fmt.Sprintf("record %d follows record %d (records removed or reordered)", record.Seq, v.Head.Seq))
+		}
+		if record.Prev != v.Head.Hash {
+			reasons = append(reasons, "does not link to the record before it")
+		}
+		switch {
+		case record.MAC == "":
+			unsigned++
+		case keyID == "" || record.KeyID != keyID:
+			foreignKey++
+		default:
+			signed := *record
+			signed.MAC = ""
+			body, _ := json.Marshal(signed)
+			if !hmac.Equal([]byte(record.MAC), []byte(historyMAC(body, key))) {
+				reasons = append(reasons, "signature does not match (edited)")
+			}
+		}
+		if len(reasons) > 0 {
+			v.Problems = append(v.Problems, fmt.Sprintf("line %d: %s", lineNo, strings.Join(reasons, "; ")))
+		}
+
+		v.Head = ChainHead{Seq: record.Seq, Hash: hash}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Nothing has been written after a record cut short at the end
+	v.Cut += len(unreadable)
+
+	if unsigned > 0 {
+		v.Problems = append(v.Problems, fmt.Sprintf("%d records are unsigned (no signing key was available when they were written), so edits to them cannot be detected", unsigned))
+	}
+	if foreignKey > 0 {
+		v.Problems = append(v.Problems, fmt.Sprintf("%d records are signed with a key this device does not have (key lost or file copied from another device)", foreignKey))
+	}
+	return v, nil
+}
+
+// describeHistoryVerification formats a verification result for the command line
+func describeHistoryVerification(path string, v *HistoryVerification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "History: %s\n", path)
+	fmt.Fprintf(&b, "Checked %d chained records", v.Records)
+	if v.Legacy > 0 {
+		fmt.Fprintf(&b, " (%d older unchained records cannot be verified)", v.Legacy)
+	}
+	if v.Cut > 0 {
+		fmt.Fprintf(&b, "\n%d records were cut short by a crash and skipped", v.Cut)
+	}
+	fmt.Fprintf(&b, "\nChain head: seq=%d hash=%s\n", v.Head.Seq, v.Head.Hash)
+	if len(v.Problems) == 0 {
+		b.WriteString("OK: no gaps or edits found\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "FAILED: %d problems found\n", len(v.Problems))
+	for _, problem := range v.Problems {
+		fmt.Fprintf(&b, "  - %s\n", problem)
+	}
+	return b.String()
+}
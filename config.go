@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SharedConfig holds the config in force for the components of a running
+// tracker. Applying settings stores a new AppConfig rather than changing
+// the current one, so a config returned by Load is a consistent snapshot
+// that must not be modified.
+type SharedConfig struct {
+	current atomic.Pointer[AppConfig]
+}
+
+// NewSharedConfig returns a SharedConfig holding config
+func NewSharedConfig(config *AppConfig) *SharedConfig {
+	s := &SharedConfig{}
+	s.Store(config)
+	return s
+}
+
+// Load returns the config in force
+func (s *SharedConfig) Load() *AppConfig {
+	return s.current.Load()
+}
+
+// Store puts a copy of config in force
+func (s *SharedConfig) Store(config *AppConfig) {
+	snapshot := *config
+	s.current.Store(&snapshot)
+}
+
+// configMigrations upgrade a raw config file one schema version at a time:
+// configMigrations[i] turns version i+1 into version i+2
+var configMigrations = []func(raw map[string]interface{}) error{
+	migrateConfigV1,
+	migrateConfigV2,
+	migrateConfigV3,
+}
+
+// currentConfigVersion is the schema version written by this build
+var currentConfigVersion = len(configMigrations) + 1
+
+// configFields lists the config file keys of every AppConfig field
+var configFields = []string{
+	"server_endpoint",
+	"device_id",
+	"user_id",
+	"idle_timeout",
+	"check_interval",
+	"developer_mode",
+	"show_activity_log",
+	"show_idle_time",
+	"auto_mode",
+	"run_at_startup",
+	"bind_device_to_machine",
+	"update_channel",
+	"pinned_version",
+	"skipped_version",
+	"update_mode",
+	"update_check_interval",
+}
+
+// Source name of values read from the config file
+const configFileSource = "config file"
+
+// Alternate config file chosen with --config; empty for the default location
+var configFilePath string
+
+// configFile is the on-disk form of AppConfig
+type configFile struct {
+	SchemaVersion   int            `json:"schema_version"`
+	ServerEndpoint  string         `json:"server_endpoint"`
+	DeviceID        string         `json:"device_id,omitempty"` // Kept in device.json from version 4
+	UserID          string         `json:"user_id"`
+	IdleTimeout     configDuration `json:"idle_timeout"`
+	CheckInterval   configDuration `json:"check_interval"`
+	DeveloperMode   bool           `json:"developer_mode"`
+	ShowActivityLog bool           `json:"show_activity_log"`
+	ShowIdleTime    bool           `json:"show_idle_time"`
+	AutoMode        bool           `json:"auto_mode"`
+	RunAtStartup    bool           `json:"run_at_startup"`
+	BindDevice      bool           `json:"bind_device_to_machine"`
+	UpdateChannel   string         `json:"update_channel"`
+	PinnedVersion   string         `json:"pinned_version"`
+	SkippedVersion  string         `json:"skipped_version"`
+	UpdateMode      string         `json:"update_mode"`
+	UpdateInterval  configDuration `json:"update_check_interval"`
+}
+
+// configDuration is a duration stored as a Go duration string such as "90s"
+type configDuration time.Duration
+
+func (d configDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(formatConfigDuration(time.Duration(d)))
+}
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("expected a duration such as \"90s\" or \"20m\", got %s", data)
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("expected a duration such as \"90s\" or \"20m\", got %q", text)
+	}
+	*d = configDuration(duration)
+	return nil
+}
+
+// formatConfigDuration formats d like time.Duration.String, without
+// trailing zero units ("20m" rather than "20m0s")
+func formatConfigDuration(d time.Duration) string {
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// ConfigProblem describes one invalid config field
+type ConfigProblem struct {
+	Field   string // Key in the config file
+	Message string
+}
+
+// ConfigError lists every problem found in a config file
+type ConfigError struct {
+	Path     string
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	lines := []string{fmt.Sprintf("invalid config file %s:", e.Path)}
+	for _, problem := range e.Problems {
+		lines = append(lines, fmt.Sprintf("  - %s: %s", problem.Field, problem.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getConfigFilePath returns the path of the config file
+func getConfigFilePath() (string, error) {
+	if configFilePath != "" {
+		return configFilePath, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "attendance-tracker", "config.json"), nil
+}
+
+// Save configuration to the config file. Fields overridden by the
+// environment or command line keep their previous file values, so a
+// temporary override is never saved.
+func saveConfig(config *AppConfig) error {
+	path, err := getConfigFilePath()
+	if err != nil {
+		return err
+	}
+
+	saved := config
+	if len(configOverrides) > 0 {
+		previous, _, _ := loadConfigFile(path, nil)
+		values := configValues(config)
+		previousValues := configValues(previous)
+		for _, layer := range configOverrides {
+			for field := range layer.Values {
+				values[field] = previousValues[field]
+			}
+		}
+		saved, _ = decodeConfigValues(config, values)
+	}
+
+	if err := storeDeviceID(saved.DeviceID); err != nil {
+		return fmt.Errorf("could not save the device ID: %v", err)
+	}
+	return saveConfigFile(path, saved)
+}
+
+// Load configuration from the config file, applying environment and
+// command-line overrides and admin policies. A missing file gives the
+// defaults; an invalid one returns the defaults together with a *ConfigError.
+func loadConfig() (*AppConfig, error) {
+	config, _, err := loadConfigSources()
+	return config, err
+}
+
+// loadConfigSources loads the configuration like loadConfig and also
+// reports where each value came from
+func loadConfigSources() (*AppConfig, ConfigSources, error) {
+	policies := loadConfigPolicies()
+	path, err := getConfigFilePath()
+	if err != nil {
+		config, sources, _ := policies.resolve(configOverrides...)
+		return config, sources, err
+	}
+	return loadConfigFile(path, policies, configOverrides...)
+}
+
+// saveConfigFile writes config to path atomically, keeping the previous
+// file as path.bak
+func saveConfigFile(path string, config *AppConfig) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// The device ID is kept in device.json
+	file := newConfigFile(config)
+	file.DeviceID = ""
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := backupConfigFile(path, path+".bak"); err != nil {
+		return fmt.Errorf("could not back up previous config: %v", err)
+	}
+	return writeFileSync(path, data)
+}
+
+// backupConfigFile copies the config at path to backupPath, if there is one
+func backupConfigFile(path, backupPath string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileSync(backupPath, data)
+}
+
+// loadConfigFile reads the config at path, migrating older schema versions
+// in memory, and applies overrides and policies to it. Unknown keys, wrong
+// types and out-of-range values are all reported together in a *ConfigError;
+// the returned config then ignores the file.
+func loadConfigFile(path string, policies ConfigPolicies, overrides ...ConfigLayer) (*AppConfig, ConfigSources, error) {
+	fallback := func() (*AppConfig, ConfigSources) {
+		config, sources, _ := policies.resolve(overrides...)
+		return config, sources
+	}
+
+	raw, version, err := readConfigFile(path)
+	if os.IsNotExist(err) {
+		// No config file yet, use defaults
+		raw, version, err = map[string]interface{}{}, currentConfigVersion, nil
+	}
+	if err != nil {
+		config, sources := fallback()
+		return config, sources, err
+	}
+
+	if err := migrateConfig(raw, version); err != nil {
+		config, sources := fallback()
+		return config, sources, fmt.Errorf("could not migrate config file %s: %v", path, err)
+	}
+
+	layers := append([]ConfigLayer{{Source: configFileSource, Values: raw}}, overrides...)
+	config, sources, problems := policies.resolve(layers...)
+	if len(problems) > 0 {
+		config, sources := fallback()
+		return config, sources, &ConfigError{Path: path, Problems: problems}
+	}
+	return config, sources, nil
+}
+
+// readConfigFile parses the config at path and returns its schema version.
+// Files written before versioning count as version 1.
+func readConfigFile(path string) (map[string]interface{}, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+
+	version := 1
+	if value, ok := raw["schema_version"]; ok {
+		number, ok := value.(float64)
+		if !ok || number < 1 || number != float64(int(number)) {
+			return nil, 0, fmt.Errorf("config file %s: schema_version must be a positive whole number", path)
+		}
+		version = int(number)
+	}
+	if version > currentConfigVersion {
+		return nil, 0, fmt.Errorf("config file %s has schema version %d, but this version of Attendance Tracker only understands up to %d",
+			path, version, currentConfigVersion)
+	}
+
+	return raw, version, nil
+}
+
+// migrateConfig upgrades raw from version to the current schema
+func migrateConfig(raw map[string]interface{}, version int) error {
+	for v := version; v < currentConfigVersion; v++ {
+		if err := configMigrations[v-1](raw); err != nil {
+			return fmt.Errorf("version %d to %d: %v", v, v+1, err)
+		}
+		raw["schema_version"] = float64(v + 1)
+	}
+	return nil
+}
+
+// migrateConfigV1 upgrades unversioned config files. The keys are unchanged;
+// the file only gains its schema_version.
+func migrateConfigV1(raw map[string]interface{}) error {
+	return nil
+}
+
+// migrateConfigV2 replaces the whole-minute and whole-second integer timing
+// keys with duration strings, which also allow sub-minute and sub-second values
+func migrateConfigV2(raw map[string]interface{}) error {
+	legacy := []struct {
+		from, to string
+		unit     time.Duration
+	}{
+		{"idle_timeout_mins", "idle_timeout", time.Minute},
+		{"check_interval_secs", "check_interval", time.Second},
+	}
+
+	for _, key := range legacy {
+		value, ok := raw[key.from]
+		if !ok {
+			continue
+		}
+		delete(raw, key.from)
+
+		// A value of the wrong type is carried over so it is reported
+		// against the new key
+		if number, ok := value.(float64); ok {
+			value = formatConfigDuration(time.Duration(number * float64(key.unit)))
+		}
+		raw[key.to] = value
+	}
+	return nil
+}
+
+// migrateConfigV3 moves the device ID to device.json, which keeps it from
+// version 4 on so the two cannot disagree. If it cannot be moved, the
+// file's ID is used until the next load tries again.
+func migrateConfigV3(raw map[string]interface{}) error {
+	id, ok := raw["device_id"].(string)
+	if !ok || id == "" {
+		// Invalid values are left to be reported against the key
+		return nil
+	}
+	if err := adoptConfigDeviceID(id); err != nil {
+		logActivity(fmt.Sprintf("Error moving the device ID to the device identity: %v", err))
+		return nil
+	}
+	delete(raw, "device_id")
+	return nil
+}
+
+// decodeConfig converts a current-version raw config into an AppConfig and
+// validates it. Fields missing from raw keep their default values.
+func decodeConfig(raw map[string]interface{}) (*AppConfig, []ConfigProblem) {
+	config, problems := decodeConfigValues(NewAppConfig(), raw)
+	if len(problems) == 0 {
+		problems = validateConfig(config)
+	}
+	sortConfigProblems(problems)
+	return config, problems
+}
+
+// decodeConfigValues returns a copy of base with the fields in raw set.
+// Unknown keys and values of the wrong type are reported, not validated.
+func decodeConfigValues(base *AppConfig, raw map[string]interface{}) (*AppConfig, []ConfigProblem) {
+	file := newConfigFile(base)
+	targets := map[string]interface{}{
+		"schema_version":         &file.SchemaVersion,
+		"server_endpoint":        &file.ServerEndpoint,
+		"device_id":              &file.DeviceID,
+		"user_id":                &file.UserID,
+		"idle_timeout":           &file.IdleTimeout,
+		"check_interval":         &file.CheckInterval,
+		"developer_mode":         &file.DeveloperMode,
+		"show_activity_log":      &file.ShowActivityLog,
+		"show_idle_time":         &file.ShowIdleTime,
+		"auto_mode":              &file.AutoMode,
+		"run_at_startup":         &file.RunAtStartup,
+		"bind_device_to_machine": &file.BindDevice,
+		"update_channel":         &file.UpdateChannel,
+		"pinned_version":         &file.PinnedVersion,
+		"skipped_version":        &file.SkippedVersion,
+		"update_mode":            &file.UpdateMode,
+		"update_check_interval":  &file.UpdateInterval,
+	}
+
+	var problems []ConfigProblem
+	for key, value := range raw {
+		target, ok := targets[key]
+		if !ok {
+			problems = append(problems, ConfigProblem{Field: key, Message: "unknown field"})
+			continue
+		}
+		// Round-trip through JSON so each field gets Go's type checking
+		data, _ := json.Marshal(value)
+		if err := json.Unmarshal(data, target); err != nil {
+			problems = append(problems, ConfigProblem{Field: key, Message: describeConfigTypeError(err)})
+		}
+	}
+
+	return file.appConfig(), problems
+}
+
+// configValues returns the fields of config as raw config file values
+func configValues(config *AppConfig) map[string]interface{} {
+	data, _ := json.Marshal(newConfigFile(config))
+	var values map[string]interface{}
+	json.Unmarshal(data, &values)
+	delete(values, "schema_version")
+	return values
+}
+
+// sortConfigProblems orders problems by field for stable messages
+func sortConfigProblems(problems []ConfigProblem) {
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].Field < problems[j].Field
+	})
+}
+
+// describeConfigTypeError explains a value of the wrong type
+func describeConfigTypeError(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("expected %s, got %s", describeJSONType(typeErr.Type.Kind().String()), typeErr.Value)
+	}
+	return err.Error()
+}
+
+// describeJSONType names a Go kind the way it appears in JSON
+func describeJSONType(kind string) string {
+	switch kind {
+	case "int":
+		return "a whole number"
+	case "bool":
+		return "true or false"
+	default:
+		return kind
+	}
+}
+
+// newConfigFile converts config to its on-disk form
+func newConfigFile(config *AppConfig) *configFile {
+	return &configFile{
+		SchemaVersion:   currentConfigVersion,
+		ServerEndpoint:  config.ServerEndpoint,
+		DeviceID:        config.DeviceID,
+		UserID:          config.UserID,
+		IdleTimeout:     configDuration(config.IdleTimeout),
+		CheckInterval:   configDuration(config.CheckInterval),
+		DeveloperMode:   config.DeveloperMode,
+		ShowActivityLog: config.ShowActivityLog,
+		ShowIdleTime:    config.ShowIdleTime,
+		AutoMode:        config.AutoMode,
+		RunAtStartup:    config.RunAtStartup,
+		BindDevice:      config.BindDevice,
+		UpdateChannel:   config.UpdateChannel,
+		PinnedVersion:   config.PinnedVersion,
+		SkippedVersion:  config.SkippedVersion,
+		UpdateMode:      config.UpdateMode,
+		UpdateInterval:  configDuration(config.UpdateInterval),
+	}
+}
+
+// appConfig converts the on-disk form back to an AppConfig
+func (f *configFile) appConfig() *AppConfig {
+	return &AppConfig{
+		ServerEndpoint:  f.ServerEndpoint,
+		DeviceID:        f.DeviceID,
+		UserID:          f.UserID,
+		IdleTimeout:     time.Duration(f.IdleTimeout),
+		CheckInterval:   time.Duration(f.CheckInterval),
+		DeveloperMode:   f.DeveloperMode,
+		ShowActivityLog: f.ShowActivityLog,
+		ShowIdleTime:    f.ShowIdleTime,
+		AutoMode:        f.AutoMode,
+		RunAtStartup:    f.RunAtStartup,
+		BindDevice:      f.BindDevice,
+		UpdateChannel:   f.UpdateChannel,
+		PinnedVersion:   f.PinnedVersion,
+		SkippedVersion:  f.SkippedVersion,
+		UpdateMode:      f.UpdateMode,
+		UpdateInterval:  time.Duration(f.UpdateInterval),
+	}
+}
+
+// migrateConfigFile upgrades the config at path to the current schema version
+// and saves it, keeping the original as path.v<N>.bak. It returns the version
+// the file was migrated from.
+func migrateConfigFile(path string) (int, error) {
+	raw, version, err := readConfigFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if version == currentConfigVersion {
+		return version, nil
+	}
+
+	if err := migrateConfig(raw, version); err != nil {
+		return version, fmt.Errorf("could not migrate config file %s: %v", path, err)
+	}
+	config, problems := decodeConfig(raw)
+	if len(problems) > 0 {
+		return version, &ConfigError{Path: path, Problems: problems}
+	}
+
+	// Keep the pre-migration file; later saves only replace path.bak
+	if err := backupConfigFile(path, fmt.Sprintf("%s.v%d.bak", path, version)); err != nil {
+		return version, fmt.Errorf("could not back up config before migrating: %v", err)
+	}
+	if err := saveConfigFile(path, config); err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
+// migrateFromPreviousVersion handles data migration during upgrades
+func migrateFromPreviousVersion() {
+	fmt.Println("Running upgrade migration...")
+
+	path, err := getConfigFilePath()
+	if err != nil {
+		fmt.Printf("Warning: Could not locate config: %v\n", err)
+	} else if version, err := migrateConfigFile(path); os.IsNotExist(err) {
+		fmt.Println("No previous config to migrate")
+	} else if err != nil {
+		fmt.Printf("Error migrating config: %v\n", err)
+	} else if version == currentConfigVersion {
+		fmt.Printf("Config already at schema version %d\n", version)
+	} else {
+		fmt.Printf("Migrated config from schema version %d to %d\n", version, currentConfigVersion)
+	}
+
+	fmt.Println("Migration complete")
+}
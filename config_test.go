@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestConfig writes content as a config file in a fresh directory
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileMissingGivesDefaults(t *testing.T) {
+	config, _, err := loadConfigFile(filepath.Join(t.TempDir(), "config.json"), nil)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	if *config != *NewAppConfig() {
+		t.Errorf("config = %+v, want defaults", config)
+	}
+}
+
+func TestSaveConfigFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := NewAppConfig()
+	config.ServerEndpoint = "https://attendance.example.com/api/v1/events"
+	config.IdleTimeout = 90 * time.Second
+	config.CheckInterval = 500 * time.Millisecond
+	config.AutoMode = false
+
+	if err := saveConfigFile(path, config); err != nil {
+		t.Fatalf("saveConfigFile: %v", err)
+	}
+	loaded, _, err := loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	if *loaded != *config {
+		t.Errorf("loaded %+v, want %+v", loaded, config)
+	}
+
+	raw, version, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != currentConfigVersion || raw["schema_version"] != float64(currentConfigVersion) {
+		t.Errorf("saved schema version = %v, want %d", raw["schema_version"], currentConfigVersion)
+	}
+}
+
+func TestSaveConfigFileKeepsBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	first := NewAppConfig()
+	first.UserID = "user-first"
+	second := NewAppConfig()
+	second.UserID = "user-second"
+
+	if err := saveConfigFile(path, first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("backup created for the first save: %v", err)
+	}
+
+	if err := saveConfigFile(path, second); err != nil {
+		t.Fatal(err)
+	}
+	backup, _, err := loadConfigFile(path+".bak", nil)
+	if err != nil {
+		t.Fatalf("loading backup: %v", err)
+	}
+	if backup.UserID != "user-first" {
+		t.Errorf("backup user = %q, want user-first", backup.UserID)
+	}
+
+	// No temp files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("leftover temp file %s", entry.Name())
+		}
+	}
+}
+
+func TestLoadConfigFileReadsLegacyUnversionedFile(t *testing.T) {
+	path := writeTestConfig(t, `{
+		"server_endpoint": "https://attendance.example.com/api/v1/events",
+		"device_id": "device-legacy",
+		"user_id": "user-legacy",
+		"idle_timeout_mins": 30,
+		"check_interval_secs": 3,
+		"auto_mode": false
+	}`)
+
+	config, _, err := loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	if config.DeviceID != "device-legacy" || config.IdleTimeout != 30*time.Minute ||
+		config.CheckInterval != 3*time.Second || config.AutoMode {
+		t.Errorf("legacy config read as %+v", config)
+	}
+	// Fields missing from the file keep their defaults
+	if !config.ShowIdleTime {
+		t.Error("missing show_idle_time did not default to true")
+	}
+}
+
+func TestLoadConfigFileListsEveryInvalidField(t *testing.T) {
+	path := writeTestConfig(t, `{
+		"schema_version": 3,
+		"server_endpoint": "https://attendance.example.com/api/v1/events",
+		"idle_timeout": "twenty",
+		"auto_mode": "yes",
+		"colour": "blue"
+	}`)
+
+	config, _, err := loadConfigFile(path, nil)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("err = %v, want *ConfigError", err)
+	}
+	if *config != *NewAppConfig() {
+		t.Errorf("config = %+v, want defaults alongside the error", config)
+	}
+
+	var fields []string
+	for _, problem := range configErr.Problems {
+		fields = append(fields, problem.Field)
+	}
+	if got := strings.Join(fields, ","); got != "auto_mode,colour,idle_timeout" {
+		t.Errorf("invalid fields = %s, want auto_mode,colour,idle_timeout", got)
+	}
+	if !strings.Contains(err.Error(), `idle_timeout: expected a duration such as "90s" or "20m", got "twenty"`) {
+		t.Errorf("error does not explain the type mismatch:\n%v", err)
+	}
+}
+
+func TestLoadConfigFileRejectsOutOfRangeValues(t *testing.T) {
+	path := writeTestConfig(t, `{"schema_version": 3, "idle_timeout": "0s", "check_interval": "-2s"}`)
+
+	_, _, err := loadConfigFile(path, nil)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 {
+		t.Fatalf("err = %v, want problems for both timing fields", err)
+	}
+}
+
+func TestLoadConfigFileReadsLegacyIntegerTimings(t *testing.T) {
+	path := writeTestConfig(t, `{"schema_version": 2, "idle_timeout_mins": 30, "check_interval_secs": 3}`)
+
+	config, _, err := loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	if config.IdleTimeout != 30*time.Minute || config.CheckInterval != 3*time.Second {
+		t.Errorf("timings = %s, %s, want 30m, 3s", config.IdleTimeout, config.CheckInterval)
+	}
+}
+
+func TestLoadConfigFileReportsMistypedLegacyTiming(t *testing.T) {
+	path := writeTestConfig(t, `{"schema_version": 2, "idle_timeout_mins": "thirty"}`)
+
+	_, _, err := loadConfigFile(path, nil)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 1 || configErr.Problems[0].Field != "idle_timeout" {
+		t.Errorf("err = %v, want a problem for idle_timeout", err)
+	}
+}
+
+func TestFormatConfigDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		20 * time.Minute:             "20m",
+		90 * time.Second:             "1m30s",
+		500 * time.Millisecond:       "500ms",
+		2 * time.Hour:                "2h",
+		2*time.Hour + 30*time.Second: "2h0m30s",
+		time.Hour + 15*time.Minute:   "1h15m",
+		0:                            "0s",
+	}
+	for d, want := range cases {
+		if got := formatConfigDuration(d); got != want {
+			t.Errorf("formatConfigDuration(%d) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestLoadConfigFileRejectsNewerSchema(t *testing.T) {
+	path := writeTestConfig(t, `{"schema_version": 99}`)
+
+	if _, _, err := loadConfigFile(path, nil); err == nil || !strings.Contains(err.Error(), "schema version 99") {
+		t.Errorf("err = %v, want schema version error", err)
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	legacy := `{"server_endpoint": "https://attendance.example.com/api/v1/events", "idle_timeout_mins": 30, "check_interval_secs": 2}`
+	path := writeTestConfig(t, legacy)
+
+	from, err := migrateConfigFile(path)
+	if err != nil {
+		t.Fatalf("migrateConfigFile: %v", err)
+	}
+	if from != 1 {
+		t.Errorf("migrated from version %d, want 1", from)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var migrated map[string]interface{}
+	if err := json.Unmarshal(data, &migrated); err != nil {
+		t.Fatal(err)
+	}
+	if migrated["schema_version"] != float64(currentConfigVersion) {
+		t.Errorf("schema_version = %v, want %d", migrated["schema_version"], currentConfigVersion)
+	}
+	if migrated["idle_timeout"] != "30m" || migrated["check_interval"] != "2s" {
+		t.Errorf("timings migrated to %v, %v, want 30m, 2s", migrated["idle_timeout"], migrated["check_interval"])
+	}
+	if _, ok := migrated["idle_timeout_mins"]; ok {
+		t.Error("legacy idle_timeout_mins key kept after migration")
+	}
+
+	backup, err := os.ReadFile(path + ".v1.bak")
+	if err != nil {
+		t.Fatalf("reading migration backup: %v", err)
+	}
+	if string(backup) != legacy {
+		t.Errorf("backup = %s, want the original file", backup)
+	}
+
+	// Migrating again is a no-op
+	if from, err := migrateConfigFile(path); err != nil || from != currentConfigVersion {
+		t.Errorf("second migration = %d, %v", from, err)
+	}
+}
+
+func TestConfigDeviceIDMovesToIdentity(t *testing.T) {
+	identityPath := getDeviceIdentityPath()
+	original, err := loadDeviceIdentity(identityPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saveCurrentDeviceIdentity(original)
+
+	// A host name based ID from an older version is replaced, and kept
+	// until the server has been told
+	path := writeTestConfig(t, `{"schema_version": 3, "device_id": "`+legacyDeviceID()+`"}`)
+	config, _, err := loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	if config.DeviceID != original.DeviceID {
+		t.Errorf("device ID = %s, want the identity's %s", config.DeviceID, original.DeviceID)
+	}
+	if identity, _ := loadDeviceIdentity(identityPath); identity.Replaces != legacyDeviceID() {
+		t.Errorf("identity replaces %q, want %s", identity.Replaces, legacyDeviceID())
+	}
+
+	// Any other ID was chosen on purpose and is kept
+	path = writeTestConfig(t, `{"schema_version": 3, "device_id": "device-chosen"}`)
+	config, _, err = loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	if identity, _ := loadDeviceIdentity(identityPath); config.DeviceID != "device-chosen" || identity.DeviceID != "device-chosen" {
+		t.Errorf("device ID = %s, identity has %s, want device-chosen in both", config.DeviceID, identity.DeviceID)
+	}
+
+	// Saving, such as after editing it in Settings, writes the ID to the
+	// identity only
+	configFilePath = path
+	defer func() { configFilePath = "" }()
+	config.DeviceID = "device-edited"
+	if err := saveConfig(config); err != nil {
+		t.Fatalf("saveConfig: %v", err)
+	}
+	raw, _, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["device_id"]; ok {
+		t.Errorf("config file still holds device_id %v", raw["device_id"])
+	}
+	if identity, _ := loadDeviceIdentity(identityPath); identity.DeviceID != "device-edited" || NewAppConfig().DeviceID != "device-edited" {
+		t.Errorf("identity has %s, want device-edited", identity.DeviceID)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ControlServer accepts commands for a running tracker on a local socket.
+// Each line sent is one command; each command gets a one-line reply
+// starting with "ok" or "error".
+type ControlServer struct {
+	listener net.Listener
+	path     string
+	tracker  *Tracker
+	quit     func()
+}
+
+// getControlSocketPath returns the path of the local control socket. It is
+// alone in its directory so the directory's permissions guard it.
+func getControlSocketPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// Fallback to a per-user temp directory if config dir can't be determined
+		return filepath.Join(os.TempDir(), fmt.Sprintf("attendance-tracker-%d", os.Getuid()), "control.sock")
+	}
+	return filepath.Join(configDir, "attendance-tracker", "control", "control.sock")
+}
+
+// StartControlServer listens on path and serves commands for tracker.
+// The quit callback is invoked when a client sends "quit".
+func StartControlServer(path string, tracker *Tracker, quit func()) (*ControlServer, error) {
+	// Only the current user may control the tracker. The socket is created
+	// in a directory no one else can enter, so others cannot connect in the
+	// moment before its own permissions are set.
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not restrict %s to the current user: %v", dir, err)
+	}
+
+	// A leftover socket from a crashed run blocks listening; a live one means
+	// another tracker is already running
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another tracker is already listening on %s", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("could not restrict %s to the current user: %v", path, err)
+	}
+
+	server := &ControlServer{listener: listener, path: path, tracker: tracker, quit: quit}
+	go server.serve()
+
+	logActivity(fmt.Sprintf("Control socket listening on %s", path))
+	return server, nil
+}
+
+// Close stops accepting commands and removes the socket
+func (c *ControlServer) Close() {
+	c.listener.Close()
+	os.Remove(c.path)
+}
+
+// serve accepts connections until the listener is closed
+func (c *ControlServer) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logActivity(fmt.Sprintf("Control socket error: %v", err))
+			}
+			return
+		}
+		go c.handle(conn)
+	}
+}
+
+// handle answers every command sent on a connection
+func (c *ControlServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" {
+			continue
+		}
+
+		reply, err := c.execute(command)
+		if err != nil {
+			fmt.Fprintf(conn, "error %v\n", err)
+		} else {
+			fmt.Fprintf(conn, "ok %s\n", reply)
+		}
+
+		if command == "quit" {
+			c.quit()
+			return
+		}
+	}
+}
+
+// execute runs a single control command
+func (c *ControlServer) execute(command string) (string, error) {
+	now := time.Now()
+	sm := c.tracker.State
+
+	var err error
+	switch command {
+	case "status":
+		return describeTrackerStatus(c.tracker, now), nil
+	case "check-in":
+		err = sm.CheckIn(now)
+	case "check-out":
+		err = sm.CheckOut(now)
+	case "toggle":
+		err = sm.Toggle(now)
+	case "break":
+		err = sm.StartBreak(now)
+	case "resume":
+		err = sm.EndBreak(now)
+	case "reset-device-id":
+		id, err := c.tracker.ReenrollDevice(SourceManual, "reset by user")
+		if err != nil {
+			return "", err
+		}
+		return "device_id=" + id, nil
+	case "reload-credentials":
+		c.tracker.loadCredentials()
+		c.tracker.Outbox.Wake()
+	case "quit":
+		return "shutting down", nil
+	default:
+		return "", fmt.Errorf("unknown command %q", command)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return describeTrackerStatus(c.tracker, now), nil
+}
+
+// describeTrackerStatus formats the tracker state as key=value pairs
+func describeTrackerStatus(tracker *Tracker, now time.Time) string {
+	state, since := tracker.State.State()
+	return fmt.Sprintf("state=%s since=%s worked=%s idle=%s queued=%d signed_in=%t",
+		state, since.Format(time.RFC3339), formatDuration(tracker.State.WorkedToday(now)),
+		formatDuration(tracker.State.IdleTime()), tracker.Outbox.Stats().Depth, tracker.Credentials() != nil)
+}
+
+// sendControlCommand sends one command to a running tracker and returns its reply
+func sendControlCommand(path string, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("no running tracker on %s: %v", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	reply = strings.TrimSpace(reply)
+
+	if strings.HasPrefix(reply, "error ") {
+		return "", errors.New(strings.TrimPrefix(reply, "error "))
+	}
+	return strings.TrimPrefix(reply, "ok "), nil
+}
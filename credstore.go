@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CredentialStore keeps secrets for this app, one per account name
+type CredentialStore interface {
+	// Name is shown in Settings, e.g. "Secret Service"
+	Name() string
+	// Get returns errCredentialNotFound if account has no secret
+	Get(account string) ([]byte, error)
+	Set(account string, secret []byte) error
+	// Delete succeeds if account has no secret
+	Delete(account string) error
+}
+
+// errCredentialNotFound is returned by CredentialStore.Get for unknown accounts
+var errCredentialNotFound = errors.New("credential not found")
+
+// Service name the app's secrets are filed under in the OS keyring
+const credentialService = "attendance-tracker"
+
+// openCredentialStore returns the OS keyring, or the encrypted file when
+// there is none (such as on headless Linux without a Secret Service)
+func openCredentialStore() CredentialStore {
+	if store := platformCredentialStore(); store != nil {
+		return store
+	}
+	return newFileCredentialStore(getCredentialsFilePath())
+}
+
+// getCredentialsFilePath returns the path of the encrypted credentials file
+func getCredentialsFilePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// Fallback to temp directory if config dir can't be determined
+		return filepath.Join(os.TempDir(), "attendance-tracker-credentials.enc")
+	}
+	return filepath.Join(configDir, "attendance-tracker", "credentials.enc")
+}
+
+// fileCredentialStore keeps secrets in a file encrypted with AES-256-GCM.
+// The key is derived from ATTENDANCE_CREDENTIAL_KEY if set, or else from the
+// machine ID, so a copy of the file is useless on another machine. It does
+// not protect against other programs running as the same user.
+type fileCredentialStore struct {
+	path string
+	key  []byte // Overrides the derived key, for tests
+
+	mu sync.Mutex
+}
+
+// credentialFile is the on-disk format of the encrypted credentials file
+type credentialFile struct {
+	Version int               `json:"version"`
+	Salt    []byte            `json:"salt"`
+	Entries map[string][]byte `json:"entries"` // Nonce followed by ciphertext
+}
+
+func newFileCredentialStore(path string) *fileCredentialStore {
+	return &fileCredentialStore{path: path}
+}
+
+func (s *fileCredentialStore) Name() string {
+	return "encrypted file"
+}
+
+func (s *fileCredentialStore) Get(account string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	sealed, ok := file.Entries[account]
+	if !ok {
+		return nil, errCredentialNotFound
+	}
+
+	aead, err := s.cipher(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s: damaged entry for %s", s.path, account)
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(account))
+	if err != nil {
+		return nil, fmt.Errorf("%s: could not decrypt the entry for %s (was the file copied from another machine?)", s.path, account)
+	}
+	return secret, nil
+}
+
+func (s *fileCredentialStore) Set(account string, secret []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	aead, err := s.cipher(file.Salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	file.Entries[account] = aead.Seal(nonce, nonce, secret, []byte(account))
+	return s.write(file)
+}
+
+func (s *fileCredentialStore) Delete(account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := file.Entries[account]; !ok {
+		return nil
+	}
+	delete(file.Entries, account)
+	return s.write(file)
+}
+
+// read loads the file, or starts a new one with a fresh salt
+func (s *fileCredentialStore) read() (*credentialFile, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		return &credentialFile{Version: 1, Salt: salt, Entries: map[string][]byte{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file credentialFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", s.path, err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("%s has unsupported version %d", s.path, file.Version)
+	}
+	if file.Entries == nil {
+		file.Entries = map[string][]byte{}
+	}
+	return &file, nil
+}
+
+// write saves the file readable only by the current user
+func (s *fileCredentialStore) write(file *credentialFile) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	// writeFileSync creates its temp file with mode 0600
+	return writeFileSync(s.path, data)
+}
+
+// cipher returns the AES-GCM cipher for the file's salt
+func (s *fileCredentialStore) cipher(salt []byte) (cipher.AEAD, error) {
+	secret := s.key
+	if secret == nil {
+		if key := os.Getenv("ATTENDANCE_CREDENTIAL_KEY"); key != "" {
+			secret = []byte(key)
+		} else {
+			machineID, err := readMachineID()
+			if err != nil {
+				// Still better than a fixed key
+				machineID, err = os.Hostname()
+				if err != nil {
+					return nil, fmt.Errorf("no key for the credentials file: %v", err)
+				}
+			}
+			secret = []byte(machineID)
+		}
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(credentialService + " credentials\n"))
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
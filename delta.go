@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Suffix and infix of patch assets in GitHub releases. The patch that turns
+// version 1.0.0 of "attendance-tracker_linux_amd64" into the release's
+// version is published with it as
+// "attendance-tracker_linux_amd64.from-1.0.0.bsdiff".
+const (
+	patchAssetSuffix = ".bsdiff"
+	patchAssetInfix  = ".from-"
+)
+
+// Largest executable a patch may produce
+const maxPatchedSize = 512 << 20
+
+// UpdatePatch is a bsdiff patch from one version of a release asset to
+// another
+type UpdatePatch struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"` // Of the patch file; the result is always checked against the release
+}
+
+// githubReleasePatches returns the patches published in a GitHub release
+// for the release's asset named assetName
+func githubReleasePatches(release *githubRelease, assetName string) []UpdatePatch {
+	to := strings.TrimPrefix(release.TagName, "v")
+	prefix := assetName + patchAssetInfix
+	var patches []UpdatePatch
+	for _, asset := range release.Assets {
+		if !strings.HasPrefix(asset.Name, prefix) || !strings.HasSuffix(asset.Name, patchAssetSuffix) {
+			continue
+		}
+		from := strings.TrimSuffix(strings.TrimPrefix(asset.Name, prefix), patchAssetSuffix)
+		patches = append(patches, UpdatePatch{From: from, To: to, URL: asset.DownloadURL, Size: asset.Size})
+	}
+	return patches
+}
+
+// findPatchChain returns the shortest series of patches leading from
+// version from to version to, or false if there is none. Versions are
+// compared by SemVer precedence, so "v1.1" matches "1.1.0".
+func findPatchChain(patches []UpdatePatch, from, to string) ([]UpdatePatch, bool) {
+	start, err := parseSemVer(from)
+	if err != nil {
+		return nil, false
+	}
+	target, err := parseSemVer(to)
+	if err != nil {
+		return nil, false
+	}
+
+	// Breadth-first from the current version, remembering how each
+	// version was reached
+	type step struct {
+		version SemVer
+		chain   []UpdatePatch
+	}
+	queue := []step{{version: start}}
+	seen := []SemVer{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, patch := range patches {
+			patchFrom, err := parseSemVer(patch.From)
+			if err != nil || patchFrom.Compare(current.version) != 0 {
+				continue
+			}
+			patchTo, err := parseSemVer(patch.To)
+			if err != nil {
+				continue
+			}
+			chain := append(append([]UpdatePatch{}, current.chain...), patch)
+			if patchTo.Compare(target) == 0 {
+				return chain, true
+			}
+			visited := false
+			for _, v := range seen {
+				if v.Compare(patchTo) == 0 {
+					visited = true
+					break
+				}
+			}
+			if !visited {
+				seen = append(seen, patchTo)
+				queue = append(queue, step{version: patchTo, chain: chain})
+			}
+		}
+	}
+	return nil, false
+}
+
+// patchSize returns the total download size of a patch chain, or 0 if a
+// patch's size is unknown
+func patchSize(patches []UpdatePatch) int64 {
+	var total int64
+	for _, patch := range patches {
+		if patch.Size <= 0 {
+			return 0
+		}
+		total += patch.Size
+	}
+	return total
+}
+
+// fetchPatchedUpdate builds the update at dest by downloading info.Patches
+// and applying them in turn to the executable at source. The result must
+// have the SHA-256 expected by the signed manifest.
+func fetchPatchedUpdate(ctx context.Context, info *UpdateInfo, source, dest, expected string, progress func(DownloadProgress)) error {
+	if len(info.Patches) == 0 {
+		return errors.New("no patches")
+	}
+	// Archives and packages hold more than the executable on disk
+	if info.Package != PackageBinary && info.Package != PackageAppImage {
+		return fmt.Errorf("%s packages cannot be patched", info.Package)
+	}
+
+	current, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	// Report progress over the whole chain
+	total := patchSize(info.Patches)
+	var done int64
+	for i, patch := range info.Patches {
+		partPath := filepath.Join(filepath.Dir(dest), fmt.Sprintf("patch-%d-from-%s.part", i, patch.From))
+		err := downloadUpdate(ctx, patch.URL, partPath, func(p DownloadProgress) {
+			if progress != nil {
+				progress(DownloadProgress{Downloaded: done + p.Downloaded, Total: total, Rate: p.Rate})
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("could not download the patch from %s: %v", patch.From, err)
+		}
+		data, err := os.ReadFile(partPath)
+		os.Remove(partPath)
+		if err != nil {
+			return err
+		}
+		done += int64(len(data))
+
+		if patch.SHA256 != "" {
+			sum := sha256.Sum256(data)
+			if hex.EncodeToString(sum[:]) != strings.ToLower(patch.SHA256) {
+				return fmt.Errorf("the patch from %s does not match its checksum", patch.From)
+			}
+		}
+		if current, err = applyBSDiff(current, data); err != nil {
+			return fmt.Errorf("could not apply the patch from %s: %v", patch.From, err)
+		}
+	}
+
+	sum := sha256.Sum256(current)
+	if got := hex.EncodeToString(sum[:]); got != expected {
+		return fmt.Errorf("patched file has SHA-256 %s, but the release lists %s", got, expected)
+	}
+	partPath := dest + ".part"
+	if err := os.WriteFile(partPath, current, 0644); err != nil {
+		return err
+	}
+	return os.Rename(partPath, dest)
+}
+
+// applyBSDiff applies a patch in the BSDIFF40 format written by bsdiff 4.x
+// to old. The patch holds three bzip2 streams: control triples, bytes to
+// add to old and bytes to insert.
+func applyBSDiff(old, patch []byte) ([]byte, error) {
+	const headerSize = 32
+	if len(patch) < headerSize || string(patch[:8]) != "BSDIFF40" {
+		return nil, errors.New("not a BSDIFF40 patch")
+	}
+	ctrlLen := bsdiffInt(patch[8:16])
+	diffLen := bsdiffInt(patch[16:24])
+	newSize := bsdiffInt(patch[24:32])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || newSize > maxPatchedSize ||
+		ctrlLen > int64(len(patch)-headerSize) || diffLen > int64(len(patch)-headerSize)-ctrlLen {
+		return nil, errors.New("corrupt patch header")
+	}
+	body := patch[headerSize:]
+	ctrl := bzip2.NewReader(bytes.NewReader(body[:ctrlLen]))
+	diff := bzip2.NewReader(bytes.NewReader(body[ctrlLen : ctrlLen+diffLen]))
+	extra := bzip2.NewReader(bytes.NewReader(body[ctrlLen+diffLen:]))
+
+	result := make([]byte, newSize)
+	var newPos, oldPos int64
+	triple := make([]byte, 24)
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, triple); err != nil {
+			return nil, fmt.Errorf("corrupt patch control block: %v", err)
+		}
+		diffCount := bsdiffInt(triple[0:8])
+		extraCount := bsdiffInt(triple[8:16])
+		seek := bsdiffInt(triple[16:24])
+
+		if diffCount < 0 || diffCount > newSize-newPos {
+			return nil, errors.New("corrupt patch: diff runs past the end of the file")
+		}
+		if _, err := io.ReadFull(diff, result[newPos:newPos+diffCount]); err != nil {
+			return nil, fmt.Errorf("corrupt patch diff block: %v", err)
+		}
+		for i := int64(0); i < diffCount; i++ {
+			if at := oldPos + i; at >= 0 && at < int64(len(old)) {
+				result[newPos+i] += old[at]
+			}
+		}
+		newPos += diffCount
+		oldPos += diffCount
+
+		if extraCount < 0 || extraCount > newSize-newPos {
+			return nil, errors.New("corrupt patch: extra data runs past the end of the file")
+		}
+		if _, err := io.ReadFull(extra, result[newPos:newPos+extraCount]); err != nil {
+			return nil, fmt.Errorf("corrupt patch extra block: %v", err)
+		}
+		newPos += extraCount
+		oldPos += seek
+	}
+	return result, nil
+}
+
+// bsdiffInt decodes bsdiff's 64-bit sign-magnitude little-endian integer
+func bsdiffInt(b []byte) int64 {
+	value := int64(binary.LittleEndian.Uint64(b) &^ (1 << 63))
+	if b[7]&0x80 != 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Patches written with Python's bz2 module in the BSDIFF40 format.
+// smallPatch turns "abcdefgh" into "ABCD--abc" with a backwards seek;
+// releasePatch appends one more "attendance tracker update " to 19999 of
+// them, giving the binary served by newTestRelease.
+const (
+	smallPatch   = "QlNESUZGNDAxAAAAAAAAACkAAAAAAAAACQAAAAAAAABCWmg5MUFZJlNZFg7KHQAAC2BAXAAIAEAAIAAwwASmCQcgclkPO+LuSKcKEgLB2UOgQlpoOTFBWSZTWYesnFYAAAPAAUAAQAAgADCAbahJxdyRThQkIesnFYBCWmg5MUFZJlNZa3A+sAAAAJAAAAIgACEYRsLuSKcKEg1uB9YA"
+	releasePatch = "QlNESUZGNDAxAAAAAAAAAC8AAAAAAAAAQO8HAAAAAABCWmg5MUFZJlNZXnPT+wAABnABYIgAEAEAAACgACGTBCGAURO6XeLuSKcKEgvOen9gQlpoOTFBWSZTWY6dL50AA/vgAMAAACAACCAAMMwJqmmEBtVQDxdyRThQkI6dL51CWmg5MUFZJlNZOds/pQAAAxGAQAAuCVYAIAAhqeiepspiAaaaOhhC8RcZlKfKsujou5IpwoSBztn9KA=="
+)
+
+func mustDecodePatch(t *testing.T, encoded string) []byte {
+	t.Helper()
+	patch, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return patch
+}
+
+func TestApplyBSDiff(t *testing.T) {
+	patch := mustDecodePatch(t, smallPatch)
+	got, err := applyBSDiff([]byte("abcdefgh"), patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ABCD--abc" {
+		t.Errorf("patched to %q, want ABCD--abc", got)
+	}
+
+	corrupt := map[string][]byte{
+		"empty":     nil,
+		"magic":     append([]byte("BSDIFF41"), patch[8:]...),
+		"truncated": patch[:len(patch)-20],
+		"header":    append(append([]byte{}, patch[:8]...), bytes.Repeat([]byte{0xff}, 24)...),
+	}
+	for name, data := range corrupt {
+		if _, err := applyBSDiff([]byte("abcdefgh"), data); err == nil {
+			t.Errorf("%s: corrupt patch was applied", name)
+		}
+	}
+}
+
+func TestFindPatchChain(t *testing.T) {
+	patches := []UpdatePatch{
+		{From: "1.0.0", To: "1.1.0", URL: "a"},
+		{From: "1.1.0", To: "1.2.0", URL: "b"},
+		{From: "1.2.0", To: "1.3.0", URL: "c"},
+		{From: "v1.1", To: "1.3.0", URL: "skip"},
+		{From: "1.3.0", To: "1.0.0", URL: "loop"},
+	}
+	cases := []struct {
+		from, to string
+		want     string
+	}{
+		{"1.0.0", "1.1.0", "a"},
+		{"1.0.0", "1.2.0", "ab"},
+		{"1.0.0", "1.3.0", "askip"},
+		{"1.2.0", "1.3.0", "c"},
+		{"0.9.0", "1.3.0", ""},
+		{"1.0.0", "1.4.0", ""},
+	}
+	for _, c := range cases {
+		chain, ok := findPatchChain(patches, c.from, c.to)
+		var got string
+		for _, patch := range chain {
+			got += patch.URL
+		}
+		if ok != (c.want != "") || got != c.want {
+			t.Errorf("%s to %s: chain %q, want %q", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestFetchPatchedUpdate(t *testing.T) {
+	patch := mustDecodePatch(t, releasePatch)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(patch)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "attendance-tracker")
+	unit := []byte("attendance tracker update ")
+	if err := os.WriteFile(source, bytes.Repeat(unit, 19999), 0755); err != nil {
+		t.Fatal(err)
+	}
+	want := bytes.Repeat(unit, 20000)
+	sum := sha256.Sum256(want)
+	patchSum := sha256.Sum256(patch)
+
+	info := &UpdateInfo{
+		Version: "9.0.0",
+		Package: PackageBinary,
+		Patches: []UpdatePatch{{From: "1.0.0", To: "9.0.0", URL: server.URL, Size: int64(len(patch)), SHA256: hex.EncodeToString(patchSum[:])}},
+	}
+	dest := filepath.Join(dir, "update")
+	var last DownloadProgress
+	if err := fetchPatchedUpdate(context.Background(), info, source, dest, hex.EncodeToString(sum[:]), func(p DownloadProgress) { last = p }); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, want) {
+		t.Error("patched file differs from the release")
+	}
+	if last.Downloaded != int64(len(patch)) || last.Total != int64(len(patch)) {
+		t.Errorf("last progress = %+v, want the whole patch", last)
+	}
+
+	// A result that does not match the release is not kept
+	os.Remove(dest)
+	if err := fetchPatchedUpdate(context.Background(), info, source, dest, hex.EncodeToString(make([]byte, 32)), nil); err == nil {
+		t.Error("patched file with the wrong checksum was accepted")
+	}
+	if fileExists(dest) {
+		t.Error("patched file with the wrong checksum was kept")
+	}
+}
+
+func TestFetchVerifiedUpdateFallsBackFromPatch(t *testing.T) {
+	release, info := newTestRelease(t, "9.0.0")
+	info.Package = PackageBinary
+	// The patch does not fit the test binary, so the full download is used
+	info.Patches = []UpdatePatch{{From: Version, To: "9.0.0", URL: info.DownloadURL + ".from-" + Version + patchAssetSuffix}}
+
+	path, err := fetchVerifiedUpdate(context.Background(), info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, release.binary) {
+		t.Error("downloaded file differs from the release")
+	}
+}
+
+func TestGithubReleasePatches(t *testing.T) {
+	var release githubRelease
+	release.TagName = "v1.2.0"
+	for _, name := range []string{
+		"attendance-tracker_linux_amd64",
+		"attendance-tracker_linux_amd64.from-1.1.0.bsdiff",
+		"attendance-tracker_linux_amd64.from-1.0.0.bsdiff",
+		"attendance-tracker_linux_arm64.from-1.1.0.bsdiff",
+		"attendance-tracker_linux_amd64.sha256",
+	} {
+		release.Assets = append(release.Assets, struct {
+			Size        int64  `json:"size"`
+			Name        string `json:"name"`
+			DownloadURL string `json:"browser_download_url"`
+		}{Name: name, DownloadURL: "https://example.com/" + name})
+	}
+
+	patches := githubReleasePatches(&release, "attendance-tracker_linux_amd64")
+	if len(patches) != 2 || patches[0].From != "1.1.0" || patches[1].From != "1.0.0" || patches[0].To != "1.2.0" {
+		t.Errorf("patches = %+v, want ones from 1.1.0 and 1.0.0 to 1.2.0", patches)
+	}
+
+	// Patches are never picked as the update itself
+	asset := ReleaseAsset{Name: "attendance-tracker_linux_amd64.from-1.1.0.bsdiff"}
+	if classifyAsset(&asset) {
+		t.Errorf("patch classified as %+v", asset)
+	}
+}
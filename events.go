@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types understood by the attendance server
+const (
+	EventCheckIn  = "check_in"
+	EventCheckOut = "check_out"
+	EventIdle     = "idle"
+	EventActive   = "active"
+
+	// The device ID was replaced; the payload names the previous one
+	EventDeviceChanged = "device_changed"
+)
+
+// Event sources, so the server can tell user actions from auto mode
+const (
+	SourceManual = "manual"
+	SourceAuto   = "auto"
+)
+
+// NewStatusPayload builds the payload for an event that happened at the given time
+func NewStatusPayload(config *AppConfig, eventType string, source string, at time.Time) StatusPayload {
+	timestamp := at
+	return StatusPayload{
+		EventType: eventType,
+		UserID:    config.UserID,
+		Payload: PayloadContent{
+			Time:     at.Format("15:04:05"),
+			Date:     at.Format("2006-01-02"),
+			DeviceID: config.DeviceID,
+			Source:   source,
+		},
+		Timestamp: &timestamp,
+	}
+}
+
+// EventSendError describes a failed delivery to the server
+type EventSendError struct {
+	StatusCode int    // HTTP status code, 0 if the request never got a response
+	Message    string // Response body or transport error
+	Retryable  bool   // Whether sending the same event again may succeed
+}
+
+func (e *EventSendError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("could not reach server: %s", e.Message)
+	}
+	return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// EventResult is the outcome of the most recent send attempt
+type EventResult struct {
+	Payload StatusPayload
+	Err     error
+	Time    time.Time
+}
+
+// EventSender posts attendance events to the configured server endpoint
+type EventSender struct {
+	config *SharedConfig
+	client *http.Client
+
+	mu              sync.Mutex
+	credentials     *Credentials
+	lastResult      *EventResult
+	listeners       []func(EventResult)
+	policyListeners []func(*ConfigPolicy)
+}
+
+// Largest response body read from the server
+const maxServerResponseSize = 64 * 1024
+
+// NewEventSender creates a sender for the endpoint in config
+func NewEventSender(config *SharedConfig) *EventSender {
+	return &EventSender{
+		config: config,
+		client: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// SetCredentials makes the sender authenticate as credentials, or send
+// unauthenticated requests if nil
+func (s *EventSender) SetCredentials(credentials *Credentials) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentials = credentials
+}
+
+// credentialsFor returns the credentials to send to endpoint. They are only
+// used for the server that issued them, so changing the server URL never
+// leaks them to another host.
+func (s *EventSender) credentialsFor(endpoint string) *Credentials {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.credentials == nil || s.credentials.Server != serverOrigin(endpoint) {
+		return nil
+	}
+	return s.credentials
+}
+
+// OnResult registers a callback invoked after every send attempt
+func (s *EventSender) OnResult(listener func(EventResult)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// OnPolicy registers a callback invoked when a server response carries a config policy
+func (s *EventSender) OnPolicy(listener func(*ConfigPolicy)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policyListeners = append(s.policyListeners, listener)
+}
+
+// LastResult returns the outcome of the most recent send attempt, or nil
+func (s *EventSender) LastResult() *EventResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastResult
+}
+
+// Send posts a single payload to the server and reports the result
+func (s *EventSender) Send(payload StatusPayload) error {
+	policy, err := s.post(payload)
+
+	if err != nil {
+		logActivity(fmt.Sprintf("Failed to send %s event: %v", payload.EventType, err))
+	} else {
+		logActivity(fmt.Sprintf("Sent %s event for %s %s", payload.EventType, payload.Payload.Date, payload.Payload.Time))
+	}
+
+	result := EventResult{Payload: payload, Err: err, Time: time.Now()}
+
+	s.mu.Lock()
+	s.lastResult = &result
+	listeners := append([]func(EventResult){}, s.listeners...)
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(result)
+	}
+
+	if policy != nil {
+		s.mu.Lock()
+		policyListeners := append([]func(*ConfigPolicy){}, s.policyListeners...)
+		s.mu.Unlock()
+
+		for _, listener := range policyListeners {
+			listener(policy)
+		}
+	}
+
+	return err
+}
+
+// post performs the HTTP request and classifies the response. A successful
+// response may carry a config policy for this device.
+func (s *EventSender) post(payload StatusPayload) (*ConfigPolicy, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, &EventSendError{Message: err.Error()}
+	}
+
+	endpoint := s.config.Load().ServerEndpoint
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, &EventSendError{Message: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AttendanceTracker/"+Version)
+	if credentials := s.credentialsFor(endpoint); credentials != nil {
+		credentials.authorize(req, body, time.Now())
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, &EventSendError{Message: err.Error(), Retryable: true}
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxServerResponseSize))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		policy, err := parseServerPolicy(respBody)
+		if err != nil {
+			// The event was still delivered
+			logActivity(fmt.Sprintf("Ignoring config from server: %v", err))
+		}
+		return policy, nil
+	}
+
+	// Keep only the start of the body for error messages
+	if len(respBody) > 1024 {
+		respBody = respBody[:1024]
+	}
+	message := string(bytes.TrimSpace(respBody))
+	if resp.StatusCode == http.StatusUnauthorized {
+		message = strings.TrimSpace("sign in again in Settings or with --sign-in. " + message)
+	}
+	return nil, &EventSendError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		Retryable:  isRetryableStatus(resp.StatusCode),
+	}
+}
+
+// parseServerPolicy extracts the policy from a response body of the form
+// {"config": {"defaults": {...}, "locked": {...}}}. Bodies that are not JSON
+// or have no config return nil.
+func parseServerPolicy(body []byte) (*ConfigPolicy, error) {
+	var response struct {
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || len(response.Config) == 0 || string(response.Config) == "null" {
+		return nil, nil
+	}
+	return parseConfigPolicy(response.Config, serverPolicySource)
+}
+
+// isRetryableStatus reports whether a status code indicates a temporary failure
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusUnauthorized:
+		// Kept queued until the device signs in again
+		return true
+	}
+	return code >= 500
+}
+
+// describeEventResult formats a send result for display in the UI
+func describeEventResult(result *EventResult) string {
+	if result == nil {
+		return "Server: no events sent yet"
+	}
+	when := result.Time.Format("15:04:05")
+	if result.Err != nil {
+		return fmt.Sprintf("Server: %s failed at %s (%v)", result.Payload.EventType, when, result.Err)
+	}
+	return fmt.Sprintf("Server: %s delivered at %s", result.Payload.EventType, when)
+}
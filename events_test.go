@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusPayloadJSON(t *testing.T) {
+	config := NewAppConfig()
+	config.UserID = "user-1"
+	config.DeviceID = "device-1"
+	at := time.Date(2026, 3, 2, 9, 5, 7, 0, time.UTC)
+
+	data, err := json.Marshal(NewStatusPayload(config, EventCheckIn, SourceAuto, at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := got["payload"].(map[string]interface{})
+	want := map[string]interface{}{
+		"event_type": EventCheckIn,
+		"user_id":    "user-1",
+		"timestamp":  "2026-03-02T09:05:07Z",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+	wantPayload := map[string]interface{}{
+		"time":      "09:05:07",
+		"date":      "2026-03-02",
+		"device_id": "device-1",
+		"source":    SourceAuto,
+	}
+	for key, value := range wantPayload {
+		if payload[key] != value {
+			t.Errorf("payload.%s = %v, want %v", key, payload[key], value)
+		}
+	}
+	for _, key := range []string{"previous_device_id", "reason", "activity", "config"} {
+		if _, ok := payload[key]; ok {
+			t.Errorf("payload.%s is set for a check-in", key)
+		}
+	}
+}
+
+func TestEventSenderStatusCodes(t *testing.T) {
+	cases := []struct {
+		status    int
+		wantErr   bool
+		retryable bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusNoContent, false, false},
+		{http.StatusBadRequest, true, false},
+		{http.StatusForbidden, true, false},
+		{http.StatusUnprocessableEntity, true, false},
+		{http.StatusUnauthorized, true, true},
+		{http.StatusRequestTimeout, true, true},
+		{http.StatusTooManyRequests, true, true},
+		{http.StatusInternalServerError, true, true},
+		{http.StatusServiceUnavailable, true, true},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			w.Write([]byte(" rejected \n"))
+		}))
+		config := NewAppConfig()
+		config.ServerEndpoint = server.URL
+		sender := NewEventSender(NewSharedConfig(config))
+
+		err := sender.Send(NewStatusPayload(config, EventCheckOut, SourceManual, time.Now()))
+		server.Close()
+		if !c.wantErr {
+			if err != nil {
+				t.Errorf("status %d: %v", c.status, err)
+			}
+			continue
+		}
+		var sendErr *EventSendError
+		if !errors.As(err, &sendErr) {
+			t.Errorf("status %d: error %v, want an EventSendError", c.status, err)
+			continue
+		}
+		if sendErr.StatusCode != c.status || sendErr.Retryable != c.retryable || !strings.HasSuffix(sendErr.Message, "rejected") {
+			t.Errorf("status %d: %+v, want retryable %v", c.status, sendErr, c.retryable)
+		}
+		if result := sender.LastResult(); result == nil || result.Err != err {
+			t.Errorf("status %d: last result %+v, want the error", c.status, result)
+		}
+	}
+}
+
+func TestEventSenderUnreachableServer(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	config := NewAppConfig()
+	config.ServerEndpoint = server.URL
+
+	err := NewEventSender(NewSharedConfig(config)).Send(NewStatusPayload(config, EventCheckIn, SourceManual, time.Now()))
+	var sendErr *EventSendError
+	if !errors.As(err, &sendErr) || sendErr.StatusCode != 0 || !sendErr.Retryable {
+		t.Errorf("error = %v, want a retryable transport error", err)
+	}
+}
+
+func TestEventSenderPostsPayload(t *testing.T) {
+	var received StatusPayload
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	config := NewAppConfig()
+	config.ServerEndpoint = server.URL
+	payload := NewStatusPayload(config, EventIdle, SourceAuto, time.Now())
+	if err := NewEventSender(NewSharedConfig(config)).Send(payload); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if received.EventType != EventIdle || received.Payload.DeviceID != payload.Payload.DeviceID || received.Payload.Time != payload.Payload.Time || !received.Timestamp.Equal(*payload.Timestamp) {
+		t.Errorf("server received %+v, want %+v", received, payload)
+	}
+}
+
+func TestEventSenderCredentialsFor(t *testing.T) {
+	sender := NewEventSender(NewSharedConfig(NewAppConfig()))
+	if sender.credentialsFor("https://attendance.example.com/api/v1/events") != nil {
+		t.Error("credentials returned before signing in")
+	}
+
+	sender.SetCredentials(&Credentials{Server: "https://attendance.example.com", Type: AuthBearer, Token: "token"})
+	cases := map[string]bool{
+		"https://attendance.example.com/api/v1/events":     true,
+		"https://ATTENDANCE.example.com/other":             true,
+		"http://attendance.example.com/api/v1/events":      false,
+		"https://attendance.example.com:8443/api/v1/event": false,
+		"https://evil.example.com/api/v1/events":           false,
+		"not a url":                                        false,
+	}
+	for endpoint, want := range cases {
+		if got := sender.credentialsFor(endpoint) != nil; got != want {
+			t.Errorf("%s: credentials sent = %v, want %v", endpoint, got, want)
+		}
+	}
+}
+
+func TestParseServerPolicy(t *testing.T) {
+	policy, err := parseServerPolicy([]byte(`{"status": "ok", "config": {"defaults": {"idle_timeout": "30m"}, "locked": {"auto_mode": false}}}`))
+	if err != nil || policy == nil {
+		t.Fatalf("policy = %v, %v", policy, err)
+	}
+	if policy.Source != serverPolicySource || policy.Defaults["idle_timeout"] != "30m" || policy.Locked["auto_mode"] != false {
+		t.Errorf("policy = %+v", policy)
+	}
+
+	// Responses without a policy
+	for _, body := range []string{"", "ok", `{"status": "ok"}`, `{"config": null}`} {
+		if policy, err := parseServerPolicy([]byte(body)); policy != nil || err != nil {
+			t.Errorf("%q: policy = %v, %v, want none", body, policy, err)
+		}
+	}
+
+	// Policies with invalid values are rejected as a whole
+	if policy, err := parseServerPolicy([]byte(`{"config": {"locked": {"idle_timeout": "soon"}}}`)); policy != nil || err == nil {
+		t.Errorf("invalid policy = %v, %v, want an error", policy, err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// fakeClock is a manually advanced Clock
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// timelineSpan is a half-open period [Start, End)
+type timelineSpan struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (s timelineSpan) contains(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// fakeIdleProvider replays a scripted timeline of user activity.
+// Idle time is zero while inside an active span and otherwise counts
+// from the end of the most recent span (or the start of the timeline).
+type fakeIdleProvider struct {
+	clock   Clock
+	origin  time.Time
+	active  []timelineSpan
+	failing []timelineSpan
+}
+
+func newFakeIdleProvider(clock Clock) *fakeIdleProvider {
+	return &fakeIdleProvider{clock: clock, origin: clock.Now()}
+}
+
+// Active scripts continuous user input between start and end
+func (p *fakeIdleProvider) Active(start, end time.Time) *fakeIdleProvider {
+	p.active = append(p.active, timelineSpan{Start: start, End: end})
+	return p
+}
+
+// Failing scripts a period where the OS query returns an error
+func (p *fakeIdleProvider) Failing(start, end time.Time) *fakeIdleProvider {
+	p.failing = append(p.failing, timelineSpan{Start: start, End: end})
+	return p
+}
+
+func (p *fakeIdleProvider) IdleTime() (time.Duration, error) {
+	now := p.clock.Now()
+
+	for _, span := range p.failing {
+		if span.contains(now) {
+			return 0, errors.New("idle time unavailable")
+		}
+	}
+
+	lastInput := p.origin
+	for _, span := range p.active {
+		if span.contains(now) {
+			return 0, nil
+		}
+		if !span.End.After(now) && span.End.After(lastInput) {
+			lastInput = span.End
+		}
+	}
+	return now.Sub(lastInput), nil
+}
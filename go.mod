@@ -2,9 +2,12 @@ module attendance-tracker
 
 go 1.20
 
-require fyne.io/fyne/v2 v2.5.5
-
-require fyne.io/systray v1.11.0 // indirect
+require (
+	fyne.io/fyne/v2 v2.5.5
+	fyne.io/systray v1.11.0
+	github.com/godbus/dbus/v5 v5.1.0
+	golang.org/x/image v0.18.0
+)
 
 require (
 	github.com/BurntSushi/toml v1.4.0 // indirect
@@ -18,7 +21,6 @@ require (
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20240506104042-037f3cc74f2a // indirect
 	github.com/go-text/render v0.2.0 // indirect
 	github.com/go-text/typesetting v0.2.0 // indirect
-	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/gopherjs/gopherjs v1.17.2 // indirect
 	github.com/jeandeaual/go-locale v0.0.0-20240223122105-ce5225dcaa49 // indirect
 	github.com/jsummers/gobmp v0.0.0-20151104160322-e2ba15ffa76e // indirect
@@ -30,7 +32,6 @@ require (
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
 	github.com/yuin/goldmark v1.7.1 // indirect
-	golang.org/x/image v0.18.0 // indirect
 	golang.org/x/mobile v0.0.0-20231127183840-76ac6878050a // indirect
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How long a shutting-down tracker waits for the final events to be delivered
+const shutdownFlushTimeout = 10 * time.Second
+
+// runHeadless runs the tracker without a window until it receives
+// SIGINT/SIGTERM or a "quit" command on the control socket.
+func runHeadless(config *AppConfig) error {
+	logToStdout = true
+	logActivity(fmt.Sprintf("Attendance Tracker %s starting in headless mode (log file: %s)", Version, getLogFilePath()))
+
+	tracker, err := NewTracker(config)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	tracker.Run(done)
+
+	confirmUpdateWhenHealthy()
+	if message := takeRolledBackUpdate(); message != "" {
+		logActivity(message)
+	}
+
+	quit := make(chan string, 1)
+
+	// Without a window there is no one to ask, so updates are only
+	// installed in auto mode
+	updates := NewUpdateScheduler(tracker)
+	updates.OnPrompt = func(info *UpdateInfo, path string) {
+		logActivity(fmt.Sprintf("Update %s is available; install it from the app, or set update_mode to %q to install updates automatically", info.Version, UpdateModeAuto))
+	}
+	updates.OnInstall = func(info *UpdateInfo, path string) {
+		if err := installVerifiedUpdate(path, info); err != nil {
+			logActivity(fmt.Sprintf("Could not install update %s: %v", info.Version, err))
+			return
+		}
+		select {
+		case quit <- "update to " + info.Version:
+		default:
+		}
+	}
+	go updates.Run(done)
+
+	control, err := StartControlServer(getControlSocketPath(), tracker, func() {
+		// One reason to shut down is enough; never block the connection
+		select {
+		case quit <- "control socket":
+		default:
+		}
+	})
+	if err != nil {
+		// The tracker still works without remote control
+		logActivity(fmt.Sprintf("Control socket unavailable: %v", err))
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var reason string
+	select {
+	case sig := <-signals:
+		reason = sig.String()
+	case reason = <-quit:
+	}
+	logActivity(fmt.Sprintf("Shutting down (%s)", reason))
+
+	if control != nil {
+		control.Close()
+	}
+
+	// Record the final check-out and give it a chance to reach the server
+	tracker.State.Stop(time.Now())
+	if !tracker.Outbox.WaitEmpty(shutdownFlushTimeout) {
+		logActivity(fmt.Sprintf("Shutdown: %d events left queued for the next run", tracker.Outbox.Stats().Depth))
+	}
+
+	close(done)
+	return nil
+}
+
+// runSignIn enrolls the device from the command line, reading the password
+// or enrollment code from in, and tells a running tracker to use the new
+// credentials
+func runSignIn(config *AppConfig, in io.Reader, out io.Writer) error {
+	fmt.Fprintf(out, "Signing in to %s as %s\nPassword or enrollment code: ", serverOrigin(config.ServerEndpoint), config.UserID)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return errors.New("no password given")
+	}
+	password := strings.TrimSpace(line)
+	if password == "" {
+		return errors.New("no password given")
+	}
+
+	credentials, err := enrollDevice(config.ServerEndpoint, config.UserID, config.DeviceID, password)
+	if err != nil {
+		return err
+	}
+	store := openCredentialStore()
+	if err := saveCredentials(store, credentials); err != nil {
+		return fmt.Errorf("could not store credentials in %s: %v", store.Name(), err)
+	}
+	fmt.Fprintf(out, "Signed in; credentials stored in %s\n", store.Name())
+
+	reloadRunningTracker()
+	return nil
+}
+
+// runSignOut removes the stored credentials for the configured server
+func runSignOut(config *AppConfig, out io.Writer) error {
+	store := openCredentialStore()
+	if err := store.Delete(serverOrigin(config.ServerEndpoint)); err != nil {
+		return fmt.Errorf("could not remove credentials from %s: %v", store.Name(), err)
+	}
+	fmt.Fprintf(out, "Signed out of %s\n", serverOrigin(config.ServerEndpoint))
+
+	reloadRunningTracker()
+	return nil
+}
+
+// reloadRunningTracker asks a running headless tracker to reread its
+// credentials; there may not be one
+func reloadRunningTracker() {
+	if _, err := sendControlCommand(getControlSocketPath(), "reload-credentials"); err == nil {
+		fmt.Println("The running tracker now uses the new credentials")
+	}
+}
+
+// runVerifyHistory checks the local history chain and prints the result.
+// It reports false if the history was tampered with or damaged.
+func runVerifyHistory(out io.Writer) (bool, error) {
+	store := openCredentialStore()
+	key, err := loadHistoryKey(store, false)
+	if errors.Is(err, errCredentialNotFound) {
+		// Older versions and unwritable keyrings fall back to the file
+		key, err = loadHistoryKey(newFileCredentialStore(getCredentialsFilePath()), false)
+	}
+	if errors.Is(err, errCredentialNotFound) {
+		// The chain can still be checked; signed records are reported
+		key, err = nil, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not read the history signing key: %v", err)
+	}
+
+	path := getHistoryFilePath()
+	verification, err := verifyHistory(path, key)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprint(out, describeHistoryVerification(path, verification))
+	return len(verification.Problems) == 0, nil
+}
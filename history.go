@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HistoryRecord is one attendance transition stored in the local history.
+// Records are chained: each carries the hash of the line before it and an
+// HMAC made with the device's history key, so edits and removals can be
+// detected by verifyHistory. Records written by older versions have no
+// chain fields, and records written without a key have no HMAC.
+type HistoryRecord struct {
+	Time   time.Time       `json:"time"`
+	From   AttendanceState `json:"from"`
+	To     AttendanceState `json:"to"`
+	Event  string          `json:"event,omitempty"`
+	Source string          `json:"source"`
+	Seq    uint64          `json:"seq,omitempty"`  // Position in the chain, from 1
+	Prev   string          `json:"prev,omitempty"` // Hex SHA-256 of the previous line
+	KeyID  string          `json:"key,omitempty"`  // Identifies the signing key
+	MAC    string          `json:"mac,omitempty"`  // HMAC-SHA256 of the record without mac
+}
+
+// HistoryInterval is a period spent in a single state
+type HistoryInterval struct {
+	State       AttendanceState
+	Start       time.Time
+	End         time.Time
+	StartSource string
+	EndSource   string
+	Ongoing     bool // Still in this state right now
+	Unfinished  bool // The app stopped without recording the end
+}
+
+// Duration returns the length of the interval
+func (i HistoryInterval) Duration() time.Duration {
+	return i.End.Sub(i.Start)
+}
+
+// HistoryDay summarises one calendar day of attendance
+type HistoryDay struct {
+	Date     string
+	Sessions []HistoryInterval // Periods spent checked in
+	Gaps     []HistoryInterval // Breaks, idle and locked periods between sessions
+	Worked   time.Duration
+}
+
+// HistoryStore is an append-only JSON-lines log of attendance transitions
+type HistoryStore struct {
+	path     string
+	openedAt time.Time
+	key      []byte // Signs the chain
+
+	mu   sync.Mutex
+	head ChainHead
+}
+
+// getHistoryFilePath returns the path to the local attendance history
+func getHistoryFilePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// Fallback to temp directory if config dir can't be determined
+		return filepath.Join(os.TempDir(), "attendance-tracker-history.jsonl")
+	}
+	return filepath.Join(configDir, "attendance-tracker", "history.jsonl")
+}
+
+// OpenHistoryStore opens (creating if needed) the history file at path.
+// New records are signed with key.
+func OpenHistoryStore(path string, key []byte) (*HistoryStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	head, err := readChainHead(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HistoryStore{path: path, openedAt: time.Now(), key: key, head: head}, nil
+}
+
+// Append records a transition at the end of the history, chained to the
+// record before it
+func (h *HistoryStore) Append(t Transition) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	record := HistoryRecord{
+		Time:   t.At,
+		From:   t.From,
+		To:     t.To,
+		Event:  t.Event,
+		Source: t.Source,
+		Seq:    h.head.Seq + 1,
+		Prev:   h.head.Hash,
+	}
+	line, err := signHistoryRecord(record, h.key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	h.head = ChainHead{Seq: record.Seq, Hash: hashHistoryLine(line)}
+	return nil
+}
+
+// Head returns the latest link of the chain
+func (h *HistoryStore) Head() ChainHead {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.head
+}
+
+// Records returns every stored transition in time order
+func (h *HistoryStore) Records() ([]HistoryRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	file, err := os.Open(h.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []HistoryRecord
+	err = scanHistoryLines(file, func(lineNo int, _ []byte, record *HistoryRecord) {
+		if record == nil {
+			// A crash can leave a truncated last line; skip anything unreadable
+			logActivity(fmt.Sprintf("History: skipping unreadable record on line %d", lineNo))
+			return
+		}
+		records = append(records, *record)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	return records, nil
+}
+
+// Days summarises every day between from and to (inclusive), newest first.
+// Days without any recorded activity are left out.
+func (h *HistoryStore) Days(from, to time.Time, now time.Time) ([]HistoryDay, error) {
+	records, err := h.Records()
+	if err != nil {
+		return nil, err
+	}
+
+	byDate := make(map[string]*HistoryDay)
+	for _, interval := range buildIntervals(records, h.openedAt, now) {
+		for _, part := range splitByDay(interval) {
+			day := startOfDay(part.Start)
+			if day.Before(startOfDay(from)) || day.After(startOfDay(to)) {
+				continue
+			}
+			date := day.Format("2006-01-02")
+			if byDate[date] == nil {
+				byDate[date] = &HistoryDay{Date: date}
+			}
+			if part.State == StateCheckedIn {
+				byDate[date].Sessions = append(byDate[date].Sessions, part)
+				byDate[date].Worked += part.Duration()
+			} else {
+				byDate[date].Gaps = append(byDate[date].Gaps, part)
+			}
+		}
+	}
+
+	var days []HistoryDay
+	for _, day := range byDate {
+		day.Gaps = gapsBetweenSessions(day.Sessions, day.Gaps)
+		days = append(days, *day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date > days[j].Date
+	})
+
+	return days, nil
+}
+
+// buildIntervals turns consecutive transitions into the periods between them.
+// An interval only ends at the next record if that record continues from the
+// same state; otherwise the app stopped without recording the end.
+func buildIntervals(records []HistoryRecord, openedAt, now time.Time) []HistoryInterval {
+	var intervals []HistoryInterval
+
+	for i, record := range records {
+		if record.To == StateCheckedOut {
+			continue
+		}
+
+		interval := HistoryInterval{
+			State:       record.To,
+			Start:       record.Time,
+			End:         record.Time,
+			StartSource: record.Source,
+		}
+
+		switch {
+		case i+1 < len(records) && records[i+1].From == record.To:
+			interval.End = records[i+1].Time
+			interval.EndSource = records[i+1].Source
+		case i+1 == len(records) && !record.Time.Before(openedAt):
+			interval.End = now
+			interval.Ongoing = true
+		default:
+			interval.Unfinished = true
+		}
+
+		intervals = append(intervals, interval)
+	}
+
+	return intervals
+}
+
+// splitByDay cuts an interval at each midnight it crosses
+func splitByDay(interval HistoryInterval) []HistoryInterval {
+	var parts []HistoryInterval
+	for {
+		midnight := startOfDay(interval.Start).AddDate(0, 0, 1)
+		if !interval.End.After(midnight) {
+			return append(parts, interval)
+		}
+		part := interval
+		part.End = midnight
+		part.Ongoing = false
+		part.Unfinished = false
+		parts = append(parts, part)
+		interval.Start = midnight
+	}
+}
+
+// gapsBetweenSessions keeps only the non-working periods that fall between two sessions
+func gapsBetweenSessions(sessions, periods []HistoryInterval) []HistoryInterval {
+	if len(sessions) == 0 {
+		return nil
+	}
+	first := sessions[0].Start
+	last := sessions[len(sessions)-1].End
+
+	var gaps []HistoryInterval
+	for _, period := range periods {
+		if !period.Start.Before(first) && !period.End.After(last) {
+			gaps = append(gaps, period)
+		}
+	}
+	return gaps
+}
+
+// describeInterval formats an interval as a single line for the History tab
+func describeInterval(interval HistoryInterval) string {
+	end := interval.End.Format("15:04:05")
+	switch {
+	case interval.Ongoing:
+		end = "now"
+	case interval.Unfinished:
+		end = "? (app exited)"
+	}
+
+	source := interval.StartSource
+	if interval.EndSource != "" && interval.EndSource != interval.StartSource {
+		source += " → " + interval.EndSource
+	}
+
+	return fmt.Sprintf("%s – %s  %s  (%s)", interval.Start.Format("15:04:05"), end,
+		formatDuration(interval.Duration()), source)
+}
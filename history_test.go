@@ -0,0 +1,219 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testHistoryKey = []byte("0123456789abcdef0123456789abcdef")
+
+// writeTestHistory appends count transitions to a new history file and
+// returns its path and lines
+func writeTestHistory(t *testing.T, count int) (string, []string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	history, err := OpenHistoryStore(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	states := []AttendanceState{StateCheckedOut, StateCheckedIn}
+	for i := 0; i < count; i++ {
+		tr := Transition{From: states[i%2], To: states[(i+1)%2], At: start.Add(time.Duration(i) * time.Hour), Source: SourceManual}
+		if err := history.Append(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path, readTestLines(t, path)
+}
+
+func readTestLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeTestLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistoryChainVerifies(t *testing.T) {
+	path, lines := writeTestHistory(t, 4)
+
+	v, err := verifyHistory(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Problems) > 0 || v.Records != 4 {
+		t.Fatalf("verification = %+v, want 4 intact records", v)
+	}
+	if want := hashHistoryLine([]byte(lines[3])); v.Head.Seq != 4 || v.Head.Hash != want {
+		t.Errorf("head = %+v, want seq 4 and the last line's hash", v.Head)
+	}
+
+	// Reopening continues the chain from the same head
+	history, err := OpenHistoryStore(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Head() != v.Head {
+		t.Errorf("reopened head = %+v, want %+v", history.Head(), v.Head)
+	}
+}
+
+func TestHistoryChainDetectsTampering(t *testing.T) {
+	cases := map[string]func(lines []string) []string{
+		"edited": func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], "10:00:00", "11:30:00", 1)
+			return lines
+		},
+		"removed": func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		},
+		"reordered": func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		},
+		"inserted": func(lines []string) []string {
+			legacy := `{"time":"2026-03-02T10:30:00Z","from":"checked_in","to":"checked_out","source":"manual"}`
+			return append(lines[:2], append([]string{legacy}, lines[2:]...)...)
+		},
+		"first removed": func(lines []string) []string {
+			return lines[1:]
+		},
+		"garbled": func(lines []string) []string {
+			lines[1] = lines[1][:len(lines[1])/2]
+			return lines
+		},
+	}
+
+	for name, tamper := range cases {
+		path, lines := writeTestHistory(t, 4)
+		writeTestLines(t, path, tamper(lines))
+
+		v, err := verifyHistory(path, testHistoryKey)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(v.Problems) == 0 {
+			t.Errorf("%s: tampering not detected", name)
+		}
+	}
+}
+
+func TestHistoryChainReportsForeignKey(t *testing.T) {
+	path, _ := writeTestHistory(t, 2)
+
+	v, err := verifyHistory(path, []byte("another key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Problems) != 1 || !strings.Contains(v.Problems[0], "2 records are signed with a key") {
+		t.Errorf("problems = %v, want one foreign key problem", v.Problems)
+	}
+}
+
+func TestHistoryChainAnchorsLegacyRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	legacy := `{"time":"2026-03-01T09:00:00Z","from":"checked_out","to":"checked_in","source":"manual"}`
+	// A crash left the legacy line without its newline
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := OpenHistoryStore(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Append(Transition{From: StateCheckedIn, To: StateCheckedOut, At: time.Now(), Source: SourceManual}); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := verifyHistory(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Problems) > 0 || v.Legacy != 1 || v.Records != 1 {
+		t.Errorf("verification = %+v, want 1 legacy and 1 intact record", v)
+	}
+
+	records, err := history.Records()
+	if err != nil || len(records) != 2 {
+		t.Errorf("records = %v, %v, want both", records, err)
+	}
+}
+
+func TestHistoryChainReportsUnsignedRecords(t *testing.T) {
+	// Written when neither the keyring nor the credentials file was usable
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	history, err := OpenHistoryStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := history.Append(Transition{From: StateCheckedOut, To: StateCheckedIn, At: time.Now(), Source: SourceManual}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range readTestLines(t, path) {
+		if strings.Contains(line, `"mac"`) {
+			t.Errorf("record without a key has a MAC: %s", line)
+		}
+	}
+
+	for _, key := range [][]byte{nil, testHistoryKey} {
+		v, err := verifyHistory(path, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Records != 2 || len(v.Problems) != 1 || !strings.Contains(v.Problems[0], "2 records are unsigned") {
+			t.Errorf("key %q: verification = %+v, want 2 unsigned records", key, v)
+		}
+	}
+}
+
+func TestHistoryChainSkipsRecordCutShortByCrash(t *testing.T) {
+	path, lines := writeTestHistory(t, 3)
+	// The last write stopped halfway
+	lines[2] = lines[2][:len(lines[2])/2]
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := verifyHistory(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Problems) > 0 || v.Records != 2 || v.Cut != 1 {
+		t.Errorf("verification = %+v, want 2 intact records and 1 cut short", v)
+	}
+
+	// The next run links past it
+	history, err := OpenHistoryStore(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Append(Transition{From: StateCheckedIn, To: StateCheckedOut, At: time.Now(), Source: SourceManual}); err != nil {
+		t.Fatal(err)
+	}
+	v, err = verifyHistory(path, testHistoryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Problems) > 0 || v.Records != 3 || v.Cut != 1 || v.Head.Seq != 3 {
+		t.Errorf("verification after the next run = %+v, want 3 intact records and 1 cut short", v)
+	}
+	if got := describeHistoryVerification(path, v); !strings.Contains(got, "1 records were cut short") || !strings.Contains(got, "OK") {
+		t.Errorf("description = %q", got)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeviceIdentity is the persistent identity of this installation. Its random
+// ID replaces the host name based IDs of older versions, so renaming or
+// re-imaging a computer keeps its ID and machines with the same host name
+// no longer collide. It is the only place the device ID is kept.
+type DeviceIdentity struct {
+	DeviceID  string    `json:"device_id"`
+	Machine   string    `json:"machine,omitempty"`  // Fingerprint of the machine ID it was created on
+	Replaces  string    `json:"replaces,omitempty"` // Host name based ID the server has not been told about yet
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// getDeviceIdentityPath returns where the device identity is kept, next to
+// the config so both move together
+func getDeviceIdentityPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// Fallback to temp directory if config dir can't be determined
+		return filepath.Join(os.TempDir(), "attendance-tracker-device.json")
+	}
+	return filepath.Join(configDir, "attendance-tracker", "device.json")
+}
+
+// getDeviceID returns the ID of this device, creating its identity on first run
+func getDeviceID() string {
+	identity, err := loadDeviceIdentity(getDeviceIdentityPath())
+	if err != nil {
+		logActivity(fmt.Sprintf("Error reading device identity, using host name: %v", err))
+		return legacyDeviceID()
+	}
+	return identity.DeviceID
+}
+
+var (
+	defaultDeviceIDMu    sync.Mutex
+	defaultDeviceIDValue string
+)
+
+// defaultDeviceID returns the device ID for default configs. The identity is
+// read, or created, when a config is first built rather than at startup, so
+// commands that never load the config do not write it.
+func defaultDeviceID() string {
+	defaultDeviceIDMu.Lock()
+	defer defaultDeviceIDMu.Unlock()
+	if defaultDeviceIDValue == "" {
+		defaultDeviceIDValue = getDeviceID()
+	}
+	return defaultDeviceIDValue
+}
+
+// saveCurrentDeviceIdentity saves identity as this device's and makes new
+// configs use its ID
+func saveCurrentDeviceIdentity(identity *DeviceIdentity) error {
+	if err := saveDeviceIdentity(getDeviceIdentityPath(), identity); err != nil {
+		return err
+	}
+	defaultDeviceIDMu.Lock()
+	defaultDeviceIDValue = identity.DeviceID
+	defaultDeviceIDMu.Unlock()
+	return nil
+}
+
+// storeDeviceID makes id this device's ID, such as when it is edited in
+// Settings
+func storeDeviceID(id string) error {
+	identity, err := loadDeviceIdentity(getDeviceIdentityPath())
+	if err != nil {
+		return err
+	}
+	if identity.DeviceID == id {
+		return nil
+	}
+	identity.DeviceID = id
+	return saveCurrentDeviceIdentity(identity)
+}
+
+// adoptConfigDeviceID takes over the device ID of a config file from before
+// version 4. A host name based ID is replaced by the identity's random one
+// and kept in Replaces until the server has been told; any other ID was
+// chosen on purpose and is kept.
+func adoptConfigDeviceID(id string) error {
+	if id != legacyDeviceID() {
+		return storeDeviceID(id)
+	}
+	identity, err := loadDeviceIdentity(getDeviceIdentityPath())
+	if err != nil {
+		return err
+	}
+	if identity.DeviceID == id || identity.Replaces == id {
+		return nil
+	}
+	identity.Replaces = id
+	return saveCurrentDeviceIdentity(identity)
+}
+
+// loadDeviceIdentity reads the identity at path, creating and saving a new
+// one if there is none
+func loadDeviceIdentity(path string) (*DeviceIdentity, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		identity, err := newDeviceIdentity()
+		if err != nil {
+			return nil, err
+		}
+		if err := saveDeviceIdentity(path, identity); err != nil {
+			return nil, err
+		}
+		logActivity(fmt.Sprintf("Created device identity %s", identity.DeviceID))
+		return identity, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var identity DeviceIdentity
+	if err := json.Unmarshal(data, &identity); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	if identity.DeviceID == "" {
+		return nil, fmt.Errorf("%s has no device_id", path)
+	}
+	return &identity, nil
+}
+
+// saveDeviceIdentity writes identity to path
+func saveDeviceIdentity(path string, identity *DeviceIdentity) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(identity, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path, data)
+}
+
+// newDeviceIdentity creates an identity with a random ID for this machine
+func newDeviceIdentity() (*DeviceIdentity, error) {
+	id, err := newDeviceUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceIdentity{
+		DeviceID:  "device-" + id,
+		Machine:   machineFingerprint(),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// newDeviceUUID returns a random (version 4) UUID
+func newDeviceUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// machineFingerprint identifies the machine without revealing its machine
+// ID, or returns "" if the machine ID cannot be read
+func machineFingerprint() string {
+	machineID, err := readMachineID()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(credentialService + " device\n" + machineID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Patterns for the machine IDs reported by macOS and Windows
+var (
+	ioregPlatformUUID = regexp.MustCompile(`"IOPlatformUUID"\s*=\s*"([^"]+)"`)
+	regMachineGUID    = regexp.MustCompile(`MachineGuid\s+REG_SZ\s+(\S+)`)
+)
+
+// readMachineID returns the operating system's ID for this installation:
+// /etc/machine-id on Linux, the IOPlatformUUID on macOS and the
+// MachineGuid on Windows
+func readMachineID() (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return "", err
+		}
+		if match := ioregPlatformUUID.FindSubmatch(output); match != nil {
+			return string(match[1]), nil
+		}
+		return "", errors.New("no IOPlatformUUID in ioreg output")
+
+	case "windows":
+		// /reg:64 reads the real key from a 32-bit build too
+		output, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid", "/reg:64").Output()
+		if err != nil {
+			return "", err
+		}
+		if match := regMachineGUID.FindSubmatch(output); match != nil {
+			return string(match[1]), nil
+		}
+		return "", errors.New("no MachineGuid in the registry")
+
+	default:
+		for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+			if data, err := os.ReadFile(path); err == nil {
+				if id := strings.TrimSpace(string(data)); id != "" {
+					return id, nil
+				}
+			}
+		}
+		return "", errors.New("no /etc/machine-id")
+	}
+}
+
+// deviceMovedMachines reports whether identity was created on another
+// machine, such as when the profile was copied or a disk image cloned.
+// Identities from machines without a readable ID never count as moved.
+func deviceMovedMachines(identity *DeviceIdentity, fingerprint string) bool {
+	return identity.Machine != "" && fingerprint != "" && identity.Machine != fingerprint
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestNewDeviceUUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := newDeviceUUID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pattern.MatchString(id) {
+			t.Fatalf("%s is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate UUID %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestLoadDeviceIdentityPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device.json")
+
+	first, err := loadDeviceIdentity(path)
+	if err != nil {
+		t.Fatalf("creating identity: %v", err)
+	}
+	second, err := loadDeviceIdentity(path)
+	if err != nil {
+		t.Fatalf("reading identity: %v", err)
+	}
+	if first.DeviceID != second.DeviceID {
+		t.Errorf("device ID changed from %s to %s between runs", first.DeviceID, second.DeviceID)
+	}
+	if first.DeviceID == legacyDeviceID() {
+		t.Errorf("new identity uses the host name based ID %s", first.DeviceID)
+	}
+}
+
+func TestDeviceMovedMachines(t *testing.T) {
+	cases := []struct {
+		created, current string
+		moved            bool
+	}{
+		{"aaaa", "aaaa", false},
+		{"aaaa", "bbbb", true},
+		{"", "bbbb", false}, // Created without a readable machine ID
+		{"aaaa", "", false}, // Machine ID not readable now
+	}
+	for _, c := range cases {
+		identity := &DeviceIdentity{DeviceID: "device-test", Machine: c.created}
+		if got := deviceMovedMachines(identity, c.current); got != c.moved {
+			t.Errorf("created on %q, running on %q: moved = %t, want %t", c.created, c.current, got, c.moved)
+		}
+	}
+}
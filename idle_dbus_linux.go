@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// mutterIdleBackend asks GNOME Shell's Mutter for the idle time.
+// This works on both X11 and Wayland GNOME sessions.
+type mutterIdleBackend struct{}
+
+func (mutterIdleBackend) Name() string {
+	return "GNOME Mutter IdleMonitor (D-Bus)"
+}
+
+func (mutterIdleBackend) IdleTime() (time.Duration, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return 0, err
+	}
+
+	var idleMs uint64
+	obj := conn.Object("org.gnome.Mutter.IdleMonitor", "/org/gnome/Mutter/IdleMonitor/Core")
+	if err := obj.Call("org.gnome.Mutter.IdleMonitor.GetIdletime", 0).Store(&idleMs); err != nil {
+		return 0, err
+	}
+	return time.Duration(idleMs) * time.Millisecond, nil
+}
+
+// screenSaverIdleBackend uses the org.freedesktop.ScreenSaver interface.
+// KDE Plasma implements GetSessionIdleTime and reports milliseconds.
+type screenSaverIdleBackend struct{}
+
+func (screenSaverIdleBackend) Name() string {
+	return "org.freedesktop.ScreenSaver (D-Bus)"
+}
+
+func (screenSaverIdleBackend) IdleTime() (time.Duration, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return 0, err
+	}
+
+	var idleMs uint32
+	obj := conn.Object("org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver")
+	if err := obj.Call("org.freedesktop.ScreenSaver.GetSessionIdleTime", 0).Store(&idleMs); err != nil {
+		return 0, err
+	}
+	return time.Duration(idleMs) * time.Millisecond, nil
+}
@@ -0,0 +1,96 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event type bits from linux/input-event-codes.h
+const (
+	evKey = 1
+	evRel = 2
+)
+
+// evdevIdleBackend watches /dev/input event devices and records when the
+// last event arrived. It works without any display server but needs read
+// access to the devices (usually membership of the "input" group).
+type evdevIdleBackend struct {
+	once      sync.Once
+	startErr  error
+	lastInput int64 // Unix nanoseconds, accessed atomically; 0 until the first event
+}
+
+func (b *evdevIdleBackend) Name() string {
+	return "/dev/input event timestamps"
+}
+
+func (b *evdevIdleBackend) IdleTime() (time.Duration, error) {
+	b.once.Do(b.start)
+	if b.startErr != nil {
+		return 0, b.startErr
+	}
+	// Nothing is known about input from before the devices were opened
+	lastInput := atomic.LoadInt64(&b.lastInput)
+	if lastInput == 0 {
+		return 0, errors.New("no input events seen yet")
+	}
+	return time.Since(time.Unix(0, lastInput)), nil
+}
+
+// start opens every keyboard and pointer device and watches it for events
+func (b *evdevIdleBackend) start() {
+	devices, _ := filepath.Glob("/dev/input/event*")
+	opened := 0
+	for _, device := range devices {
+		if !isUserInputDevice(filepath.Base(device)) {
+			continue
+		}
+		file, err := os.Open(device)
+		if err != nil {
+			continue
+		}
+		opened++
+		go b.watch(file)
+	}
+
+	if opened == 0 {
+		b.startErr = errors.New("no readable input devices in /dev/input")
+	}
+}
+
+// watch records the arrival time of every event read from a device
+func (b *evdevIdleBackend) watch(file *os.File) {
+	defer file.Close()
+
+	// The event layout differs between architectures; only arrival matters
+	buf := make([]byte, 64)
+	for {
+		if _, err := file.Read(buf); err != nil {
+			return
+		}
+		atomic.StoreInt64(&b.lastInput, time.Now().UnixNano())
+	}
+}
+
+// isUserInputDevice reports whether an event device has keys or relative
+// axes, which excludes sensors such as accelerometers that never go quiet
+func isUserInputDevice(name string) bool {
+	data, err := os.ReadFile(filepath.Join("/sys/class/input", name, "device", "capabilities", "ev"))
+	if err != nil {
+		return false
+	}
+	caps, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 64)
+	if err != nil {
+		return false
+	}
+	return caps&(1<<evKey) != 0 || caps&(1<<evRel) != 0
+}
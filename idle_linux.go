@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// linuxIdleBackend is one way of measuring idle time on Linux
+type linuxIdleBackend interface {
+	Name() string
+	IdleTime() (time.Duration, error)
+}
+
+var (
+	linuxIdleMu       sync.Mutex
+	linuxIdleAll      []linuxIdleBackend // Created once, so reselecting reuses connections and device watchers
+	linuxIdleSelected linuxIdleBackend
+)
+
+// linuxIdleBackends returns the backends to try, best first. X11 only sees
+// X clients under Wayland, so the compositor's D-Bus APIs go first there.
+func linuxIdleBackends() []linuxIdleBackend {
+	x11 := &x11IdleBackend{}
+	dbusBackends := []linuxIdleBackend{mutterIdleBackend{}, screenSaverIdleBackend{}}
+	evdev := &evdevIdleBackend{}
+
+	if os.Getenv("WAYLAND_DISPLAY") != "" || strings.EqualFold(os.Getenv("XDG_SESSION_TYPE"), "wayland") {
+		return append(append(dbusBackends, x11), evdev)
+	}
+	return append(append([]linuxIdleBackend{x11}, dbusBackends...), evdev)
+}
+
+// getSystemIdleTimeLinux returns the idle time from the first working backend.
+// The backend is chosen on first use and re-chosen if it stops working.
+func getSystemIdleTimeLinux() (time.Duration, error) {
+	linuxIdleMu.Lock()
+	defer linuxIdleMu.Unlock()
+
+	if linuxIdleSelected != nil {
+		idle, err := linuxIdleSelected.IdleTime()
+		if err == nil {
+			return idle, nil
+		}
+		logActivity(fmt.Sprintf("Idle detection: %s stopped working: %v", linuxIdleSelected.Name(), err))
+		linuxIdleSelected = nil
+	}
+
+	if linuxIdleAll == nil {
+		linuxIdleAll = linuxIdleBackends()
+	}
+	var failures []string
+	for _, backend := range linuxIdleAll {
+		idle, err := backend.IdleTime()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", backend.Name(), err))
+			continue
+		}
+		linuxIdleSelected = backend
+		logActivity(fmt.Sprintf("Idle detection: using %s backend", backend.Name()))
+		return idle, nil
+	}
+
+	return 0, fmt.Errorf("no idle detection backend available (%s)", strings.Join(failures, "; "))
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "time"
+
+// getSystemIdleTimeLinux is a stub implementation for non-Linux platforms
+func getSystemIdleTimeLinux() (time.Duration, error) {
+	return time.Duration(0), nil
+}
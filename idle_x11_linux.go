@@ -0,0 +1,297 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// x11IdleBackend reads idle time from the X server's MIT-SCREEN-SAVER
+// extension using a minimal pure-Go implementation of the X11 protocol.
+// It speaks just enough of the protocol to run ScreenSaverQueryInfo.
+type x11IdleBackend struct {
+	mu        sync.Mutex
+	conn      net.Conn
+	root      uint32
+	extOpcode byte
+}
+
+func (b *x11IdleBackend) Name() string {
+	return "X11 screensaver extension"
+}
+
+// IdleTime queries the server for the time since the last user input
+func (b *x11IdleBackend) IdleTime() (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		if err := b.connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	idle, err := b.queryInfo()
+	if err != nil {
+		// Drop the connection so the next call reconnects
+		b.conn.Close()
+		b.conn = nil
+		return 0, err
+	}
+	return idle, nil
+}
+
+// connect opens the display, authenticates and looks up the extension
+func (b *x11IdleBackend) connect() error {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return errors.New("DISPLAY is not set")
+	}
+
+	host, number, err := parseX11Display(display)
+	if err != nil {
+		return err
+	}
+
+	conn, err := dialX11(host, number)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	authName, authData := readXauthority(host, number)
+	root, err := x11Setup(conn, authName, authData)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	opcode, err := x11QueryExtension(conn, "MIT-SCREEN-SAVER")
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	b.conn = conn
+	b.root = root
+	b.extOpcode = opcode
+	return nil
+}
+
+// queryInfo sends ScreenSaverQueryInfo for the root window
+func (b *x11IdleBackend) queryInfo() (time.Duration, error) {
+	b.conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	req := make([]byte, 8)
+	req[0] = b.extOpcode
+	req[1] = 1 // X_ScreenSaverQueryInfo
+	binary.LittleEndian.PutUint16(req[2:], 2)
+	binary.LittleEndian.PutUint32(req[4:], b.root)
+	if _, err := b.conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	reply, err := x11ReadReply(b.conn)
+	if err != nil {
+		return 0, err
+	}
+
+	msSinceInput := binary.LittleEndian.Uint32(reply[16:20])
+	return time.Duration(msSinceInput) * time.Millisecond, nil
+}
+
+// parseX11Display splits a DISPLAY value like ":0", "unix:1.0" or "host:10"
+func parseX11Display(display string) (string, int, error) {
+	colon := strings.LastIndex(display, ":")
+	if colon < 0 {
+		return "", 0, fmt.Errorf("invalid DISPLAY %q", display)
+	}
+
+	host := display[:colon]
+	numberStr := display[colon+1:]
+	if dot := strings.Index(numberStr, "."); dot >= 0 {
+		numberStr = numberStr[:dot]
+	}
+
+	number, err := strconv.Atoi(numberStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid DISPLAY %q", display)
+	}
+	return host, number, nil
+}
+
+// dialX11 connects to a local display socket or a remote TCP display
+func dialX11(host string, number int) (net.Conn, error) {
+	if host == "" || host == "unix" {
+		socket := fmt.Sprintf("/tmp/.X11-unix/X%d", number)
+		if conn, err := net.DialTimeout("unix", socket, 2*time.Second); err == nil {
+			return conn, nil
+		}
+		// Some servers only listen on the abstract socket
+		return net.DialTimeout("unix", "@"+socket, 2*time.Second)
+	}
+	return net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(6000+number)), 2*time.Second)
+}
+
+// readXauthority finds the MIT-MAGIC-COOKIE-1 entry for a display
+func readXauthority(host string, number int) (string, []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(homeDir, ".Xauthority")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil
+	}
+
+	if host == "" || host == "unix" {
+		host, _ = os.Hostname()
+	}
+	displayNumber := strconv.Itoa(number)
+
+	r := bytes.NewReader(data)
+	readField := func() ([]byte, error) {
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		field := make([]byte, length)
+		_, err := io.ReadFull(r, field)
+		return field, err
+	}
+
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			return "", nil
+		}
+		address, err1 := readField()
+		display, err2 := readField()
+		name, err3 := readField()
+		cookie, err4 := readField()
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return "", nil
+		}
+
+		// 256 is FamilyLocal, 65535 matches any address
+		hostMatches := family == 65535 || (family == 256 && string(address) == host)
+		displayMatches := len(display) == 0 || string(display) == displayNumber
+		if hostMatches && displayMatches && string(name) == "MIT-MAGIC-COOKIE-1" {
+			return string(name), cookie
+		}
+	}
+}
+
+// x11Setup performs the connection handshake and returns the first root window
+func x11Setup(conn net.Conn, authName string, authData []byte) (uint32, error) {
+	req := make([]byte, 12)
+	req[0] = 'l' // Little-endian byte order
+	binary.LittleEndian.PutUint16(req[2:], 11)
+	binary.LittleEndian.PutUint16(req[4:], 0)
+	binary.LittleEndian.PutUint16(req[6:], uint16(len(authName)))
+	binary.LittleEndian.PutUint16(req[8:], uint16(len(authData)))
+	req = append(req, x11Pad([]byte(authName))...)
+	req = append(req, x11Pad(authData)...)
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, err
+	}
+	body := make([]byte, int(binary.LittleEndian.Uint16(header[6:]))*4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, err
+	}
+
+	if header[0] != 1 {
+		reason := body
+		if header[0] == 0 && int(header[1]) <= len(body) {
+			reason = body[:header[1]]
+		}
+		return 0, fmt.Errorf("X server refused connection: %s", strings.TrimSpace(string(reason)))
+	}
+
+	// Skip the fixed setup fields, vendor string and pixmap formats
+	if len(body) < 32 {
+		return 0, errors.New("short X11 setup reply")
+	}
+	vendorLen := int(binary.LittleEndian.Uint16(body[16:]))
+	numFormats := int(body[21])
+	offset := 32 + (vendorLen+3)&^3 + numFormats*8
+	if len(body) < offset+4 {
+		return 0, errors.New("X11 setup reply has no screens")
+	}
+
+	return binary.LittleEndian.Uint32(body[offset:]), nil
+}
+
+// x11QueryExtension returns the major opcode of a server extension
+func x11QueryExtension(conn net.Conn, name string) (byte, error) {
+	padded := x11Pad([]byte(name))
+	req := make([]byte, 8, 8+len(padded))
+	req[0] = 98 // QueryExtension
+	binary.LittleEndian.PutUint16(req[2:], uint16(2+len(padded)/4))
+	binary.LittleEndian.PutUint16(req[4:], uint16(len(name)))
+	req = append(req, padded...)
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	reply, err := x11ReadReply(conn)
+	if err != nil {
+		return 0, err
+	}
+	if reply[8] == 0 {
+		return 0, fmt.Errorf("X server does not support %s", name)
+	}
+	return reply[9], nil
+}
+
+// x11ReadReply reads one reply, returning an error for X protocol errors
+func x11ReadReply(conn net.Conn) ([]byte, error) {
+	reply := make([]byte, 32)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+
+	switch reply[0] {
+	case 0:
+		return nil, fmt.Errorf("X protocol error %d", reply[1])
+	case 1:
+		// Discard any data beyond the fixed 32 bytes
+		if extra := binary.LittleEndian.Uint32(reply[4:]); extra > 0 {
+			if _, err := io.CopyN(io.Discard, conn, int64(extra)*4); err != nil {
+				return nil, err
+			}
+		}
+		return reply, nil
+	default:
+		return nil, fmt.Errorf("unexpected X event %d", reply[0])
+	}
+}
+
+// x11Pad pads data with zeros to a multiple of four bytes
+func x11Pad(data []byte) []byte {
+	padded := make([]byte, (len(data)+3)&^3)
+	copy(padded, data)
+	return padded
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// How long the new version must run before it reports itself healthy, and
+// how long the helper waits for that before rolling back
+var (
+	updateHealthyAfter  = 5 * time.Second
+	updateHealthTimeout = 60 * time.Second
+)
+
+// How long the helper waits for the old version to exit
+const updateExitTimeout = 2 * time.Minute
+
+// PendingUpdate records an installed update until the new version has shown
+// that it starts. The helper process and both versions share it through
+// the file at getPendingUpdatePath.
+type PendingUpdate struct {
+	Version     string    `json:"version"`
+	Previous    string    `json:"previous_version"`
+	Executable  string    `json:"executable"`
+	Backup      string    `json:"backup"`           // Copy of the previous version, which runs the helper
+	Staged      string    `json:"staged,omitempty"` // New version waiting to be swapped in by the helper
+	Args        []string  `json:"args,omitempty"`   // Arguments to relaunch with
+	InstalledAt time.Time `json:"installed_at"`
+	Healthy     bool      `json:"healthy,omitempty"`
+	RolledBack  string    `json:"rolled_back,omitempty"` // Why the update was undone
+}
+
+// updateHelperPipe is inherited by the helper as its stdin. It closes when
+// this process exits, which is how the helper knows it may continue.
+var updateHelperPipe *os.File
+
+// getPendingUpdatePath returns the path of the pending update record
+func getPendingUpdatePath() string {
+	return filepath.Join(getUpdateCacheDir(), "pending.json")
+}
+
+// loadPendingUpdate reads the pending update record at path
+func loadPendingUpdate(path string) (*PendingUpdate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pending PendingUpdate
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return &pending, nil
+}
+
+// savePendingUpdate writes pending to path
+func savePendingUpdate(path string, pending *PendingUpdate) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path, data)
+}
+
+// startUpdateInstall replaces the running executable, or the AppImage it
+// runs from, with the verified update at updatePath and starts the helper
+// that relaunches it once this process exits. The previous version is kept
+// next to the executable as ".old" to roll back to. The caller should quit
+// soon after.
+func startUpdateInstall(updatePath, version string) error {
+	exe, err := updateTarget()
+	if err != nil {
+		return err
+	}
+
+	pending := &PendingUpdate{
+		Version:     version,
+		Previous:    Version,
+		Executable:  exe,
+		Backup:      exe + ".old",
+		Args:        relaunchArgs(os.Args[1:]),
+		InstalledAt: time.Now(),
+	}
+	if err := copyExecutable(exe, pending.Backup); err != nil {
+		return fmt.Errorf("could not back up %s: %v", exe, err)
+	}
+	// Stage in the same directory so the swap is a rename
+	staged := exe + ".new"
+	if err := copyExecutable(updatePath, staged); err != nil {
+		return fmt.Errorf("could not stage the update next to %s: %v", exe, err)
+	}
+	if runtime.GOOS == "windows" {
+		// Windows does not let a running executable be replaced, so the
+		// helper swaps it in after this process exits
+		pending.Staged = staged
+	}
+
+	pendingPath := getPendingUpdatePath()
+	if err := savePendingUpdate(pendingPath, pending); err != nil {
+		os.Remove(staged)
+		return err
+	}
+	helper, err := startUpdateHelper(pending.Backup, pendingPath)
+	if err != nil {
+		os.Remove(staged)
+		os.Remove(pendingPath)
+		return fmt.Errorf("could not start the update helper: %v", err)
+	}
+
+	if pending.Staged == "" {
+		// Replacing the file leaves this process running the old one
+		if err := os.Rename(staged, exe); err != nil {
+			helper.Kill()
+			os.Remove(staged)
+			os.Remove(pendingPath)
+			return fmt.Errorf("could not replace %s: %v", exe, err)
+		}
+	}
+
+	logActivity(fmt.Sprintf("Update %s installed to %s, restarting", version, exe))
+	return nil
+}
+
+// installVerifiedUpdate installs the verified download at path, extracting
+// the executable from an archive first. The caller should quit soon after.
+func installVerifiedUpdate(path string, info *UpdateInfo) error {
+	binaryPath, err := extractUpdateBinary(path, info.Package)
+	if err != nil {
+		return err
+	}
+	return startUpdateInstall(binaryPath, info.Version)
+}
+
+// startUpdateHelper runs the helper from the backup of this version, which
+// stays usable whatever happens to the executable
+func startUpdateHelper(helper, pendingPath string) (*os.Process, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	cmd := exec.Command(helper, "--finish-update", pendingPath)
+	cmd.Stdin = reader
+	if err := cmd.Start(); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	updateHelperPipe = writer
+	return cmd.Process, nil
+}
+
+// relaunchArgs returns the arguments to start the new version with, which
+// always include --upgrade so it migrates the config
+func relaunchArgs(args []string) []string {
+	var relaunch []string
+	for _, arg := range args {
+		if arg == "--upgrade" || arg == "-upgrade" {
+			continue
+		}
+		relaunch = append(relaunch, arg)
+	}
+	return relaunch
+}
+
+// runFinishUpdate is the helper's entry point. It waits for the previous
+// version to exit, then finishes the update recorded at pendingPath.
+func runFinishUpdate(pendingPath string) error {
+	exited := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(updateExitTimeout):
+		return errors.New("the previous version did not exit")
+	}
+	return finishUpdate(pendingPath)
+}
+
+// finishUpdate swaps in a staged update if needed, starts the new version
+// with --upgrade and waits for it to report itself healthy. If it exits or
+// stays silent for updateHealthTimeout, the previous version is restored
+// and started instead.
+func finishUpdate(pendingPath string) error {
+	pending, err := loadPendingUpdate(pendingPath)
+	if err != nil {
+		return err
+	}
+
+	if pending.Staged != "" {
+		if err := replaceExecutable(pending.Staged, pending.Executable); err != nil {
+			return rollbackUpdate(pendingPath, pending, fmt.Sprintf("could not replace %s: %v", pending.Executable, err))
+		}
+		pending.Staged = ""
+		if err := savePendingUpdate(pendingPath, pending); err != nil {
+			return rollbackUpdate(pendingPath, pending, err.Error())
+		}
+	}
+
+	logActivity(fmt.Sprintf("Starting %s %s after update", pending.Executable, pending.Version))
+	cmd := exec.Command(pending.Executable, append(pending.Args, "--upgrade")...)
+	if err := cmd.Start(); err != nil {
+		return rollbackUpdate(pendingPath, pending, fmt.Sprintf("version %s could not start: %v", pending.Version, err))
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	healthy := func() bool {
+		current, err := loadPendingUpdate(pendingPath)
+		return err == nil && current.Healthy
+	}
+	succeed := func() error {
+		logActivity(fmt.Sprintf("Update from %s to %s completed", pending.Previous, pending.Version))
+		os.Remove(pendingPath)
+		return nil
+	}
+
+	deadline := time.After(updateHealthTimeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			// Quitting after reporting healthy is not a failure
+			if healthy() {
+				return succeed()
+			}
+			reason := fmt.Sprintf("version %s exited during its health check", pending.Version)
+			if err != nil {
+				reason += fmt.Sprintf(" (%v)", err)
+			}
+			return rollbackUpdate(pendingPath, pending, reason)
+
+		case <-deadline:
+			cmd.Process.Kill()
+			<-exited
+			return rollbackUpdate(pendingPath, pending, fmt.Sprintf("version %s did not start within %s", pending.Version, updateHealthTimeout))
+
+		case <-ticker.C:
+			if healthy() {
+				return succeed()
+			}
+		}
+	}
+}
+
+// rollbackUpdate restores the previous version, records why and starts it
+func rollbackUpdate(pendingPath string, pending *PendingUpdate, reason string) error {
+	logActivity(fmt.Sprintf("Rolling back update to %s: %s", pending.Version, reason))
+	if pending.Staged != "" {
+		os.Remove(pending.Staged)
+		pending.Staged = ""
+	}
+	if err := replaceExecutable(pending.Backup, pending.Executable); err != nil {
+		return fmt.Errorf("%s; restoring %s also failed: %v", reason, pending.Backup, err)
+	}
+
+	pending.RolledBack = reason
+	if err := savePendingUpdate(pendingPath, pending); err != nil {
+		logActivity(fmt.Sprintf("Error recording rolled back update: %v", err))
+	}
+	if err := exec.Command(pending.Executable, pending.Args...).Start(); err != nil {
+		logActivity(fmt.Sprintf("Error restarting %s: %v", pending.Previous, err))
+	}
+	return errors.New(reason)
+}
+
+// confirmUpdateWhenHealthy tells the helper that this version works once
+// it has run for updateHealthyAfter. It does nothing unless this version
+// was just installed.
+func confirmUpdateWhenHealthy() {
+	path := getPendingUpdatePath()
+	pending, err := loadPendingUpdate(path)
+	if err != nil || pending.Version != Version || pending.Healthy || pending.RolledBack != "" {
+		return
+	}
+	time.AfterFunc(updateHealthyAfter, func() {
+		pending.Healthy = true
+		if err := savePendingUpdate(path, pending); err != nil {
+			logActivity(fmt.Sprintf("Error confirming update: %v", err))
+			return
+		}
+		logActivity(fmt.Sprintf("Update to %s passed its health check", Version))
+	})
+}
+
+// takeRolledBackUpdate returns why the last update was rolled back, once,
+// or "" if it was not
+func takeRolledBackUpdate() string {
+	path := getPendingUpdatePath()
+	pending, err := loadPendingUpdate(path)
+	if err != nil || pending.RolledBack == "" || pending.Version == Version {
+		return ""
+	}
+	os.Remove(path)
+	return fmt.Sprintf("The update to version %s was undone because %s.", pending.Version, pending.RolledBack)
+}
+
+// replaceExecutable atomically replaces dst with a copy of src, retrying
+// while dst is still locked by an exiting process on Windows
+func replaceExecutable(src, dst string) error {
+	staged := dst + ".new"
+	if src != staged {
+		if err := copyExecutable(src, staged); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt < 20; attempt++ {
+		if err = os.Rename(staged, dst); err == nil {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	os.Remove(staged)
+	return err
+}
+
+// copyExecutable copies src to dst and makes it executable
+func copyExecutable(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// An existing file keeps its mode through O_CREATE
+	return os.Chmod(dst, 0755)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestExecutable writes a shell script standing in for a version of
+// the app
+func writeTestExecutable(t *testing.T, path, script string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setUpTestUpdate installs a new version that runs script and returns the
+// pending update record's path
+func setUpTestUpdate(t *testing.T, script string) (string, *PendingUpdate) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts as executables")
+	}
+	healthTimeout := updateHealthTimeout
+	updateHealthTimeout = 2 * time.Second
+	t.Cleanup(func() { updateHealthTimeout = healthTimeout })
+
+	dir := t.TempDir()
+	pending := &PendingUpdate{
+		Version:    "9.0.0",
+		Previous:   "1.0.0",
+		Executable: filepath.Join(dir, "attendance-tracker"),
+		Backup:     filepath.Join(dir, "attendance-tracker.old"),
+		Staged:     filepath.Join(dir, "attendance-tracker.new"),
+	}
+	writeTestExecutable(t, pending.Executable, "# 1.0.0")
+	writeTestExecutable(t, pending.Backup, "# 1.0.0")
+	writeTestExecutable(t, pending.Staged, "# 9.0.0\n"+script)
+
+	path := filepath.Join(dir, "pending.json")
+	if err := savePendingUpdate(path, pending); err != nil {
+		t.Fatal(err)
+	}
+	return path, pending
+}
+
+func TestFinishUpdateSucceeds(t *testing.T) {
+	path, pending := setUpTestUpdate(t, "sleep 1")
+
+	// The new version reports itself healthy
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		current, err := loadPendingUpdate(path)
+		if err == nil {
+			current.Healthy = true
+			savePendingUpdate(path, current)
+		}
+	}()
+
+	if err := finishUpdate(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(pending.Executable)
+	if !strings.Contains(string(data), "# 9.0.0") {
+		t.Errorf("executable was not replaced by the new version")
+	}
+	if fileExists(path) || fileExists(pending.Staged) {
+		t.Errorf("pending record or staged file left behind")
+	}
+}
+
+func TestFinishUpdateRollsBack(t *testing.T) {
+	cases := map[string]string{
+		"crash":  "exit 1",
+		"silent": "sleep 30",
+	}
+	for name, script := range cases {
+		path, pending := setUpTestUpdate(t, script)
+
+		err := finishUpdate(path)
+		if err == nil {
+			t.Fatalf("%s: unhealthy update was kept", name)
+		}
+		data, _ := os.ReadFile(pending.Executable)
+		if strings.Contains(string(data), "# 9.0.0") {
+			t.Errorf("%s: previous version was not restored", name)
+		}
+		current, loadErr := loadPendingUpdate(path)
+		if loadErr != nil || current.RolledBack != err.Error() {
+			t.Errorf("%s: rollback not recorded (%v)", name, loadErr)
+		}
+	}
+}
+
+func TestRelaunchArgs(t *testing.T) {
+	got := relaunchArgs([]string{"--minimized", "--upgrade", "--config", "/tmp/config.json"})
+	want := []string{"--minimized", "--config", "/tmp/config.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("relaunchArgs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Exit status of the security tool when no keychain item matches
+const keychainItemNotFound = 44
+
+// platformCredentialStore returns the login keychain
+func platformCredentialStore() CredentialStore {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil
+	}
+	return keychainStore{}
+}
+
+// keychainStore keeps secrets as generic passwords in the user's keychain,
+// using the security command line tool
+type keychainStore struct{}
+
+func (keychainStore) Name() string {
+	return "Keychain"
+}
+
+func (keychainStore) Get(account string) ([]byte, error) {
+	output, err := exec.Command("security", "find-generic-password",
+		"-s", credentialService, "-a", account, "-w").Output()
+	if err != nil {
+		return nil, keychainError(err)
+	}
+	// Secrets are stored base64 encoded, so the tool prints them as text
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+}
+
+func (keychainStore) Set(account string, secret []byte) error {
+	// Commands are passed on stdin so the secret never appears in the
+	// process list; -X takes the password as hex
+	encoded := base64.StdEncoding.EncodeToString(secret)
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -l %q -X %s\n",
+		credentialService, account, "Attendance Tracker", hex.EncodeToString([]byte(encoded))))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not store credentials in the keychain: %v %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (keychainStore) Delete(account string) error {
+	err := exec.Command("security", "delete-generic-password", "-s", credentialService, "-a", account).Run()
+	if err := keychainError(err); err != nil && !errors.Is(err, errCredentialNotFound) {
+		return err
+	}
+	return nil
+}
+
+// keychainError maps the security tool's "not found" status to errCredentialNotFound
+func keychainError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == keychainItemNotFound {
+		return errCredentialNotFound
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// D-Bus names of the freedesktop.org Secret Service, implemented by
+// GNOME Keyring and KWallet
+const (
+	secretServiceName       = "org.freedesktop.secrets"
+	secretServicePath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretDefaultCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	secretServiceInterface  = "org.freedesktop.Secret.Service"
+)
+
+// How long to wait for the user to answer an unlock prompt
+const secretPromptTimeout = 2 * time.Minute
+
+// platformCredentialStore returns the Secret Service if the session has one
+func platformCredentialStore() CredentialStore {
+	store := &secretServiceStore{}
+	session, err := store.openSession()
+	if err != nil {
+		logActivity(fmt.Sprintf("Secret Service unavailable, using encrypted file for credentials: %v", err))
+		return nil
+	}
+	store.closeSession(session)
+	return store
+}
+
+// secretServiceStore keeps secrets in the Secret Service over D-Bus
+type secretServiceStore struct{}
+
+// secretServiceSecret is the Secret struct of the Secret Service API
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+func (s *secretServiceStore) Name() string {
+	return "Secret Service"
+}
+
+func (s *secretServiceStore) Get(account string) ([]byte, error) {
+	session, err := s.openSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.closeSession(session)
+
+	item, err := s.findItem(session.conn, account)
+	if err != nil {
+		return nil, err
+	}
+	if item == "" {
+		return nil, errCredentialNotFound
+	}
+
+	var secret secretServiceSecret
+	err = session.conn.Object(secretServiceName, item).
+		Call("org.freedesktop.Secret.Item.GetSecret", 0, session.path).Store(&secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret.Value, nil
+}
+
+func (s *secretServiceStore) Set(account string, value []byte) error {
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer s.closeSession(session)
+
+	if err := s.unlock(session.conn, []dbus.ObjectPath{secretDefaultCollection}); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant("Attendance Tracker (" + account + ")"),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(secretAttributes(account)),
+	}
+	secret := secretServiceSecret{
+		Session:     session.path,
+		Value:       value,
+		ContentType: "application/octet-stream",
+	}
+
+	var item, prompt dbus.ObjectPath
+	err = session.conn.Object(secretServiceName, secretDefaultCollection).
+		Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, secret, true).Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(session.conn, prompt)
+}
+
+func (s *secretServiceStore) Delete(account string) error {
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer s.closeSession(session)
+
+	item, err := s.findItem(session.conn, account)
+	if err != nil || item == "" {
+		return err
+	}
+
+	var prompt dbus.ObjectPath
+	if err := session.conn.Object(secretServiceName, item).
+		Call("org.freedesktop.Secret.Item.Delete", 0).Store(&prompt); err != nil {
+		return err
+	}
+	return s.prompt(session.conn, prompt)
+}
+
+// secretAttributes returns the lookup attributes of an account's item
+func secretAttributes(account string) map[string]string {
+	return map[string]string{"application": credentialService, "account": account}
+}
+
+// secretSession is an open Secret Service session
+type secretSession struct {
+	conn *dbus.Conn
+	path dbus.ObjectPath
+}
+
+// openSession starts a session using the "plain" algorithm. Secrets only
+// travel over the private session bus, as with other Secret Service clients.
+func (s *secretServiceStore) openSession() (*secretSession, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+
+	var output dbus.Variant
+	var path dbus.ObjectPath
+	err = conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &path)
+	if err != nil {
+		return nil, err
+	}
+	return &secretSession{conn: conn, path: path}, nil
+}
+
+func (s *secretServiceStore) closeSession(session *secretSession) {
+	session.conn.Object(secretServiceName, session.path).Call("org.freedesktop.Secret.Session.Close", 0)
+}
+
+// findItem returns the item for account, unlocking it if needed, or "" if there is none
+func (s *secretServiceStore) findItem(conn *dbus.Conn, account string) (dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".SearchItems", 0, secretAttributes(account)).Store(&unlocked, &locked)
+	if err != nil {
+		return "", err
+	}
+	if len(unlocked) > 0 {
+		return unlocked[0], nil
+	}
+	if len(locked) > 0 {
+		if err := s.unlock(conn, locked[:1]); err != nil {
+			return "", err
+		}
+		return locked[0], nil
+	}
+	return "", nil
+}
+
+// unlock unlocks objects, prompting the user if the keyring asks to
+func (s *secretServiceStore) unlock(conn *dbus.Conn, objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".Unlock", 0, objects).Store(&unlocked, &prompt)
+	if err != nil {
+		return err
+	}
+	return s.prompt(conn, prompt)
+}
+
+// prompt shows a Secret Service prompt and waits for the user to complete it.
+// The path "/" means no prompt is needed.
+func (s *secretServiceStore) prompt(conn *dbus.Conn, prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == "/" {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface("org.freedesktop.Secret.Prompt"),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	if err := conn.Object(secretServiceName, prompt).Call("org.freedesktop.Secret.Prompt.Prompt", 0, "").Err; err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(secretPromptTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != "org.freedesktop.Secret.Prompt.Completed" {
+				continue
+			}
+			if len(signal.Body) > 0 {
+				if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+					return errors.New("the keyring was not unlocked")
+				}
+			}
+			return nil
+		case <-timeout.C:
+			return errors.New("timed out waiting for the keyring to be unlocked")
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package main
+
+// platformCredentialStore returns nil, as there is no supported OS keyring;
+// credentials are kept in the encrypted file
+func platformCredentialStore() CredentialStore {
+	return nil
+}
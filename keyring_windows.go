@@ -0,0 +1,125 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32        = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+// Credential Manager constants from wincred.h
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// winCredential mirrors the CREDENTIALW structure
+type winCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// platformCredentialStore returns the Windows Credential Manager
+func platformCredentialStore() CredentialStore {
+	if err := procCredReadW.Find(); err != nil {
+		return nil
+	}
+	return wincredStore{}
+}
+
+// wincredStore keeps secrets as generic credentials in the Credential Manager
+type wincredStore struct{}
+
+func (wincredStore) Name() string {
+	return "Credential Manager"
+}
+
+// target returns the Credential Manager name for account
+func (wincredStore) target(account string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(credentialService + ":" + account)
+}
+
+func (s wincredStore) Get(account string) ([]byte, error) {
+	target, err := s.target(account)
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *winCredential
+	ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 {
+		if err == errorNotFound {
+			return nil, errCredentialNotFound
+		}
+		return nil, fmt.Errorf("CredReadW: %v", err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	secret := make([]byte, cred.CredentialBlobSize)
+	if cred.CredentialBlobSize > 0 {
+		copy(secret, unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	}
+	return secret, nil
+}
+
+func (s wincredStore) Set(account string, secret []byte) error {
+	target, err := s.target(account)
+	if err != nil {
+		return err
+	}
+	userName, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+
+	cred := winCredential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(secret)),
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	if len(secret) > 0 {
+		cred.CredentialBlob = &secret[0]
+	}
+
+	ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ret == 0 {
+		return fmt.Errorf("CredWriteW: %v", err)
+	}
+	return nil
+}
+
+func (s wincredStore) Delete(account string) error {
+	target, err := s.target(account)
+	if err != nil {
+		return err
+	}
+
+	ret, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if ret == 0 && err != errorNotFound {
+		return fmt.Errorf("CredDeleteW: %v", err)
+	}
+	return nil
+}
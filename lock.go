@@ -0,0 +1,19 @@
+package main
+
+import "runtime"
+
+// isSessionLocked reports whether the user's desktop session is locked.
+// Platforms without lock detection always report an unlocked session.
+func isSessionLocked() bool {
+	switch runtime.GOOS {
+	case "windows":
+		return isSessionLockedWindows()
+
+	case "linux":
+		// logind tracks the lock state set by the desktop's screen locker
+		return isSessionLockedLinux()
+
+	default:
+		return false
+	}
+}
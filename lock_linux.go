@@ -0,0 +1,58 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// logind's object for the session, looked up once and reused on every tick
+var (
+	loginSessionMu   sync.Mutex
+	loginSessionPath dbus.ObjectPath
+)
+
+// isSessionLockedLinux reports the LockedHint logind keeps for this
+// session, which the desktop's screen locker sets
+func isSessionLockedLinux() bool {
+	sessionID := os.Getenv("XDG_SESSION_ID")
+	if sessionID == "" {
+		return false
+	}
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return false
+	}
+	path, err := loginSession(conn, sessionID)
+	if err != nil {
+		return false
+	}
+
+	hint, err := conn.Object("org.freedesktop.login1", path).GetProperty("org.freedesktop.login1.Session.LockedHint")
+	if err != nil {
+		return false
+	}
+	locked, _ := hint.Value().(bool)
+	return locked
+}
+
+// loginSession returns the object path logind uses for sessionID
+func loginSession(conn *dbus.Conn, sessionID string) (dbus.ObjectPath, error) {
+	loginSessionMu.Lock()
+	defer loginSessionMu.Unlock()
+	if loginSessionPath != "" {
+		return loginSessionPath, nil
+	}
+
+	var path dbus.ObjectPath
+	manager := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	if err := manager.Call("org.freedesktop.login1.Manager.GetSession", 0, sessionID).Store(&path); err != nil {
+		return "", err
+	}
+	loginSessionPath = path
+	return path, nil
+}
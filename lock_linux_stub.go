@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// isSessionLockedLinux is a stub implementation for non-Linux platforms
+func isSessionLockedLinux() bool {
+	return false
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// isSessionLockedWindows is a stub implementation for non-Windows platforms
+func isSessionLockedWindows() bool {
+	return false
+}
@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package main
+
+var (
+	procOpenInputDesktop = user32.NewProc("OpenInputDesktop")
+	procCloseDesktop     = user32.NewProc("CloseDesktop")
+)
+
+// DESKTOP_SWITCHDESKTOP access right for OpenInputDesktop
+const desktopSwitchDesktop = 0x0100
+
+// isSessionLockedWindows reports whether the workstation is locked.
+// The input desktop cannot be opened while the lock screen is shown.
+func isSessionLockedWindows() bool {
+	desktop, _, _ := procOpenInputDesktop.Call(0, 0, desktopSwitchDesktop)
+	if desktop == 0 {
+		return true
+	}
+	procCloseDesktop.Call(desktop)
+	return false
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
@@ -10,13 +11,14 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -36,10 +38,10 @@ var (
 // Default configuration values
 var (
 	defaultServerEndpoint = "https://stale-olivette-rashidpathiyil-d5cc9ac4.koyeb.app/api/v1/events"
-	defaultDeviceID       = getDeviceID()
 	defaultUserID         = getUserID()
 	defaultIdleTimeout    = 20 * time.Minute
 	defaultCheckInterval  = 2 * time.Second
+	defaultUpdateInterval = 24 * time.Hour
 )
 
 // AppConfig stores the application configuration
@@ -54,13 +56,19 @@ type AppConfig struct {
 	ShowIdleTime    bool
 	AutoMode        bool
 	RunAtStartup    bool
+	BindDevice      bool   // Replace the device ID when the config moves to another machine
+	UpdateChannel   string // ChannelStable, ChannelBeta or ChannelNightly
+	PinnedVersion   string // Only offer this version, if set
+	SkippedVersion  string // Never offer this version
+	UpdateMode      string // UpdateModeOff, UpdateModeNotify or UpdateModeAuto
+	UpdateInterval  time.Duration
 }
 
 // Create a new config with default values
 func NewAppConfig() *AppConfig {
 	return &AppConfig{
 		ServerEndpoint:  defaultServerEndpoint,
-		DeviceID:        defaultDeviceID,
+		DeviceID:        defaultDeviceID(),
 		UserID:          defaultUserID,
 		IdleTimeout:     defaultIdleTimeout,
 		CheckInterval:   defaultCheckInterval,
@@ -69,6 +77,10 @@ func NewAppConfig() *AppConfig {
 		ShowIdleTime:    true,
 		AutoMode:        true,
 		RunAtStartup:    true,
+		BindDevice:      false,
+		UpdateChannel:   ChannelStable,
+		UpdateMode:      UpdateModeNotify,
+		UpdateInterval:  defaultUpdateInterval,
 	}
 }
 
@@ -78,6 +90,7 @@ type StatusPayload struct {
 	UserID    string         `json:"user_id"`
 	Payload   PayloadContent `json:"payload"`
 	Timestamp *time.Time     `json:"timestamp,omitempty"` // Optional timestamp
+	Chain     *ChainHead     `json:"chain,omitempty"`     // Local history head after this event
 }
 
 // PayloadContent is the nested data structure in the payload
@@ -85,18 +98,13 @@ type PayloadContent struct {
 	Time     string                 `json:"time"` // HH:MM:SS format
 	Date     string                 `json:"date"` // YYYY-MM-DD format
 	DeviceID string                 `json:"device_id"`
+	Source   string                 `json:"source,omitempty"` // "manual" or "auto"
+	Activity *ActivitySummary       `json:"activity,omitempty"`
 	Config   map[string]interface{} `json:"config,omitempty"`
-}
 
-// SystemActivityMonitor detects user activity at the OS level
-type SystemActivityMonitor struct {
-	lastActivity time.Time
-}
-
-func NewSystemActivityMonitor() *SystemActivityMonitor {
-	return &SystemActivityMonitor{
-		lastActivity: time.Now(),
-	}
+	// Set for device_changed events
+	PreviousDeviceID string `json:"previous_device_id,omitempty"`
+	Reason           string `json:"reason,omitempty"`
 }
 
 // getSystemIdleTime returns how long the system has been idle
@@ -130,64 +138,17 @@ func getSystemIdleTime() (time.Duration, error) {
 		return getSystemIdleTimeWindows()
 
 	case "linux":
-		// Linux implementation
-		cmd := exec.Command("sh", "-c", "xprintidle")
-		output, err := cmd.Output()
-		if err != nil {
-			return 0, err
-		}
-
-		idleTimeStr := strings.TrimSpace(string(output))
-		idleTime, err := strconv.ParseUint(idleTimeStr, 10, 64)
-		if err != nil {
-			return 0, err
-		}
-
-		return time.Duration(idleTime) * time.Millisecond, nil
+		// Native X11, D-Bus and /dev/input backends
+		return getSystemIdleTimeLinux()
 
 	default:
 		return 0, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
 }
 
-// Check returns true if there has been activity since the last check
-func (m *SystemActivityMonitor) Check() bool {
-	idleTime, err := getSystemIdleTime()
-	if err != nil {
-		fmt.Printf("Error getting system idle time: %v\n", err)
-		return false
-	}
-
-	// If system idle time is less than our check interval,
-	// there's been activity since our last check
-	if idleTime < defaultCheckInterval {
-		m.lastActivity = time.Now()
-		return true
-	}
-
-	return false
-}
-
-// IdleTime returns how long it's been since the last activity
-func (m *SystemActivityMonitor) IdleTime() time.Duration {
-	// Get system idle time
-	sysIdleTime, err := getSystemIdleTime()
-	if err == nil {
-		// If we can get system idle time, use that
-		return sysIdleTime
-	}
-
-	// Fall back to our own tracking
-	return time.Since(m.lastActivity)
-}
-
-// UpdateLastActivity updates the last activity timestamp
-func (m *SystemActivityMonitor) UpdateLastActivity() {
-	m.lastActivity = time.Now()
-}
-
-// getDeviceID generates a unique identifier for the current device
-func getDeviceID() string {
+// legacyDeviceID derives an identifier from the host name, as older versions
+// did. It is only used when the device identity file cannot be written.
+func legacyDeviceID() string {
 	// Try to get the hostname first
 	hostname, err := os.Hostname()
 	if err == nil && hostname != "" {
@@ -405,203 +366,240 @@ Categories=Utility;
 	}
 }
 
-// Save configuration to a JSON file
-func saveConfig(config *AppConfig) error {
-	// Create config directory if needed
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		return err
-	}
-
-	appDir := filepath.Join(configDir, "attendance-tracker")
-	if err := os.MkdirAll(appDir, 0755); err != nil {
-		return err
-	}
+// Package-level variables for application settings
+var (
+	developerMode bool
+	upgradeMode   bool
+	logToStdout   bool
+)
 
-	// Convert config to JSON
-	configMap := map[string]interface{}{
-		"server_endpoint":     config.ServerEndpoint,
-		"device_id":           config.DeviceID,
-		"user_id":             config.UserID,
-		"idle_timeout_mins":   int(config.IdleTimeout.Minutes()),
-		"check_interval_secs": int(config.CheckInterval.Seconds()),
-		"developer_mode":      config.DeveloperMode,
-		"show_activity_log":   config.ShowActivityLog,
-		"show_idle_time":      config.ShowIdleTime,
-		"auto_mode":           config.AutoMode,
-		"run_at_startup":      config.RunAtStartup,
-	}
+// Reset developer settings when running in normal mode
+func resetDeveloperSettings() {
+	// Reset any developer-specific settings here
+	// This is a placeholder function that can be expanded as needed
+	fmt.Println("Resetting developer settings to defaults")
+}
 
-	jsonData, err := json.MarshalIndent(configMap, "", "  ")
-	if err != nil {
-		return err
-	}
+// Icon for the application
+var resourceAppIconPng = fyne.NewStaticResource("appIcon", nil)
 
-	// Write to config file
-	configFile := filepath.Join(appDir, "config.json")
-	return os.WriteFile(configFile, jsonData, 0644)
-}
+// Create the status tab showing current status
+func createStatusTab(w fyne.Window, tracker *Tracker) *fyne.Container {
+	stateLabel := widget.NewLabel("")
+	sinceLabel := widget.NewLabel("")
+	workedLabel := widget.NewLabel("")
+	idleLabel := widget.NewLabel("")
+	activityLabel := widget.NewLabel("")
+	logLabel := widget.NewLabel("")
+	logLabel.TextStyle = fyne.TextStyle{Monospace: true}
+
+	var toggleButton, breakButton *widget.Button
+
+	// Refresh all labels and buttons from the current state
+	refresh := func() {
+		now := time.Now()
+		state, since := tracker.State.State()
+
+		stateLabel.SetText(fmt.Sprintf("Status: %s", describeState(state)))
+		sinceLabel.SetText(fmt.Sprintf("Since %s (%s ago)", since.Format("15:04:05"), formatDuration(now.Sub(since))))
+		workedLabel.SetText(fmt.Sprintf("Worked today: %s", formatDuration(tracker.State.WorkedToday(now))))
+		idleLabel.SetText(fmt.Sprintf("Idle time: %s", formatDuration(tracker.State.IdleTime())))
+		activityLabel.SetText(describeActivityStats(tracker.Monitor.Stats(activityStatsWindow)))
+
+		if tracker.CurrentConfig().ShowIdleTime {
+			idleLabel.Show()
+		} else {
+			idleLabel.Hide()
+		}
 
-// Load configuration from JSON file
-func loadConfig() (*AppConfig, error) {
-	// Create default config
-	config := NewAppConfig()
+		if tracker.CurrentConfig().ShowActivityLog {
+			logLabel.SetText(strings.Join(getRecentActivity(), "\n"))
+			logLabel.Show()
+		} else {
+			logLabel.Hide()
+		}
 
-	// Get config file path
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		return config, err
+		switch state {
+		case StateCheckedIn:
+			toggleButton.SetText("Check Out")
+			breakButton.SetText("Take a Break")
+			breakButton.Enable()
+		case StateOnBreak:
+			toggleButton.SetText("Check Out")
+			breakButton.SetText("Resume")
+			breakButton.Enable()
+		default:
+			toggleButton.SetText("Check In")
+			breakButton.SetText("Take a Break")
+			breakButton.Disable()
+		}
 	}
 
-	configFile := filepath.Join(configDir, "attendance-tracker", "config.json")
+	toggleButton = widget.NewButton("Check In", func() {
+		if err := tracker.Toggle(); err != nil {
+			dialog.ShowError(err, w)
+		}
+		refresh()
+	})
 
-	// Check if config file exists
-	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		// No config file yet, use defaults
-		return config, nil
-	}
+	breakButton = widget.NewButton("Take a Break", func() {
+		var err error
+		if state, _ := tracker.State.State(); state == StateOnBreak {
+			err = tracker.State.EndBreak(time.Now())
+		} else {
+			err = tracker.State.StartBreak(time.Now())
+		}
+		if err != nil {
+			dialog.ShowError(err, w)
+		}
+		refresh()
+	})
 
-	// Read config file
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		return config, err
-	}
+	// Show the outcome of the last delivery to the server
+	serverLabel := widget.NewLabel(describeEventResult(tracker.Sender.LastResult()))
+	serverLabel.Wrapping = fyne.TextWrapWord
+	tracker.Sender.OnResult(func(result EventResult) {
+		serverLabel.SetText(describeEventResult(&result))
+	})
 
-	// Parse JSON
-	var configMap map[string]interface{}
-	if err := json.Unmarshal(data, &configMap); err != nil {
-		return config, err
-	}
+	// Show how many events are still waiting for delivery
+	queueLabel := widget.NewLabel(describeOutboxStats(tracker.Outbox.Stats()))
+	tracker.Outbox.OnChange(func(stats OutboxStats) {
+		queueLabel.SetText(describeOutboxStats(stats))
+	})
 
-	// Update config with values from file
-	if server, ok := configMap["server_endpoint"].(string); ok {
-		config.ServerEndpoint = server
-	}
-	if deviceID, ok := configMap["device_id"].(string); ok {
-		config.DeviceID = deviceID
-	}
-	if userID, ok := configMap["user_id"].(string); ok {
-		config.UserID = userID
-	}
-	if idleTimeout, ok := configMap["idle_timeout_mins"].(float64); ok {
-		config.IdleTimeout = time.Duration(idleTimeout) * time.Minute
-	}
-	if checkInterval, ok := configMap["check_interval_secs"].(float64); ok {
-		config.CheckInterval = time.Duration(checkInterval) * time.Second
-	}
-	if devMode, ok := configMap["developer_mode"].(bool); ok {
-		config.DeveloperMode = devMode
-	}
-	if showLog, ok := configMap["show_activity_log"].(bool); ok {
-		config.ShowActivityLog = showLog
-	}
-	if showIdle, ok := configMap["show_idle_time"].(bool); ok {
-		config.ShowIdleTime = showIdle
-	}
-	if autoMode, ok := configMap["auto_mode"].(bool); ok {
-		config.AutoMode = autoMode
-	}
-	if runAtStartup, ok := configMap["run_at_startup"].(bool); ok {
-		config.RunAtStartup = runAtStartup
-	}
+	// Keep the timers live and react to automatic transitions
+	refresh()
+	tracker.State.OnTransition(func(Transition) {
+		refresh()
+	})
+	go func() {
+		for range time.Tick(time.Second) {
+			refresh()
+		}
+	}()
 
-	return config, nil
+	return container.NewVBox(
+		stateLabel,
+		sinceLabel,
+		workedLabel,
+		idleLabel,
+		activityLabel,
+		container.NewHBox(toggleButton, breakButton),
+		widget.NewSeparator(),
+		serverLabel,
+		queueLabel,
+		logLabel,
+	)
 }
 
-// migrateFromPreviousVersion handles data migration during upgrades
-func migrateFromPreviousVersion() {
-	fmt.Println("Running upgrade migration...")
-
-	// Load configuration from the previous version
-	config, err := loadConfig()
-	if err != nil {
-		fmt.Printf("Warning: Could not load previous config: %v\n", err)
-	} else {
-		// If needed, update configuration format or defaults
-		// For example, if we added new fields in this version:
-		// config.NewField = defaultValueForNewField
+// Create the history tab showing attendance history
+func createHistoryTab(w fyne.Window, tracker *Tracker) *fyne.Container {
+	// Default to the last seven days
+	today := time.Now()
+	fromEntry := widget.NewEntry()
+	fromEntry.SetText(today.AddDate(0, 0, -6).Format("2006-01-02"))
+	toEntry := widget.NewEntry()
+	toEntry.SetText(today.Format("2006-01-02"))
+
+	summaryLabel := widget.NewLabel("")
+	daysAccordion := widget.NewAccordion()
+
+	showHistory := func() {
+		from, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(fromEntry.Text), time.Local)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid start date, use YYYY-MM-DD"), w)
+			return
+		}
+		to, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(toEntry.Text), time.Local)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid end date, use YYYY-MM-DD"), w)
+			return
+		}
 
-		// Save the updated config
-		if err := saveConfig(config); err != nil {
-			fmt.Printf("Error saving migrated config: %v\n", err)
-		} else {
-			fmt.Println("Successfully migrated configuration")
+		days, err := tracker.History.Days(from, to, time.Now())
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
 		}
-	}
 
-	// If there are other migration tasks, perform them here
-	// For example:
-	// - Update database schema
-	// - Migrate data files to new format
-	// - Update file paths
+		daysAccordion.Items = nil
+		var total time.Duration
+		for _, day := range days {
+			total += day.Worked
 
-	fmt.Println("Migration complete")
-}
+			details := container.NewVBox(widget.NewLabel("Sessions:"))
+			for _, session := range day.Sessions {
+				details.Add(widget.NewLabel("  " + describeInterval(session)))
+			}
+			if len(day.Gaps) > 0 {
+				details.Add(widget.NewLabel("Gaps:"))
+				for _, gap := range day.Gaps {
+					details.Add(widget.NewLabel(fmt.Sprintf("  %s  %s", describeState(gap.State), describeInterval(gap))))
+				}
+			}
 
-// Package-level variables for application settings
-var (
-	developerMode bool
-	upgradeMode   bool
-)
+			title := fmt.Sprintf("%s — worked %s, %d sessions", day.Date, formatDuration(day.Worked), len(day.Sessions))
+			daysAccordion.Append(widget.NewAccordionItem(title, details))
+		}
+		daysAccordion.Refresh()
 
-// Reset developer settings when running in normal mode
-func resetDeveloperSettings() {
-	// Reset any developer-specific settings here
-	// This is a placeholder function that can be expanded as needed
-	fmt.Println("Resetting developer settings to defaults")
-}
+		if len(days) == 0 {
+			summaryLabel.SetText("No records available")
+		} else {
+			summaryLabel.SetText(fmt.Sprintf("%d days, %s worked in total", len(days), formatDuration(total)))
+		}
+	}
 
-// Icon for the application
-var resourceAppIconPng = fyne.NewStaticResource("appIcon", nil)
+	// Keep the history current as new transitions are recorded
+	showHistory()
+	tracker.State.OnTransition(func(Transition) {
+		showHistory()
+	})
 
-// Create the status tab showing current status
-func createStatusTab(w fyne.Window) *fyne.Container {
-	// This is a placeholder implementation
-	return container.NewVBox(
-		widget.NewLabel("Status: Active"),
-		widget.NewButton("Check In/Out", func() {
-			// Toggle check-in status
-		}),
+	filterRow := container.NewHBox(
+		widget.NewLabel("From"), fromEntry,
+		widget.NewLabel("To"), toEntry,
+		widget.NewButton("Show", showHistory),
 	)
-}
 
-// Create the history tab showing attendance history
-func createHistoryTab() *fyne.Container {
-	// This is a placeholder implementation
+	daysScroll := container.NewVScroll(daysAccordion)
+	daysScroll.SetMinSize(fyne.NewSize(0, 250))
+
 	return container.NewVBox(
 		widget.NewLabel("Attendance History"),
-		widget.NewLabel("No records available"),
+		filterRow,
+		summaryLabel,
+		daysScroll,
 	)
 }
 
 // Create the settings tab with configuration options
-func createSettingsTab(a fyne.App) *fyne.Container {
-	// This is a placeholder implementation
-	return container.NewVBox(
-		widget.NewLabel("Settings"),
-		widget.NewCheck("Run at startup", func(value bool) {
-			// Update setting
-		}),
-	)
+func createSettingsTab(w fyne.Window, tracker *Tracker) fyne.CanvasObject {
+	form := newSettingsForm(w, tracker)
+
+	// Pick up changes applied from the settings dialog
+	tracker.OnConfigChange(func(config *AppConfig) {
+		form.load(config)
+	})
+
+	return form.content()
 }
 
 // Show the settings dialog
-func showSettingsDialog(w fyne.Window) {
-	dialog.ShowCustom("Settings", "Close",
-		container.NewVBox(
-			widget.NewLabel("Application Settings"),
-			widget.NewCheck("Developer Mode", func(value bool) {
-				developerMode = value
-			}),
-		), w)
+func showSettingsDialog(w fyne.Window, tracker *Tracker) {
+	settings := dialog.NewCustom("Settings", "Close", newSettingsForm(w, tracker).content(), w)
+	settings.Resize(fyne.NewSize(560, 0))
+	settings.Show()
 }
 
 // Show the about dialog
-func showAboutDialog(w fyne.Window) {
+func showAboutDialog(w fyne.Window, tracker *Tracker) {
 	dialog.ShowCustom("About", "Close",
 		container.NewVBox(
 			widget.NewLabel("Attendance Tracker"),
 			widget.NewLabel(fmt.Sprintf("Version %s", Version)),
+			widget.NewLabel(describeUpdateStatus(loadUpdateStatus(getUpdateStatusPath()), tracker.CurrentConfig().UpdateMode)),
 			widget.NewLabel("© 2023 Rashid Pathiyil"),
 			widget.NewLabel("An attendance tracking application"),
 		), w)
@@ -610,16 +608,54 @@ func showAboutDialog(w fyne.Window) {
 func main() {
 	// Parse command line arguments
 	upgradeFlag := flag.Bool("upgrade", false, "Run in upgrade mode")
+	headlessFlag := flag.Bool("headless", false, "Run without a window as a background service")
+	minimizedFlag := flag.Bool("minimized", false, "Start hidden in the system tray")
+	controlFlag := flag.String("control", "", "Send a command to a running headless tracker (status, check-in, check-out, toggle, break, resume, reset-device-id, quit)")
+	configFlag := flag.String("config", "", "Use this config file instead of the default one")
+	printConfigFlag := flag.Bool("print-config", false, "Print the effective configuration and where each value comes from, then exit")
+	signInFlag := flag.Bool("sign-in", false, "Sign in to the server with a password or enrollment code read from stdin, then exit")
+	signOutFlag := flag.Bool("sign-out", false, "Remove the stored credentials for the server, then exit")
+	verifyHistoryFlag := flag.Bool("verify-history", false, "Check the local attendance history for gaps and edits, then exit")
+	finishUpdateFlag := flag.String("finish-update", "", "Used by the updater to restart into a newly installed version")
+	configFlags := registerConfigFlags(flag.CommandLine)
 	flag.Parse()
 
-	// Enable developer mode by default during development
-	developerMode = true
+	configFilePath = *configFlag
+	configOverrides = readConfigOverrides(configFlags)
 
-	// Initialize the application
-	a := app.New()
+	// Forward the command to the running tracker and exit
+	if *controlFlag != "" {
+		response, err := sendControlCommand(getControlSocketPath(), *controlFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(response)
+		return
+	}
 
-	// Set application metadata
-	a.SetIcon(resourceAppIconPng)
+	// Act as the update helper started by the previous version
+	if *finishUpdateFlag != "" {
+		if err := runFinishUpdate(*finishUpdateFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *verifyHistoryFlag {
+		ok, err := runVerifyHistory(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Enable developer mode by default during development
+	developerMode = true
 
 	// Reset developer mode settings if running in normal mode
 	if !developerMode {
@@ -632,6 +668,67 @@ func main() {
 		migrateFromPreviousVersion()
 	}
 
+	// Load the saved configuration (defaults are returned on error)
+	config, sources, configErr := loadConfigSources()
+	if *printConfigFlag {
+		printConfig(os.Stdout, config, sources)
+		if configErr != nil {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", configErr)
+			os.Exit(1)
+		}
+		return
+	}
+	if configErr != nil {
+		logActivity(fmt.Sprintf("Error loading config: %v", configErr))
+	}
+
+	if *signInFlag || *signOutFlag {
+		if configErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", configErr)
+			os.Exit(1)
+		}
+		var err error
+		if *signInFlag {
+			err = runSignIn(config, os.Stdin, os.Stdout)
+		} else {
+			err = runSignOut(config, os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Run without Fyne when there is no display session
+	if *headlessFlag {
+		// Nobody would notice the defaults standing in for a broken config
+		if configErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", configErr)
+			os.Exit(1)
+		}
+		if err := runHeadless(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Initialize the application
+	a := app.New()
+
+	// Set application metadata
+	a.SetIcon(resourceAppIconPng)
+
+	// Create the tracker that turns activity into attendance events
+	tracker, err := NewTracker(config)
+	if err != nil {
+		fmt.Printf("Error starting tracker: %v\n", err)
+		os.Exit(1)
+	}
+	done := make(chan struct{})
+	tracker.Run(done)
+
 	// Set application title
 	w := a.NewWindow("Attendance Tracker")
 
@@ -640,9 +737,9 @@ func main() {
 
 	// Create tabs
 	tabs := container.NewAppTabs(
-		container.NewTabItem("Status", createStatusTab(w)),
-		container.NewTabItem("History", createHistoryTab()),
-		container.NewTabItem("Settings", createSettingsTab(a)),
+		container.NewTabItem("Status", createStatusTab(w, tracker)),
+		container.NewTabItem("History", createHistoryTab(w, tracker)),
+		container.NewTabItem("Settings", createSettingsTab(w, tracker)),
 	)
 
 	tabs.SetTabLocation(container.TabLocationTop)
@@ -654,35 +751,70 @@ func main() {
 	w.SetContent(content)
 
 	// Create menu with version info
-	mainMenu := createMainMenu(a, w, updateChannel)
+	mainMenu := createMainMenu(a, w, tracker, updateChannel)
 	w.SetMainMenu(mainMenu)
 
 	// Set window size
 	w.Resize(fyne.NewSize(600, 400))
 
-	// Check for updates in background on startup
-	go func() {
-		// Wait a bit to let the UI load completely
-		time.Sleep(5 * time.Second)
-
-		// Check for updates in background
-		updateInfo := getLatestReleaseInfo()
-		if updateInfo != nil && updateInfo.Version != Version {
-			// Send update notification to channel
-			updateChannel <- updateInfo
-			// Show notification
-			showUpdateNotification(w, updateInfo)
+	// Add the tray icon; without a tray there is nowhere to start hidden
+	// and closing the window quits as before
+	tray := setupSystemTray(a, w, tracker)
+	if *minimizedFlag && tray == nil {
+		logActivity("System tray unavailable, showing window instead of starting minimized")
+	}
+
+	// Check for updates on a schedule; dialogs wait until the user is
+	// checked out or idle
+	updates := NewUpdateScheduler(tracker)
+	updates.OnFound = func(updateInfo *UpdateInfo) {
+		// Send update notification to channel
+		updateChannel <- updateInfo
+		if tray != nil {
+			tray.SetUpdateAvailable(updateInfo)
 		}
-	}()
+	}
+	updates.OnPrompt = func(updateInfo *UpdateInfo, updatePath string) {
+		if updatePath != "" {
+			showUpdateReadyNotification(w, updateInfo, updatePath)
+		} else {
+			showUpdateNotification(w, tracker, updateInfo)
+		}
+	}
+	updates.OnInstall = func(updateInfo *UpdateInfo, updatePath string) {
+		if err := installVerifiedUpdate(updatePath, updateInfo); err != nil {
+			logActivity(fmt.Sprintf("Could not install update %s: %v", updateInfo.Version, err))
+			showUpdateNotification(w, tracker, updateInfo)
+			return
+		}
+		fyne.CurrentApp().Quit()
+	}
+	go updates.Run(done)
+
+	// Report to the updater that this version starts, or tell the user
+	// why the last update was undone
+	confirmUpdateWhenHealthy()
+	if message := takeRolledBackUpdate(); message != "" {
+		logActivity(message)
+		dialog.ShowInformation("Update Undone", message, w)
+	}
+
+	// Tell the user their config was not used; saving settings replaces it
+	// and keeps the broken file as a backup
+	if configErr != nil {
+		w.Show()
+		dialog.ShowError(fmt.Errorf("%v\n\nDefault settings are in use until the file is fixed or new settings are saved.", configErr), w)
+	}
 
 	// Show window and run app
-	w.ShowAndRun()
-}
+	if *minimizedFlag && tray != nil {
+		a.Run()
+	} else {
+		w.ShowAndRun()
+	}
 
-// showSettings shows the settings dialog
-func showSettings(a fyne.App, w fyne.Window) {
-	settingsTab := createSettingsTab(a)
-	dialog.ShowCustom("Settings", "Close", settingsTab, w)
+	// Stop background work; undelivered events stay on disk for the next run
+	close(done)
 }
 
 // showAbout shows the about dialog
@@ -831,42 +963,35 @@ type UpdateInfo struct {
 	DownloadURL  string
 	ReleaseDate  string
 	ReleaseNotes []string
-	Size         int64 // Size in bytes
-}
-
-// checkForUpdatesInBackground silently checks for updates and notifies only if an update is available
-func checkForUpdatesInBackground(w fyne.Window) {
-	// In a real implementation, this would check version from a server API
-	currentVersion := Version
-
-	// Check against GitHub releases API or your custom endpoint
-	updateInfo := getLatestReleaseInfo()
-
-	// If there's a newer version available, show notification
-	if updateInfo != nil && updateInfo.Version != currentVersion {
-		logActivity(fmt.Sprintf("Update available: %s (current: %s)", updateInfo.Version, currentVersion))
-		showUpdateNotification(w, updateInfo)
-	} else {
-		logActivity("No updates available. Current version is up to date.")
-	}
+	Size         int64         // Size in bytes
+	AssetName    string        // File name the signed manifest lists the download under
+	Package      string        // Package type of the download, one of the Package constants
+	SHA256       string        // Checksum listed by the update server, used instead of ChecksumURL
+	ChecksumURL  string        // The download's .sha256 asset
+	ManifestURL  string        // Signed manifest of the release's files
+	SignatureURL string        // ed25519 signature of the manifest
+	Security     bool          // Fixes a security problem, so it is downloaded without asking
+	Patches      []UpdatePatch // Patches from this version to Version, applied in order instead of downloading in full
 }
 
-// getLatestReleaseInfo fetches information about the latest release
+// getLatestReleaseInfo fetches information about the newest release allowed
+// by config's update channel and pinned and skipped versions
 // Uses HTTP to check a real update server if available
-func getLatestReleaseInfo() *UpdateInfo {
+func getLatestReleaseInfo(config *AppConfig) (*UpdateInfo, error) {
 	// Get update server URL from environment variable or use default
 	updateServerURL := os.Getenv("ATTENDANCE_UPDATE_SERVER")
 	if updateServerURL == "" {
 		// Default to GitHub API for the rashidpathiyil/attendance-tracker repository
 		updateServerURL = "https://api.github.com/repos/rashidpathiyil/attendance-tracker/releases/latest"
 	}
+	updateServerURL = channelUpdateURL(updateServerURL, config)
 
 	// For testing purposes - always return a simulated newer version if test env is set
 	if os.Getenv("ATTENDANCE_UPDATE_TEST") == "1" {
 		logActivity("Using simulated update data for testing")
 		return &UpdateInfo{
 			Version:     "1.1.0",
-			DownloadURL: "https://github.com/rashidpathiyil/attendance-tracker/releases/download/v1.1.0/Attendance-Tracker.exe",
+			DownloadURL: "https://github.com/rashidpathiyil/attendance-tracker/releases/download/v1.1.0/attendance-tracker_windows_amd64.exe",
 			ReleaseDate: "2023-04-15",
 			ReleaseNotes: []string{
 				"Added auto-update feature",
@@ -874,8 +999,13 @@ func getLatestReleaseInfo() *UpdateInfo {
 				"Improved startup performance",
 				"Added better error handling",
 			},
-			Size: 24500000, // Approx 24.5 MB
-		}
+			Size:         24500000, // Approx 24.5 MB
+			AssetName:    "attendance-tracker_windows_amd64.exe",
+			Package:      PackageBinary,
+			ChecksumURL:  "https://github.com/rashidpathiyil/attendance-tracker/releases/download/v1.1.0/attendance-tracker_windows_amd64.exe.sha256",
+			ManifestURL:  "https://github.com/rashidpathiyil/attendance-tracker/releases/download/v1.1.0/" + updateManifestName,
+			SignatureURL: "https://github.com/rashidpathiyil/attendance-tracker/releases/download/v1.1.0/" + updateSignatureName,
+		}, nil
 	}
 
 	// Check if this is a forced check when running the test script
@@ -899,8 +1029,7 @@ func getLatestReleaseInfo() *UpdateInfo {
 	// Create a request with headers
 	req, err := http.NewRequest("GET", updateServerURL, nil)
 	if err != nil {
-		logActivity(fmt.Sprintf("Error creating request: %v", err))
-		return nil
+		return nil, fmt.Errorf("could not create the update request: %v", err)
 	}
 
 	// Add User-Agent header (GitHub API requires this)
@@ -909,75 +1038,87 @@ func getLatestReleaseInfo() *UpdateInfo {
 	// Make the request
 	resp, err := client.Do(req)
 	if err != nil {
-		logActivity(fmt.Sprintf("Error checking for updates: %v", err))
-		return nil
+		return nil, fmt.Errorf("could not reach the update server: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status code
 	if resp.StatusCode != http.StatusOK {
-		logActivity(fmt.Sprintf("Error from update server: status code %d", resp.StatusCode))
-		return nil
+		return nil, fmt.Errorf("the update server answered with status %d", resp.StatusCode)
 	}
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logActivity(fmt.Sprintf("Error reading update response: %v", err))
-		return nil
+		return nil, fmt.Errorf("could not read the update server's response: %v", err)
 	}
 
 	// Parse the response body based on the server type
 	// For GitHub API, this would parse the GitHub JSON format
 	// For a custom server, parse your own format
 	if strings.Contains(updateServerURL, "api.github.com") {
-		// Parse GitHub API response
-		var githubResponse struct {
-			TagName string `json:"tag_name"`
-			Name    string `json:"name"`
-			Assets  []struct {
-				Size        int64  `json:"size"`
-				Name        string `json:"name"`
-				DownloadURL string `json:"browser_download_url"`
-			} `json:"assets"`
-			PublishedAt string `json:"published_at"`
-			Body        string `json:"body"`
+		// Parse GitHub API response: one release from /releases/latest,
+		// or the list from /releases
+		var releases []githubRelease
+		if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+			if err := json.Unmarshal(body, &releases); err != nil {
+				return nil, fmt.Errorf("could not parse the GitHub response: %v", err)
+			}
+		} else {
+			var release githubRelease
+			if err := json.Unmarshal(body, &release); err != nil {
+				return nil, fmt.Errorf("could not parse the GitHub response: %v", err)
+			}
+			releases = append(releases, release)
 		}
 
-		if err := json.Unmarshal(body, &githubResponse); err != nil {
-			logActivity(fmt.Sprintf("Error parsing GitHub response: %v", err))
-			return nil
+		// Skip update check if no release is newer and allowed
+		githubResponse, version, found := chooseGitHubRelease(releases, config)
+		if !found {
+			logActivity(fmt.Sprintf("Current version %s is up to date on the %s channel", Version, config.UpdateChannel))
+			return nil, nil
 		}
 
-		// Skip the "v" prefix if present
-		version := githubResponse.TagName
-		if strings.HasPrefix(version, "v") {
-			version = version[1:]
+		// Find the asset for this platform
+		var assets []ReleaseAsset
+		for _, asset := range githubResponse.Assets {
+			assets = append(assets, ReleaseAsset{Name: asset.Name, URL: asset.DownloadURL, Size: asset.Size})
 		}
+		asset, found := selectUpdateAsset(assets)
 
-		// Skip update check if version isn't a higher number
-		if !isVersionNewer(version, Version) {
-			logActivity(fmt.Sprintf("Current version %s is up to date compared to %s", Version, version))
-			return nil
+		// Return nil if no downloadable asset was found
+		if !found {
+			return nil, fmt.Errorf("no download for %s/%s found in release assets", runtime.GOOS, runtime.GOARCH)
 		}
 
-		// Find the Windows asset
-		var downloadURL string
-		var size int64
-		for _, asset := range githubResponse.Assets {
-			// Look for Windows executable - can be attendance-tracker.exe or Attendance Tracker.exe
-			if strings.HasSuffix(asset.Name, ".exe") {
-				downloadURL = asset.DownloadURL
-				size = asset.Size
-				break
+		// Find the checksum and the signed manifest published with it
+		var checksumURL, manifestURL, signatureURL string
+		for _, published := range githubResponse.Assets {
+			switch published.Name {
+			case asset.Name + ".sha256":
+				checksumURL = published.DownloadURL
+			case updateManifestName:
+				manifestURL = published.DownloadURL
+			case updateSignatureName:
+				signatureURL = published.DownloadURL
 			}
 		}
 
-		// Return nil if no downloadable asset was found
-		if downloadURL == "" {
-			logActivity("No suitable download file found in release assets")
-			return nil
+		// Patches are published with the version they lead to, so a chain
+		// may take them from several releases
+		patches := githubReleasePatches(githubResponse, asset.Name)
+		for i := range releases {
+			if release := &releases[i]; release != githubResponse && !release.Draft {
+				var published []ReleaseAsset
+				for _, a := range release.Assets {
+					published = append(published, ReleaseAsset{Name: a.Name, URL: a.DownloadURL})
+				}
+				if releaseAsset, ok := selectUpdateAsset(published); ok {
+					patches = append(patches, githubReleasePatches(release, releaseAsset.Name)...)
+				}
+			}
 		}
+		chain, _ := findPatchChain(patches, Version, version)
 
 		// Parse release notes from body
 		releaseNotes := parseReleaseNotes(githubResponse.Body)
@@ -989,76 +1130,100 @@ func getLatestReleaseInfo() *UpdateInfo {
 
 		return &UpdateInfo{
 			Version:      version,
-			DownloadURL:  downloadURL,
+			DownloadURL:  asset.URL,
 			ReleaseDate:  releaseDate,
 			ReleaseNotes: releaseNotes,
-			Size:         size,
-		}
+			Size:         asset.Size,
+			AssetName:    asset.Name,
+			Package:      asset.Package,
+			ChecksumURL:  checksumURL,
+			ManifestURL:  manifestURL,
+			SignatureURL: signatureURL,
+			Security:     isSecurityRelease(githubResponse.Name, githubResponse.Body),
+			Patches:      chain,
+		}, nil
 	} else {
-		// Parse custom server response (simple JSON)
+		// Parse custom server response (simple JSON). Servers list an
+		// asset per platform; older ones give a single download_url.
 		var customResponse struct {
-			Version      string   `json:"version"`
-			DownloadURL  string   `json:"download_url"`
-			ReleaseDate  string   `json:"release_date"`
-			ReleaseNotes []string `json:"release_notes"`
-			Size         int64    `json:"size"`
+			Version      string         `json:"version"`
+			DownloadURL  string         `json:"download_url"`
+			ReleaseDate  string         `json:"release_date"`
+			ReleaseNotes []string       `json:"release_notes"`
+			Size         int64          `json:"size"`
+			Assets       []ReleaseAsset `json:"assets"`
+			ChecksumURL  string         `json:"checksum_url"`
+			ManifestURL  string         `json:"manifest_url"`
+			SignatureURL string         `json:"signature_url"`
+			Security     bool           `json:"security"`
 		}
 
 		if err := json.Unmarshal(body, &customResponse); err != nil {
-			logActivity(fmt.Sprintf("Error parsing custom server response: %v", err))
-			return nil
+			return nil, fmt.Errorf("could not parse the update server's response: %v", err)
 		}
 
-		// Don't return update info if version isn't newer
-		if !isVersionNewer(customResponse.Version, Version) {
-			return nil
+		// Don't return update info if version isn't newer or isn't wanted
+		if !isUpdateCandidate(customResponse.Version, false, config) {
+			return nil, nil
+		}
+
+		assets := customResponse.Assets
+		if len(assets) == 0 && customResponse.DownloadURL != "" {
+			assets = []ReleaseAsset{{
+				Name: updateAssetName(customResponse.DownloadURL),
+				URL:  customResponse.DownloadURL,
+				Size: customResponse.Size,
+			}}
+		}
+		asset, found := selectUpdateAsset(assets)
+		if !found {
+			return nil, fmt.Errorf("no download for %s/%s offered by the update server", runtime.GOOS, runtime.GOARCH)
+		}
+
+		chain, _ := findPatchChain(asset.Patches, Version, customResponse.Version)
+
+		// The checksum and signature sit next to their files unless the
+		// server says otherwise
+		checksumURL := asset.URL + ".sha256"
+		if customResponse.ChecksumURL != "" && asset.URL == customResponse.DownloadURL {
+			checksumURL = customResponse.ChecksumURL
+		}
+		if customResponse.SignatureURL == "" && customResponse.ManifestURL != "" {
+			customResponse.SignatureURL = customResponse.ManifestURL + ".sig"
 		}
 
 		return &UpdateInfo{
 			Version:      customResponse.Version,
-			DownloadURL:  customResponse.DownloadURL,
+			DownloadURL:  asset.URL,
 			ReleaseDate:  customResponse.ReleaseDate,
 			ReleaseNotes: customResponse.ReleaseNotes,
-			Size:         customResponse.Size,
-		}
+			Size:         asset.Size,
+			AssetName:    asset.Name,
+			Package:      asset.Package,
+			SHA256:       strings.ToLower(asset.SHA256),
+			ChecksumURL:  checksumURL,
+			ManifestURL:  customResponse.ManifestURL,
+			SignatureURL: customResponse.SignatureURL,
+			Security:     customResponse.Security,
+			Patches:      chain,
+		}, nil
 	}
 }
 
 // isVersionNewer checks if version1 is newer than version2
-// Uses semantic versioning rules
+// Uses Semantic Versioning 2.0 precedence, so "1.1.0-rc.1" is older than "1.1.0"
 func isVersionNewer(version1, version2 string) bool {
-	// Parse version strings into components
-	v1Parts := strings.Split(version1, ".")
-	v2Parts := strings.Split(version2, ".")
-
-	// Pad with zeros to ensure equal length
-	for len(v1Parts) < 3 {
-		v1Parts = append(v1Parts, "0")
-	}
-	for len(v2Parts) < 3 {
-		v2Parts = append(v2Parts, "0")
+	v1, err := parseSemVer(version1)
+	if err != nil {
+		logActivity(fmt.Sprintf("Ignoring version: %v", err))
+		return false
 	}
-
-	// Compare major, minor, patch versions
-	for i := 0; i < 3; i++ {
-		v1, err1 := strconv.Atoi(v1Parts[i])
-		v2, err2 := strconv.Atoi(v2Parts[i])
-
-		// If we can't parse a version part, consider them equal
-		if err1 != nil || err2 != nil {
-			continue
-		}
-
-		if v1 > v2 {
-			return true
-		} else if v1 < v2 {
-			return false
-		}
-		// If equal, continue to next part
+	v2, err := parseSemVer(version2)
+	if err != nil {
+		// Builds without a release version never update themselves
+		return false
 	}
-
-	// If we get here, versions are equal
-	return false
+	return v1.Compare(v2) > 0
 }
 
 // parseReleaseNotes parses release notes from GitHub markdown format
@@ -1101,7 +1266,7 @@ func formatReleaseDate(githubDate string) string {
 }
 
 // showUpdateNotification shows a small notification about available updates
-func showUpdateNotification(w fyne.Window, updateInfo *UpdateInfo) {
+func showUpdateNotification(w fyne.Window, tracker *Tracker, updateInfo *UpdateInfo) {
 	dialog.ShowCustomConfirm("Update Available",
 		"View Details", "Not Now",
 		container.NewVBox(
@@ -1113,15 +1278,42 @@ func showUpdateNotification(w fyne.Window, updateInfo *UpdateInfo) {
 		func(viewDetails bool) {
 			if viewDetails {
 				// Show the full update dialog
-				checkForUpdates(w)
+				checkForUpdates(w, tracker)
+			}
+		}, w)
+}
+
+// showUpdateReadyNotification offers to install a security update that was
+// downloaded and verified in the background
+func showUpdateReadyNotification(w fyne.Window, updateInfo *UpdateInfo, updatePath string) {
+	dialog.ShowCustomConfirm("Security Update Ready",
+		"Install and Restart", "Later",
+		container.NewVBox(
+			widget.NewLabel(fmt.Sprintf("Version %s fixes a security problem.", updateInfo.Version)),
+			widget.NewLabel("It has been downloaded and verified, and installing it takes a moment."),
+			widget.NewLabel(fmt.Sprintf("Current version: %s", Version)),
+		),
+		func(install bool) {
+			if install {
+				installUpdate(w, updatePath, updateInfo)
 			}
 		}, w)
 }
 
 // checkForUpdates checks if a newer version is available
-func checkForUpdates(w fyne.Window) {
+func checkForUpdates(w fyne.Window, tracker *Tracker) {
 	currentVersion := Version
 
+	// Administrators may manage updates themselves
+	if tracker.CurrentConfig().UpdateMode == UpdateModeOff {
+		message := "Update checks are turned off in Settings."
+		if source := tracker.Policies().LockedBy("update_mode"); source != "" {
+			message = "Updates are managed by your organization."
+		}
+		dialog.ShowInformation("Updates Turned Off", message, w)
+		return
+	}
+
 	// Show initial checking dialog
 	progress := widget.NewProgressBarInfinite()
 	checkingDialog := dialog.NewCustom("Checking for Updates", "Cancel",
@@ -1139,11 +1331,17 @@ func checkForUpdates(w fyne.Window) {
 		time.Sleep(1 * time.Second)
 
 		// Get update info
-		updateInfo := getLatestReleaseInfo()
+		updateInfo, err := getLatestReleaseInfo(tracker.CurrentConfig())
+		recordUpdateCheck(getUpdateStatusPath(), updateInfo, err)
 
 		// Close the checking dialog
 		checkingDialog.Hide()
 
+		if err != nil {
+			showUpdateError(w, "Could not check for updates", err)
+			return
+		}
+
 		// Show results
 		if updateInfo != nil && updateInfo.Version != currentVersion {
 			// Create notes container
@@ -1156,54 +1354,62 @@ func checkForUpdates(w fyne.Window) {
 
 			// Format size nicely
 			sizeText := fmt.Sprintf("%.1f MB", float64(updateInfo.Size)/1024/1024)
+			if patchTotal := patchSize(updateInfo.Patches); patchTotal > 0 {
+				sizeText = fmt.Sprintf("%.1f MB as a patch (%s in full)", float64(patchTotal)/1024/1024, sizeText)
+			}
 
 			// Show update available dialog
-			dialog.ShowCustomConfirm("Update Available",
-				"Download & Install", "Later",
+			updateDialog := dialog.NewCustomWithoutButtons("Update Available",
 				container.NewVBox(
 					widget.NewLabel(fmt.Sprintf("Current version: %s", currentVersion)),
 					widget.NewLabel(fmt.Sprintf("New version: %s", updateInfo.Version)),
 					widget.NewLabel(fmt.Sprintf("Released: %s", updateInfo.ReleaseDate)),
 					widget.NewLabel(fmt.Sprintf("Size: %s", sizeText)),
 					notesContainer,
-				),
-				func(update bool) {
-					if update {
-						// Download and install the update
-						downloadAndInstallUpdate(w, updateInfo)
-					}
-				}, w)
+				), w)
+			installButton := widget.NewButton("Download & Install", func() {
+				updateDialog.Hide()
+				// Download and install the update
+				downloadAndInstallUpdate(w, updateInfo)
+			})
+			installButton.Importance = widget.HighImportance
+			updateDialog.SetButtons([]fyne.CanvasObject{
+				widget.NewButton("Later", updateDialog.Hide),
+				widget.NewButton("Skip This Version", func() {
+					updateDialog.Hide()
+					skipUpdateVersion(w, tracker, updateInfo.Version)
+				}),
+				installButton,
+			})
+			updateDialog.Show()
 		} else {
 			// No update available
 			dialog.ShowInformation("Up to Date",
-				fmt.Sprintf("You're using the latest version (%s).", currentVersion), w)
+				fmt.Sprintf("You're using the latest version (%s) of the %s channel.", currentVersion, tracker.CurrentConfig().UpdateChannel), w)
 		}
 	}()
 }
 
-// downloadAndInstallUpdate downloads and installs the update
-func downloadAndInstallUpdate(w fyne.Window, updateInfo *UpdateInfo) {
-	// First check if the update is already downloaded
-	updateCachePath := getUpdateCachePath(updateInfo.Version)
-	if fileExists(updateCachePath) {
-		// Update already downloaded - confirm reinstall
-		dialog.ShowConfirm("Update Already Downloaded",
-			fmt.Sprintf("Version %s has already been downloaded. Install it now?", updateInfo.Version),
-			func(install bool) {
-				if install {
-					// Install the already downloaded update
-					installUpdate(w, updateCachePath, updateInfo)
-				}
-			}, w)
+// skipUpdateVersion stops version from being offered again. Later versions
+// are still offered.
+func skipUpdateVersion(w fyne.Window, tracker *Tracker, version string) {
+	config := *tracker.CurrentConfig()
+	config.SkippedVersion = version
+	if err := applySettings(tracker, &config); err != nil {
+		dialog.ShowError(err, w)
 		return
 	}
+	logActivity(fmt.Sprintf("Version %s will not be offered again", version))
+}
 
+// downloadAndInstallUpdate downloads and verifies the update, then installs it
+func downloadAndInstallUpdate(w fyne.Window, updateInfo *UpdateInfo) {
 	// Set up progress dialog
 	progressBar := widget.NewProgressBar()
 	progressBar.SetValue(0)
-	progressText := widget.NewLabel("Preparing download...")
+	progressText := widget.NewLabel("Checking release signature...")
 
-	cancelDownload := false
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// Create the progress dialog
 	dlg := dialog.NewCustom("Downloading Update", "Cancel",
@@ -1213,86 +1419,43 @@ func downloadAndInstallUpdate(w fyne.Window, updateInfo *UpdateInfo) {
 			progressText,
 		), w)
 
-	// Set up cancel callback
-	dlg.SetOnClosed(func() {
-		cancelDownload = true
-	})
+	// Cancelling stops the download; the partial file is kept to resume later
+	dlg.SetOnClosed(cancel)
 
 	// Show the dialog
 	dlg.Show()
 
-	// Simulate download in goroutine
 	go func() {
-		// Create a temp directory for the download
-		tempDir, err := os.MkdirTemp("", "attendance-tracker-update")
-		if err != nil {
-			showUpdateError(w, "Could not create temporary download folder", err)
-			dlg.Hide()
-			return
-		}
+		defer cancel()
 
-		logActivity(fmt.Sprintf("Downloading update %s to: %s", updateInfo.Version, tempDir))
-
-		// Simulate download progress
-		totalSteps := 100
-		for i := 0; i <= totalSteps; i++ {
-			if cancelDownload {
-				logActivity("Update download cancelled by user")
-				return
-			}
+		logActivity(fmt.Sprintf("Downloading update %s from: %s", updateInfo.Version, updateInfo.DownloadURL))
 
-			// Update progress
-			progress := float64(i) / float64(totalSteps)
-			progressBar.SetValue(progress)
-
-			// Update text with percentage and download rate
-			downloadedSize := int64(float64(updateInfo.Size) * progress)
-			progressText.SetText(fmt.Sprintf("%.1f%% (%.1f/%.1f MB) - 2.5 MB/s",
-				progress*100,
-				float64(downloadedSize)/1024/1024,
-				float64(updateInfo.Size)/1024/1024))
-
-			// Slow down the simulation
-			time.Sleep(50 * time.Millisecond)
+		updatePath, err := fetchVerifiedUpdate(ctx, updateInfo, func(p DownloadProgress) {
+			progressBar.SetValue(p.Fraction())
+			progressText.SetText(p.String())
+		})
+		if errors.Is(err, context.Canceled) {
+			logActivity("Update download cancelled by user")
+			return
 		}
 
 		// Hide download dialog
 		dlg.Hide()
 
-		// Create update cache directory if it doesn't exist
-		updateCacheDir := getUpdateCacheDir()
-		if err := os.MkdirAll(updateCacheDir, 0755); err != nil {
-			showUpdateError(w, "Could not create update cache directory", err)
-			return
-		}
-
-		// In a real implementation, this would be where we move the downloaded file
-		// from tempDir to updateCachePath
-
-		// Simulate this by copying a file or just writing a placeholder
-		if err := os.WriteFile(updateCachePath, []byte("Simulated update file for "+updateInfo.Version), 0644); err != nil {
-			showUpdateError(w, "Could not save downloaded update", err)
+		if err != nil {
+			showUpdateError(w, "Could not download a verified update", err)
 			return
 		}
 
-		logActivity(fmt.Sprintf("Update %s downloaded to: %s", updateInfo.Version, updateCachePath))
-
 		// Install the downloaded update
-		installUpdate(w, updateCachePath, updateInfo)
+		installUpdate(w, updatePath, updateInfo)
 	}()
 }
 
-// installUpdate installs a downloaded update
+// installUpdate installs a downloaded update and restarts into it
 func installUpdate(w fyne.Window, updateFilePath string, updateInfo *UpdateInfo) {
-	// Save current settings to ensure they're preserved during upgrade
-	config, _ := loadConfig()
-	if config != nil {
-		if err := saveConfig(config); err != nil {
-			logActivity(fmt.Sprintf("Warning: Could not save config before update: %v", err))
-		} else {
-			logActivity("Configuration preserved for update")
-		}
-	}
+	// The config file is left as it is; the new version migrates it with a
+	// backup when it starts with --upgrade
 
 	// Show installation dialog
 	installationDialog := dialog.NewCustom("Installing Update", "",
@@ -1302,29 +1465,29 @@ func installUpdate(w fyne.Window, updateFilePath string, updateInfo *UpdateInfo)
 			widget.NewProgressBarInfinite(),
 		), w)
 
-	installationDialog.Show()
+	// Packages go to the system's installer, which needs the user
+	if !isSelfInstallable(updateInfo.Package) {
+		logActivity(fmt.Sprintf("Opening %s with the system installer", updateFilePath))
+		if err := fyne.CurrentApp().OpenURL(&url.URL{Scheme: "file", Path: filepath.ToSlash(updateFilePath)}); err != nil {
+			showUpdateError(w, "Could not open the update package", err)
+			return
+		}
+		dialog.ShowInformation("Finish Installing",
+			fmt.Sprintf("The verified %s package for version %s has been opened.\nFinish installing it there, then restart Attendance Tracker.", updateInfo.Package, updateInfo.Version), w)
+		return
+	}
 
-	// Simulate installation process
-	time.Sleep(2 * time.Second)
+	installationDialog.Show()
 
-	// Hide installation dialog
+	err := installVerifiedUpdate(updateFilePath, updateInfo)
 	installationDialog.Hide()
+	if err != nil {
+		showUpdateError(w, "Could not install the update", err)
+		return
+	}
 
-	// Show completion dialog
-	dialog.ShowCustom("Update Complete", "Restart Now",
-		container.NewVBox(
-			widget.NewLabel("Update successfully installed!"),
-			widget.NewLabel(fmt.Sprintf("Version %s will be applied when Attendance Tracker restarts.", updateInfo.Version)),
-		), w)
-
-	// Wait a bit then restart (in a real implementation)
-	time.Sleep(2 * time.Second)
-
-	// In a real implementation, we would create a script to:
-	// 1. Replace the current executable with the downloaded one
-	// 2. Restart the application
-	// For now, we just exit
-	logActivity("Update installed - application restarting")
+	// The helper starts the new version once this one has exited, and puts
+	// this one back if the new one fails to start
 	fyne.CurrentApp().Quit()
 }
 
@@ -1340,9 +1503,17 @@ func getUpdateCacheDir() string {
 	return filepath.Join(cacheDir, "attendance-tracker", "updates")
 }
 
-// getUpdateCachePath returns the path where an update for a specific version would be cached
-func getUpdateCachePath(version string) string {
-	return filepath.Join(getUpdateCacheDir(), fmt.Sprintf("attendance-tracker-%s.exe", version))
+// getUpdateCachePath returns the path where an update would be cached,
+// keeping the asset's name so packages open with the right installer
+func getUpdateCachePath(updateInfo *UpdateInfo) string {
+	name := filepath.Base(updateInfo.AssetName)
+	if name == "." || name == string(filepath.Separator) {
+		name = "attendance-tracker"
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+	}
+	return filepath.Join(getUpdateCacheDir(), updateInfo.Version, name)
 }
 
 // fileExists checks if a file exists
@@ -1353,6 +1524,22 @@ func fileExists(path string) bool {
 
 // logActivity logs application activity to the log file
 func logActivity(message string) {
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	logEntry := fmt.Sprintf("[%s] %s\n", timestamp, message)
+
+	// Keep the latest entries for the activity log on the Status tab
+	recentActivityMu.Lock()
+	recentActivity = append(recentActivity, fmt.Sprintf("%s %s", time.Now().Format("15:04:05"), message))
+	if len(recentActivity) > recentActivitySize {
+		recentActivity = recentActivity[len(recentActivity)-recentActivitySize:]
+	}
+	recentActivityMu.Unlock()
+
+	// Headless mode also logs to the console
+	if logToStdout {
+		fmt.Print(logEntry)
+	}
+
 	logFile, err := os.OpenFile(getLogFilePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Printf("Error opening log file: %v\n", err)
@@ -1360,14 +1547,26 @@ func logActivity(message string) {
 	}
 	defer logFile.Close()
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	logEntry := fmt.Sprintf("[%s] %s\n", timestamp, message)
-
 	if _, err := logFile.WriteString(logEntry); err != nil {
 		fmt.Printf("Error writing to log file: %v\n", err)
 	}
 }
 
+// Number of log entries shown in the activity log
+const recentActivitySize = 8
+
+var (
+	recentActivityMu sync.Mutex
+	recentActivity   []string
+)
+
+// getRecentActivity returns the latest log entries, oldest first
+func getRecentActivity() []string {
+	recentActivityMu.Lock()
+	defer recentActivityMu.Unlock()
+	return append([]string{}, recentActivity...)
+}
+
 // showUpdateError displays an error dialog for update issues
 func showUpdateError(w fyne.Window, message string, err error) {
 	errorMessage := message
@@ -1401,14 +1600,14 @@ func getLogFilePath() string {
 }
 
 // createMainMenu creates the main menu for the application
-func createMainMenu(a fyne.App, w fyne.Window, updateChannel chan *UpdateInfo) *fyne.MainMenu {
+func createMainMenu(a fyne.App, w fyne.Window, tracker *Tracker, updateChannel chan *UpdateInfo) *fyne.MainMenu {
 	// Create menu items
 	settingsItem := fyne.NewMenuItem("Settings", func() {
-		showSettingsDialog(w)
+		showSettingsDialog(w, tracker)
 	})
 
 	updateItem := fyne.NewMenuItem("Check for Updates", func() {
-		checkForUpdates(w)
+		checkForUpdates(w, tracker)
 	})
 
 	// Subscribe to update notifications if channel is provided
@@ -1435,7 +1634,7 @@ func createMainMenu(a fyne.App, w fyne.Window, updateChannel chan *UpdateInfo) *
 
 	// About menu item
 	aboutItem := fyne.NewMenuItem("About", func() {
-		showAboutDialog(w)
+		showAboutDialog(w, tracker)
 	})
 
 	// Create file menu
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain keeps the tests away from the user's config: default configs
+// create a device identity and logActivity writes a log file there
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "attendance-tracker-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME", "APPDATA"} {
+		os.Setenv(name, dir)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
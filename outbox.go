@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backoff limits for retrying failed deliveries
+var (
+	outboxBaseDelay = 2 * time.Second
+	outboxMaxDelay  = 5 * time.Minute
+)
+
+// outboxEntry is a single queued event and the file that stores it
+type outboxEntry struct {
+	seq     uint64
+	path    string
+	payload StatusPayload
+}
+
+// OutboxStats summarises the events still waiting to be delivered
+type OutboxStats struct {
+	Depth  int
+	Oldest *StatusPayload
+}
+
+// Outbox is a durable on-disk queue of events waiting to be sent.
+// Every event is written to its own file before delivery is attempted,
+// so events survive restarts, crashes and periods without network.
+// A single worker drains the queue in order, so events from this
+// device always reach the server in the order they happened.
+type Outbox struct {
+	dir    string
+	sender *EventSender
+
+	mu        sync.Mutex
+	nextSeq   uint64
+	pending   []outboxEntry
+	listeners []func(OutboxStats)
+
+	wake  chan struct{} // New events to send
+	retry chan struct{} // Retry now instead of waiting out the backoff
+}
+
+// getOutboxDir returns the directory holding queued events
+func getOutboxDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// Fallback to temp directory if config dir can't be determined
+		return filepath.Join(os.TempDir(), "attendance-tracker-outbox")
+	}
+	return filepath.Join(configDir, "attendance-tracker", "outbox")
+}
+
+// OpenOutbox opens the queue in dir, loading any events left by a previous run
+func OpenOutbox(dir string, sender *EventSender) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	o := &Outbox{
+		dir:     dir,
+		sender:  sender,
+		nextSeq: 1,
+		wake:    make(chan struct{}, 1),
+		retry:   make(chan struct{}, 1),
+	}
+
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+
+	if len(o.pending) > 0 {
+		stats := o.Stats()
+		logActivity(fmt.Sprintf("Outbox: %d events pending from previous run (oldest: %s)",
+			stats.Depth, describePayload(stats.Oldest)))
+	}
+
+	return o, nil
+}
+
+// load reads queued events from disk in sequence order
+func (o *Outbox) load() error {
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(o.dir, name)
+
+		// Leftover temp files are events that were never fully written
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(path)
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var payload StatusPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			logActivity(fmt.Sprintf("Outbox: setting aside unreadable event %s: %v", name, err))
+			o.setAside(path)
+			continue
+		}
+
+		o.pending = append(o.pending, outboxEntry{seq: seq, path: path, payload: payload})
+		if seq >= o.nextSeq {
+			o.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(o.pending, func(i, j int) bool {
+		return o.pending[i].seq < o.pending[j].seq
+	})
+
+	return nil
+}
+
+// Enqueue durably stores an event and wakes the delivery worker
+func (o *Outbox) Enqueue(payload StatusPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	seq := o.nextSeq
+	o.nextSeq++
+	path := filepath.Join(o.dir, fmt.Sprintf("%020d.json", seq))
+
+	// Write to a temp file and rename so a crash never leaves half an event
+	if err := writeFileSync(path, data); err != nil {
+		o.mu.Unlock()
+		logActivity(fmt.Sprintf("Outbox: failed to store %s event: %v", payload.EventType, err))
+		return err
+	}
+	// The rename is only durable once the directory is flushed too. The event
+	// is queued either way, so a failure here is only logged.
+	if err := syncDir(o.dir); err != nil {
+		logActivity(fmt.Sprintf("Outbox: could not flush %s: %v", o.dir, err))
+	}
+
+	o.pending = append(o.pending, outboxEntry{seq: seq, path: path, payload: payload})
+	depth := len(o.pending)
+	o.mu.Unlock()
+
+	logActivity(fmt.Sprintf("Outbox: queued %s event (%d pending)", payload.EventType, depth))
+	o.notify()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Stats returns the current depth of the queue and its oldest event
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stats := OutboxStats{Depth: len(o.pending)}
+	if len(o.pending) > 0 {
+		oldest := o.pending[0].payload
+		stats.Oldest = &oldest
+	}
+	return stats
+}
+
+// OnChange registers a callback invoked whenever the queue grows or shrinks
+func (o *Outbox) OnChange(listener func(OutboxStats)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.listeners = append(o.listeners, listener)
+}
+
+// Wake retries a failed delivery immediately, such as after signing in
+func (o *Outbox) Wake() {
+	select {
+	case o.retry <- struct{}{}:
+	default:
+	}
+}
+
+// WaitEmpty waits up to timeout for every queued event to be delivered
+func (o *Outbox) WaitEmpty(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for o.Stats().Depth > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// Run delivers queued events until done is closed
+func (o *Outbox) Run(done <-chan struct{}) {
+	attempt := 0
+
+	for {
+		entry, ok := o.head()
+		if !ok {
+			select {
+			case <-o.wake:
+				continue
+			case <-done:
+				return
+			}
+		}
+
+		err := o.sender.Send(entry.payload)
+		if err == nil {
+			o.remove(entry, false)
+			attempt = 0
+			continue
+		}
+
+		// Events the server rejects outright would block the queue forever
+		var sendErr *EventSendError
+		if errors.As(err, &sendErr) && !sendErr.Retryable {
+			logActivity(fmt.Sprintf("Outbox: server rejected %s event, setting it aside: %v", entry.payload.EventType, err))
+			o.remove(entry, true)
+			attempt = 0
+			continue
+		}
+
+		delay := outboxBackoff(attempt)
+		attempt++
+		logActivity(fmt.Sprintf("Outbox: delivery failed, retrying in %s (%d pending)", delay.Round(time.Second), o.Stats().Depth))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-o.retry:
+			timer.Stop()
+			attempt = 0
+		case <-done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// head returns the oldest pending event
+func (o *Outbox) head() (outboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.pending) == 0 {
+		return outboxEntry{}, false
+	}
+	return o.pending[0], true
+}
+
+// remove drops a delivered (or rejected) event from the queue
+func (o *Outbox) remove(entry outboxEntry, rejected bool) {
+	o.mu.Lock()
+	if len(o.pending) > 0 && o.pending[0].seq == entry.seq {
+		o.pending = o.pending[1:]
+	}
+	o.mu.Unlock()
+
+	if rejected {
+		o.setAside(entry.path)
+	} else if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		logActivity(fmt.Sprintf("Outbox: could not remove delivered event %s: %v", entry.path, err))
+	}
+
+	o.notify()
+}
+
+// setAside moves an event file into the failed directory for later inspection
+func (o *Outbox) setAside(path string) {
+	failedDir := filepath.Join(o.dir, "failed")
+	if err := os.MkdirAll(failedDir, 0755); err == nil {
+		if err := os.Rename(path, filepath.Join(failedDir, filepath.Base(path))); err == nil {
+			return
+		}
+	}
+	os.Remove(path)
+}
+
+// notify informs listeners about the current queue state
+func (o *Outbox) notify() {
+	stats := o.Stats()
+
+	o.mu.Lock()
+	listeners := append([]func(OutboxStats){}, o.listeners...)
+	o.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(stats)
+	}
+}
+
+// outboxBackoff returns the delay before retry number attempt,
+// growing exponentially with random jitter to avoid synchronized retries
+func outboxBackoff(attempt int) time.Duration {
+	delay := outboxMaxDelay
+	if attempt < 20 {
+		if d := outboxBaseDelay << uint(attempt); d < outboxMaxDelay {
+			delay = d
+		}
+	}
+
+	// Pick a random delay between half and the full backoff
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// writeFileSync atomically writes data to path, flushing it to disk first
+func writeFileSync(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// syncDir flushes a directory's entries to disk, so files renamed into it
+// survive a power loss. Windows cannot flush directories and does not need to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// describePayload formats an event for display in the log and UI
+func describePayload(payload *StatusPayload) string {
+	if payload == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s at %s %s", payload.EventType, payload.Payload.Date, payload.Payload.Time)
+}
+
+// describeOutboxStats formats the queue state for display in the UI
+func describeOutboxStats(stats OutboxStats) string {
+	if stats.Depth == 0 {
+		return "Queue: all events delivered"
+	}
+	return fmt.Sprintf("Queue: %d pending (oldest: %s)", stats.Depth, describePayload(stats.Oldest))
+}
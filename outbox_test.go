@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestOutbox opens an outbox in dir sending to a server that answers
+// with status, recording the events it receives in order
+func newTestOutbox(t *testing.T, dir string, status int) (*Outbox, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload StatusPayload
+		json.Unmarshal(body, &payload)
+		mu.Lock()
+		received = append(received, payload.EventType+" "+payload.Payload.Time)
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	config := NewAppConfig()
+	config.ServerEndpoint = server.URL
+	outbox, err := OpenOutbox(dir, NewEventSender(NewSharedConfig(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outbox, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, received...)
+	}
+}
+
+// testEvents returns count events one minute apart from 09:00
+func testEvents(count int) []StatusPayload {
+	config := NewAppConfig()
+	types := []string{EventCheckIn, EventIdle, EventActive, EventCheckOut}
+	var events []StatusPayload
+	for i := 0; i < count; i++ {
+		at := time.Date(2026, 3, 2, 9, i, 0, 0, time.Local)
+		events = append(events, NewStatusPayload(config, types[i%len(types)], SourceAuto, at))
+	}
+	return events
+}
+
+// runOutbox delivers until the queue is empty
+func runOutbox(t *testing.T, outbox *Outbox) {
+	t.Helper()
+	done := make(chan struct{})
+	defer close(done)
+	go outbox.Run(done)
+	if !outbox.WaitEmpty(5 * time.Second) {
+		t.Fatalf("%d events still queued", outbox.Stats().Depth)
+	}
+}
+
+func TestOutboxDeliversInOrder(t *testing.T) {
+	outbox, received := newTestOutbox(t, t.TempDir(), http.StatusOK)
+	for _, event := range testEvents(4) {
+		if err := outbox.Enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runOutbox(t, outbox)
+
+	want := []string{"check_in 09:00:00", "idle 09:01:00", "active 09:02:00", "check_out 09:03:00"}
+	got := received()
+	if len(got) != len(want) {
+		t.Fatalf("received %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	first, _ := newTestOutbox(t, dir, http.StatusOK)
+	for _, event := range testEvents(3) {
+		if err := first.Enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Never run; a new process opens the same queue
+	second, received := newTestOutbox(t, dir, http.StatusOK)
+	if stats := second.Stats(); stats.Depth != 3 {
+		t.Fatalf("depth after restart = %d, want 3", stats.Depth)
+	}
+	// New events go after the ones left behind
+	if err := second.Enqueue(testEvents(4)[3]); err != nil {
+		t.Fatal(err)
+	}
+	runOutbox(t, second)
+
+	got := received()
+	if len(got) != 4 || got[0] != "check_in 09:00:00" || got[3] != "check_out 09:03:00" {
+		t.Errorf("received %v, want the queued events and then the new one", got)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 0 {
+		t.Errorf("delivered events left on disk: %v", files)
+	}
+}
+
+func TestOutboxIgnoresInterruptedWrites(t *testing.T) {
+	dir := t.TempDir()
+	first, _ := newTestOutbox(t, dir, http.StatusOK)
+	if err := first.Enqueue(testEvents(1)[0]); err != nil {
+		t.Fatal(err)
+	}
+	// writeFileSync was interrupted before its rename
+	leftover := filepath.Join(dir, "00000000000000000002.json.123456.tmp")
+	if err := os.WriteFile(leftover, []byte(`{"event_type": "check_o`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	second, _ := newTestOutbox(t, dir, http.StatusOK)
+	if stats := second.Stats(); stats.Depth != 1 || stats.Oldest.EventType != EventCheckIn {
+		t.Errorf("stats = %+v, want only the check-in", stats)
+	}
+	if fileExists(leftover) {
+		t.Error("leftover temp file was kept")
+	}
+}
+
+func TestOutboxSetsAsideRejectedEvents(t *testing.T) {
+	dir := t.TempDir()
+	outbox, received := newTestOutbox(t, dir, http.StatusUnprocessableEntity)
+	for _, event := range testEvents(2) {
+		if err := outbox.Enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runOutbox(t, outbox)
+
+	if got := received(); len(got) != 2 {
+		t.Errorf("received %v, want both events tried once", got)
+	}
+	failed, _ := filepath.Glob(filepath.Join(dir, "failed", "*.json"))
+	if len(failed) != 2 {
+		t.Errorf("failed/ holds %v, want both events", failed)
+	}
+}
+
+func TestOutboxStats(t *testing.T) {
+	outbox, _ := newTestOutbox(t, t.TempDir(), http.StatusOK)
+	if stats := outbox.Stats(); stats.Depth != 0 || stats.Oldest != nil {
+		t.Errorf("empty stats = %+v", stats)
+	}
+
+	var notified []int
+	outbox.OnChange(func(stats OutboxStats) { notified = append(notified, stats.Depth) })
+	events := testEvents(3)
+	for _, event := range events {
+		if err := outbox.Enqueue(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := outbox.Stats()
+	if stats.Depth != 3 || stats.Oldest == nil || stats.Oldest.Payload.Time != "09:00:00" {
+		t.Errorf("stats = %+v, want 3 events, oldest at 09:00:00", stats)
+	}
+	if len(notified) != 3 || notified[2] != 3 {
+		t.Errorf("listener saw depths %v, want 1, 2, 3", notified)
+	}
+	if got := describeOutboxStats(stats); got != "Queue: 3 pending (oldest: check_in at 2026-03-02 09:00:00)" {
+		t.Errorf("description = %q", got)
+	}
+}
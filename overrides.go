@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// configOverrides are the environment and command-line values applied on top
+// of the config file, lowest precedence first
+var configOverrides []ConfigLayer
+
+// Config fields holding true/false values; all others are strings
+var booleanConfigFields = map[string]bool{
+	"developer_mode":         true,
+	"show_activity_log":      true,
+	"show_idle_time":         true,
+	"auto_mode":              true,
+	"run_at_startup":         true,
+	"bind_device_to_machine": true,
+}
+
+// Help text for the override flags
+var configFieldUsage = map[string]string{
+	"server_endpoint":        "URL attendance events are sent to",
+	"device_id":              "ID of this device",
+	"user_id":                "ID of the user",
+	"idle_timeout":           `inactivity before auto check-out, e.g. "20m" or "90s"`,
+	"check_interval":         `how often activity is checked, e.g. "2s" or "500ms"`,
+	"developer_mode":         "enable developer mode",
+	"show_activity_log":      "show the activity log on the Status tab",
+	"show_idle_time":         "show the idle time on the Status tab",
+	"auto_mode":              "check in and out automatically",
+	"run_at_startup":         "start the tracker when you log in",
+	"bind_device_to_machine": "get a new device ID if the config is copied to another machine",
+	"update_channel":         `releases to update to: "stable", "beta" or "nightly"`,
+	"pinned_version":         "only update to this version",
+	"skipped_version":        "never offer this version as an update",
+	"update_mode":            `"off" to never check for updates, "notify" to ask before installing or "auto" to install without asking`,
+	"update_check_interval":  `how often to check for updates, e.g. "24h"`,
+}
+
+// configFlagName returns the command-line flag for a config field
+func configFlagName(field string) string {
+	return strings.ReplaceAll(field, "_", "-")
+}
+
+// configEnvName returns the environment variable for a config field
+func configEnvName(field string) string {
+	return "ATTENDANCE_" + strings.ToUpper(field)
+}
+
+// configFlag is a flag.Value recording a config override from the command line
+type configFlag struct {
+	field string
+	value string
+	set   bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *configFlag) Set(value string) error {
+	if _, err := parseConfigOverride(f.field, value); err != nil {
+		return err
+	}
+	f.value = value
+	f.set = true
+	return nil
+}
+
+// IsBoolFlag lets boolean fields be given as a bare --flag
+func (f *configFlag) IsBoolFlag() bool {
+	return booleanConfigFields[f.field]
+}
+
+// registerConfigFlags adds a flag for every config field to flags
+func registerConfigFlags(flags *flag.FlagSet) []*configFlag {
+	var configFlags []*configFlag
+	for _, field := range configFields {
+		f := &configFlag{field: field}
+		usage := fmt.Sprintf("Override %s (also %s)", configFieldUsage[field], configEnvName(field))
+		flags.Var(f, configFlagName(field), usage)
+		configFlags = append(configFlags, f)
+	}
+	return configFlags
+}
+
+// parseConfigOverride converts an override's text to its config file value
+func parseConfigOverride(field, text string) (interface{}, error) {
+	if !booleanConfigFields[field] {
+		return text, nil
+	}
+	value, err := strconv.ParseBool(text)
+	if err != nil {
+		return nil, fmt.Errorf("expected true or false, got %q", text)
+	}
+	return value, nil
+}
+
+// readConfigOverrides collects overrides from the environment and the parsed
+// flags. Invalid environment values are passed through, so loading the config
+// reports them alongside any other problems.
+func readConfigOverrides(configFlags []*configFlag) []ConfigLayer {
+	var layers []ConfigLayer
+
+	env := ConfigLayer{Source: "environment", Values: map[string]interface{}{}}
+	for _, field := range configFields {
+		text, ok := os.LookupEnv(configEnvName(field))
+		if !ok {
+			continue
+		}
+		value, err := parseConfigOverride(field, text)
+		if err != nil {
+			value = text
+		}
+		env.Values[field] = value
+	}
+	if len(env.Values) > 0 {
+		layers = append(layers, env)
+	}
+
+	cmdline := ConfigLayer{Source: "command line", Values: map[string]interface{}{}}
+	for _, f := range configFlags {
+		if f.set {
+			// Set has already checked the value
+			value, _ := parseConfigOverride(f.field, f.value)
+			cmdline.Values[f.field] = value
+		}
+	}
+	if len(cmdline.Values) > 0 {
+		layers = append(layers, cmdline)
+	}
+
+	return layers
+}
+
+// overriddenBy returns the override source that sets field, or ""
+func overriddenBy(field string) string {
+	for i := len(configOverrides) - 1; i >= 0; i-- {
+		if _, ok := configOverrides[i].Values[field]; ok {
+			return configOverrides[i].Source
+		}
+	}
+	return ""
+}
+
+// describeOverriddenFields lists the overridden fields for display in Settings
+func describeOverriddenFields(policies ConfigPolicies) string {
+	var labels []string
+	for _, field := range configFields {
+		if overriddenBy(field) != "" && policies.LockedBy(field) == "" {
+			labels = append(labels, configFieldLabel(field))
+		}
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Set by the environment or command line: %s", strings.Join(labels, ", "))
+}
+
+// printConfig writes the effective configuration and the source of each value
+func printConfig(w io.Writer, config *AppConfig, sources ConfigSources) {
+	path, err := getConfigFilePath()
+	if err != nil {
+		path = fmt.Sprintf("unavailable (%v)", err)
+	}
+	fmt.Fprintf(w, "Config file: %s\n\n", path)
+
+	values := configValues(config)
+	fields := append([]string{}, configFields...)
+	sort.Strings(fields)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tVALUE\tSOURCE")
+	for _, field := range fields {
+		source := sources[field]
+		switch source {
+		case "environment":
+			source += fmt.Sprintf(" (%s)", configEnvName(field))
+		case "command line":
+			source += fmt.Sprintf(" (--%s)", configFlagName(field))
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", field, values[field], source)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseTestOverrides reads overrides from args and the current environment
+func parseTestOverrides(t *testing.T, args ...string) []ConfigLayer {
+	t.Helper()
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	configFlags := registerConfigFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("parsing %v: %v", args, err)
+	}
+	return readConfigOverrides(configFlags)
+}
+
+func TestConfigOverridesPrecedence(t *testing.T) {
+	t.Setenv("ATTENDANCE_IDLE_TIMEOUT", "45m")
+	t.Setenv("ATTENDANCE_USER_ID", "user-env")
+	t.Setenv("ATTENDANCE_AUTO_MODE", "false")
+	overrides := parseTestOverrides(t, "--user-id", "user-flag", "--check-interval=500ms", "--show-activity-log")
+
+	path := writeTestConfig(t, `{"schema_version": 4, "idle_timeout": "30m", "user_id": "user-file", "device_id": "device-file"}`)
+	config, sources, err := loadConfigFile(path, nil, overrides...)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+
+	checks := []struct {
+		field, source string
+		ok            bool
+	}{
+		{"device_id", configFileSource, config.DeviceID == "device-file"},
+		{"idle_timeout", "environment", config.IdleTimeout == 45*time.Minute},
+		{"auto_mode", "environment", !config.AutoMode},
+		{"user_id", "command line", config.UserID == "user-flag"},
+		{"check_interval", "command line", config.CheckInterval == 500*time.Millisecond},
+		{"show_activity_log", "command line", config.ShowActivityLog},
+		{"run_at_startup", "default", config.RunAtStartup},
+	}
+	for _, check := range checks {
+		if !check.ok {
+			t.Errorf("%s has the wrong value in %+v", check.field, config)
+		}
+		if sources[check.field] != check.source {
+			t.Errorf("%s came from %q, want %q", check.field, sources[check.field], check.source)
+		}
+	}
+}
+
+func TestConfigOverridesCannotBeatLockedPolicy(t *testing.T) {
+	overrides := parseTestOverrides(t, "--auto-mode=false")
+	policies := ConfigPolicies{mustParsePolicy(t, "policy.json", `{"locked": {"auto_mode": true}}`)}
+
+	config, sources, problems := policies.resolve(overrides...)
+	if len(problems) > 0 {
+		t.Fatalf("problems: %v", problems)
+	}
+	if !config.AutoMode || sources["auto_mode"] != "policy.json (locked)" {
+		t.Errorf("auto mode = %t from %q, want locked on by policy.json", config.AutoMode, sources["auto_mode"])
+	}
+}
+
+func TestConfigOverridesReportInvalidEnvironment(t *testing.T) {
+	t.Setenv("ATTENDANCE_CHECK_INTERVAL", "0s")
+	t.Setenv("ATTENDANCE_SHOW_IDLE_TIME", "maybe")
+	overrides := parseTestOverrides(t)
+
+	_, _, err := loadConfigFile(filepath.Join(t.TempDir(), "config.json"), nil, overrides...)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("err = %v, want *ConfigError", err)
+	}
+	if !strings.Contains(err.Error(), "show_idle_time: expected true or false, got string (from environment)") {
+		t.Errorf("error does not name the environment:\n%v", err)
+	}
+}
+
+func TestConfigFlagRejectsInvalidBoolean(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(&bytes.Buffer{})
+	registerConfigFlags(flags)
+	if err := flags.Parse([]string{"--auto-mode=sometimes"}); err == nil {
+		t.Error("invalid boolean flag accepted")
+	}
+}
+
+func TestSaveConfigKeepsOverridesOutOfFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	configFilePath = path
+	defer func() { configFilePath = "" }()
+
+	saved := NewAppConfig()
+	saved.IdleTimeout = 30 * time.Minute
+	if err := saveConfigFile(path, saved); err != nil {
+		t.Fatal(err)
+	}
+
+	configOverrides = parseTestOverrides(t, "--idle-timeout", "5m")
+	defer func() { configOverrides = nil }()
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	config.UserID = "user-changed"
+	if err := saveConfig(config); err != nil {
+		t.Fatalf("saveConfig: %v", err)
+	}
+
+	stored, _, err := loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.IdleTimeout != 30*time.Minute || stored.UserID != "user-changed" {
+		t.Errorf("stored idle timeout %s and user %q, want 30m and user-changed", stored.IdleTimeout, stored.UserID)
+	}
+}
+
+func TestPrintConfigShowsSources(t *testing.T) {
+	config := NewAppConfig()
+	sources := ConfigSources{}
+	for _, field := range configFields {
+		sources[field] = "default"
+	}
+	sources["idle_timeout"] = "environment"
+
+	var out bytes.Buffer
+	printConfig(&out, config, sources)
+
+	for _, want := range []string{"idle_timeout", "20m", "environment (ATTENDANCE_IDLE_TIMEOUT)", "run_at_startup"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
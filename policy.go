@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ConfigPolicy is a set of settings managed by an administrator, either from
+// a system-wide policy file or pushed by the server in an event response:
+//
+//	{
+//	  "defaults": {"idle_timeout": "15m"},
+//	  "locked":   {"server_endpoint": "https://attendance.example.com/api/v1/events", "auto_mode": true}
+//	}
+//
+// Defaults replace the built-in defaults but can still be changed by the
+// user. Locked values always apply and cannot be changed in Settings.
+type ConfigPolicy struct {
+	Source   string                 `json:"-"` // Where the policy came from, for display
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+	Locked   map[string]interface{} `json:"locked,omitempty"`
+}
+
+// ConfigPolicies are the active policies, lowest precedence first.
+//
+// Each config field takes its value from the first of these that sets it:
+//  1. Locked values from the system policy file
+//  2. Locked values from the server policy
+//  3. Command-line flags
+//  4. ATTENDANCE_* environment variables
+//  5. The user's config file (and Settings)
+//  6. Defaults from the system policy file
+//  7. Defaults from the server policy
+//  8. The built-in defaults
+//
+// The system file wins over the server because only a local administrator
+// can write it.
+type ConfigPolicies []*ConfigPolicy
+
+// Source name of the policy pushed by the server
+const serverPolicySource = "server policy"
+
+// getSystemPolicyPath returns the path of the read-only system-wide policy file
+func getSystemPolicyPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "AttendanceTracker", "policy.json")
+	case "darwin":
+		return "/Library/Application Support/AttendanceTracker/policy.json"
+	default:
+		return "/etc/attendance-tracker/policy.json"
+	}
+}
+
+// getServerPolicyPath returns where the last policy pushed by the server is kept
+func getServerPolicyPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// Fallback to temp directory if config dir can't be determined
+		return filepath.Join(os.TempDir(), "attendance-tracker-server-policy.json")
+	}
+	return filepath.Join(configDir, "attendance-tracker", "server-policy.json")
+}
+
+// loadConfigPolicies reads the server and system policies. Invalid policies
+// are logged and skipped.
+func loadConfigPolicies() ConfigPolicies {
+	var policies ConfigPolicies
+	for _, file := range []struct{ path, source string }{
+		{getServerPolicyPath(), serverPolicySource},
+		{getSystemPolicyPath(), getSystemPolicyPath()},
+	} {
+		policy, err := loadPolicyFile(file.path, file.source)
+		if err != nil {
+			logActivity(fmt.Sprintf("Ignoring policy: %v", err))
+			continue
+		}
+		if policy != nil {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
+
+// loadPolicyFile reads the policy at path, returning nil if there is none
+func loadPolicyFile(path, source string) (*ConfigPolicy, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigPolicy(data, source)
+}
+
+// parseConfigPolicy decodes and checks a policy document
+func parseConfigPolicy(data []byte, source string) (*ConfigPolicy, error) {
+	var policy ConfigPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", source, err)
+	}
+	policy.Source = source
+
+	var problems []ConfigProblem
+	for _, values := range []map[string]interface{}{policy.Defaults, policy.Locked} {
+		if _, ok := values["schema_version"]; ok {
+			problems = append(problems, ConfigProblem{Field: "schema_version", Message: "cannot be set by a policy"})
+		}
+		_, valueProblems := decodeConfigValues(NewAppConfig(), values)
+		problems = append(problems, valueProblems...)
+	}
+	if len(problems) > 0 {
+		sortConfigProblems(problems)
+		return nil, &ConfigError{Path: source, Problems: problems}
+	}
+
+	return &policy, nil
+}
+
+// saveServerPolicy stores a policy pushed by the server for later runs
+func saveServerPolicy(policy *ConfigPolicy) error {
+	path := getServerPolicyPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path, data)
+}
+
+// serverPolicy returns the policy pushed by the server, or nil
+func (ps ConfigPolicies) serverPolicy() *ConfigPolicy {
+	for _, p := range ps {
+		if p.Source == serverPolicySource {
+			return p
+		}
+	}
+	return nil
+}
+
+// withServerPolicy returns policies with the server policy replaced by policy
+func (ps ConfigPolicies) withServerPolicy(policy *ConfigPolicy) ConfigPolicies {
+	updated := ConfigPolicies{policy}
+	for _, p := range ps {
+		if p.Source != serverPolicySource {
+			updated = append(updated, p)
+		}
+	}
+	return updated
+}
+
+// LockedBy returns the source of the policy that locks field, or "" if the
+// user may change it
+func (ps ConfigPolicies) LockedBy(field string) string {
+	for i := len(ps) - 1; i >= 0; i-- {
+		if _, ok := ps[i].Locked[field]; ok {
+			return ps[i].Source
+		}
+	}
+	return ""
+}
+
+// LockedFields returns every locked field, sorted
+func (ps ConfigPolicies) LockedFields() []string {
+	var fields []string
+	for _, p := range ps {
+		for field := range p.Locked {
+			if !containsString(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ConfigLayer is one set of user-controlled values, such as the config file,
+// the environment or the command line
+type ConfigLayer struct {
+	Source string // Shown by --print-config and in error messages
+	Values map[string]interface{}
+}
+
+// ConfigSources records where each field's effective value came from
+type ConfigSources map[string]string
+
+// resolve builds the effective config from user layers, lowest precedence
+// first, and the policies, following the order documented on ConfigPolicies.
+// Later layers override earlier ones, but never a locked field.
+func (ps ConfigPolicies) resolve(layers ...ConfigLayer) (*AppConfig, ConfigSources, []ConfigProblem) {
+	config := NewAppConfig()
+	sources := ConfigSources{}
+	for _, field := range configFields {
+		sources[field] = "default"
+	}
+
+	apply := func(source string, values map[string]interface{}) []ConfigProblem {
+		var problems []ConfigProblem
+		config, problems = decodeConfigValues(config, values)
+		for field := range values {
+			sources[field] = source
+		}
+		return problems
+	}
+
+	for _, p := range ps {
+		apply(p.Source+" (default)", p.Defaults)
+	}
+
+	// Locked fields set by the user are ignored rather than reported, as
+	// they may have been saved before the policy existed
+	var problems []ConfigProblem
+	for _, layer := range layers {
+		values := make(map[string]interface{}, len(layer.Values))
+		for key, value := range layer.Values {
+			if ps.LockedBy(key) == "" {
+				values[key] = value
+			}
+		}
+		layerProblems := apply(layer.Source, values)
+		if layer.Source != configFileSource {
+			for i := range layerProblems {
+				layerProblems[i].Message += fmt.Sprintf(" (from %s)", layer.Source)
+			}
+		}
+		problems = append(problems, layerProblems...)
+	}
+
+	for _, p := range ps {
+		apply(p.Source+" (locked)", p.Locked)
+	}
+
+	if len(problems) == 0 {
+		problems = validateConfig(config)
+		for i, problem := range problems {
+			if source := ps.LockedBy(problem.Field); source != "" {
+				problems[i].Message += fmt.Sprintf(" (locked by %s)", source)
+			}
+		}
+	}
+	sortConfigProblems(problems)
+	delete(sources, "schema_version")
+	return config, sources, problems
+}
+
+// describeLockedFields lists the locked fields for display in Settings
+func describeLockedFields(policies ConfigPolicies) string {
+	fields := policies.LockedFields()
+	if len(fields) == 0 {
+		return ""
+	}
+	var labels []string
+	for _, field := range fields {
+		labels = append(labels, configFieldLabel(field))
+	}
+	return fmt.Sprintf("Managed by your organization: %s", strings.Join(labels, ", "))
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
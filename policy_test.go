@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mustParsePolicy parses a policy document or fails the test
+func mustParsePolicy(t *testing.T, source, document string) *ConfigPolicy {
+	t.Helper()
+	policy, err := parseConfigPolicy([]byte(document), source)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", source, err)
+	}
+	return policy
+}
+
+func TestConfigPoliciesPrecedence(t *testing.T) {
+	server := mustParsePolicy(t, serverPolicySource, `{
+		"defaults": {"idle_timeout": "15m", "check_interval": "5s"},
+		"locked": {"auto_mode": false, "server_endpoint": "https://server.example.com/events"}
+	}`)
+	system := mustParsePolicy(t, "policy.json", `{
+		"defaults": {"check_interval": "3s"},
+		"locked": {"server_endpoint": "https://system.example.com/events"}
+	}`)
+	policies := ConfigPolicies{server, system}
+
+	user := map[string]interface{}{
+		"idle_timeout":    "30m",
+		"auto_mode":       true,
+		"server_endpoint": "https://user.example.com/events",
+	}
+	config, _, problems := policies.resolve(ConfigLayer{Source: configFileSource, Values: user})
+	if len(problems) > 0 {
+		t.Fatalf("problems: %v", problems)
+	}
+
+	// The user's value beats policy defaults
+	if config.IdleTimeout != 30*time.Minute {
+		t.Errorf("idle timeout = %s, want the user's 30m", config.IdleTimeout)
+	}
+	// The system file's default beats the server's
+	if config.CheckInterval != 3*time.Second {
+		t.Errorf("check interval = %s, want the system default 3s", config.CheckInterval)
+	}
+	// Locked values beat the user, and the system file beats the server
+	if config.AutoMode {
+		t.Error("auto mode enabled despite being locked off")
+	}
+	if config.ServerEndpoint != "https://system.example.com/events" {
+		t.Errorf("server endpoint = %s, want the system policy's", config.ServerEndpoint)
+	}
+
+	if got := policies.LockedBy("server_endpoint"); got != "policy.json" {
+		t.Errorf("server_endpoint locked by %q, want policy.json", got)
+	}
+	if got := policies.LockedBy("auto_mode"); got != serverPolicySource {
+		t.Errorf("auto_mode locked by %q, want %s", got, serverPolicySource)
+	}
+	if got := policies.LockedBy("idle_timeout"); got != "" {
+		t.Errorf("idle_timeout locked by %q, want unlocked", got)
+	}
+}
+
+func TestConfigPoliciesIgnoreInvalidLockedUserValue(t *testing.T) {
+	policies := ConfigPolicies{mustParsePolicy(t, "policy.json", `{"locked": {"idle_timeout": "10m"}}`)}
+
+	config, _, problems := policies.resolve(ConfigLayer{Source: configFileSource, Values: map[string]interface{}{"idle_timeout": "not a duration"}})
+	if len(problems) > 0 {
+		t.Fatalf("problems for a locked field: %v", problems)
+	}
+	if config.IdleTimeout != 10*time.Minute {
+		t.Errorf("idle timeout = %s, want 10m", config.IdleTimeout)
+	}
+}
+
+func TestParseConfigPolicyRejectsInvalidValues(t *testing.T) {
+	_, err := parseConfigPolicy([]byte(`{"locked": {"idle_timeout": 5, "colour": "blue"}}`), "policy.json")
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 {
+		t.Errorf("err = %v, want problems for idle_timeout and colour", err)
+	}
+}
+
+func TestEventSenderReceivesServerPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok", "config": {"locked": {"auto_mode": false}}}`))
+	}))
+	defer server.Close()
+
+	config := NewAppConfig()
+	config.ServerEndpoint = server.URL
+	sender := NewEventSender(NewSharedConfig(config))
+
+	var received *ConfigPolicy
+	sender.OnPolicy(func(policy *ConfigPolicy) {
+		received = policy
+	})
+
+	if err := sender.Send(NewStatusPayload(config, EventCheckIn, SourceManual, time.Now())); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if received == nil || received.Source != serverPolicySource || received.Locked["auto_mode"] != false {
+		t.Errorf("received policy %+v, want auto_mode locked off", received)
+	}
+}
+
+func TestParseServerPolicyWithoutConfig(t *testing.T) {
+	for _, body := range []string{``, `ok`, `{"status": "ok"}`, `{"config": null}`} {
+		if policy, err := parseServerPolicy([]byte(body)); policy != nil || err != nil {
+			t.Errorf("body %q: policy %+v, err %v, want neither", body, policy, err)
+		}
+	}
+}
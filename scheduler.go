@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Update modes. Administrators turn updates off or force them by locking
+// update_mode in a policy.
+const (
+	UpdateModeOff    = "off"    // Never check for updates
+	UpdateModeNotify = "notify" // Check on a schedule and ask before installing
+	UpdateModeAuto   = "auto"   // Download and install every update without asking
+)
+
+// updateModes lists the update modes in the order Settings shows them
+var updateModes = []string{UpdateModeOff, UpdateModeNotify, UpdateModeAuto}
+
+// isValidUpdateMode reports whether mode is a known update mode
+func isValidUpdateMode(mode string) bool {
+	return containsString(updateModes, mode)
+}
+
+// Timing of scheduled update checks
+const (
+	updateStartupDelay = 5 * time.Second // Lets the UI load before the first check
+	updateCheckJitter  = 0.1             // Fraction of the interval a check moves by at random
+	updateDeferralPoll = time.Minute     // How often a deferred update looks for a chance to interrupt
+)
+
+// Results of an update check
+const (
+	UpdateResultUpToDate   = "up_to_date"
+	UpdateResultAvailable  = "available"
+	UpdateResultDownloaded = "downloaded"
+	UpdateResultFailed     = "failed"
+)
+
+// UpdateStatus records the last update check for the About dialog and for
+// scheduling the next check across restarts
+type UpdateStatus struct {
+	LastChecked   time.Time `json:"last_checked"`
+	Result        string    `json:"result"`                   // One of the UpdateResult constants
+	Version       string    `json:"version,omitempty"`        // Update found, if any
+	Error         string    `json:"error,omitempty"`          // Why the check failed
+	DownloadError string    `json:"download_error,omitempty"` // Why the background download of the update failed
+}
+
+// getUpdateStatusPath returns where the last update check is recorded
+func getUpdateStatusPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		// Fallback to temp directory if config dir can't be determined
+		return filepath.Join(os.TempDir(), "attendance-tracker-update-status.json")
+	}
+	return filepath.Join(configDir, "attendance-tracker", "update-status.json")
+}
+
+// loadUpdateStatus reads the last update check, or returns an empty status
+// if there has been none
+func loadUpdateStatus(path string) UpdateStatus {
+	var status UpdateStatus
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return status
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		logActivity(fmt.Sprintf("Ignoring update status: could not parse %s: %v", path, err))
+		return UpdateStatus{}
+	}
+	return status
+}
+
+// saveUpdateStatus writes status to path
+func saveUpdateStatus(path string, status UpdateStatus) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logActivity(fmt.Sprintf("Error recording update check: %v", err))
+		return
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err == nil {
+		err = writeFileSync(path, data)
+	}
+	if err != nil {
+		logActivity(fmt.Sprintf("Error recording update check: %v", err))
+	}
+}
+
+// recordUpdateCheck records the outcome of a manual or scheduled check
+func recordUpdateCheck(path string, info *UpdateInfo, err error) UpdateStatus {
+	status := UpdateStatus{LastChecked: time.Now(), Result: UpdateResultUpToDate}
+	switch {
+	case err != nil:
+		status.Result = UpdateResultFailed
+		status.Error = err.Error()
+	case info != nil:
+		status.Result = UpdateResultAvailable
+		status.Version = info.Version
+	}
+	saveUpdateStatus(path, status)
+	return status
+}
+
+// describeUpdateStatus formats the last update check for the About dialog
+func describeUpdateStatus(status UpdateStatus, mode string) string {
+	if mode == UpdateModeOff {
+		return "Automatic update checks are turned off"
+	}
+	if status.LastChecked.IsZero() {
+		return "Not checked for updates yet"
+	}
+	checked := fmt.Sprintf("Last checked for updates %s", status.LastChecked.Format("2006-01-02 15:04"))
+	if status.Version != "" && !isVersionNewer(status.Version, Version) {
+		// The update found has since been installed
+		return fmt.Sprintf("%s: up to date", checked)
+	}
+	switch status.Result {
+	case UpdateResultAvailable:
+		if status.DownloadError != "" {
+			return fmt.Sprintf("%s: version %s is available, but could not be downloaded (%s)", checked, status.Version, status.DownloadError)
+		}
+		return fmt.Sprintf("%s: version %s is available", checked, status.Version)
+	case UpdateResultDownloaded:
+		return fmt.Sprintf("%s: version %s is downloaded and ready to install", checked, status.Version)
+	case UpdateResultFailed:
+		return fmt.Sprintf("%s: failed (%s)", checked, status.Error)
+	}
+	return fmt.Sprintf("%s: up to date", checked)
+}
+
+// jitterInterval moves interval by up to updateCheckJitter of it either
+// way, so a fleet of trackers started together does not check at once.
+// r is a random number in [0, 1).
+func jitterInterval(interval time.Duration, r float64) time.Duration {
+	return interval + time.Duration(float64(interval)*updateCheckJitter*(2*r-1))
+}
+
+// UpdateScheduler checks for updates every UpdateInterval, following the
+// config's UpdateMode. Updates are announced at once with OnFound, but
+// anything that interrupts the user waits until they are checked out or
+// idle. Security releases, and every release in auto mode, are downloaded
+// silently first.
+type UpdateScheduler struct {
+	config     *SharedConfig
+	state      *AttendanceStateMachine
+	statusPath string
+	wake       chan struct{}
+
+	// Replaced in tests
+	check func(*AppConfig) (*UpdateInfo, error)
+	fetch func(context.Context, *UpdateInfo, func(DownloadProgress)) (string, error)
+	now   func() time.Time
+	poll  time.Duration
+
+	OnFound   func(info *UpdateInfo)              // An update was found; must not interrupt the user
+	OnPrompt  func(info *UpdateInfo, path string) // Ask whether to install; path is the verified download, or ""
+	OnInstall func(info *UpdateInfo, path string) // Install the verified download at path without asking
+}
+
+// NewUpdateScheduler creates a scheduler for tracker's config. Settings
+// changes reschedule the next check.
+func NewUpdateScheduler(tracker *Tracker) *UpdateScheduler {
+	s := &UpdateScheduler{
+		config:     tracker.config,
+		state:      tracker.State,
+		statusPath: getUpdateStatusPath(),
+		wake:       make(chan struct{}, 1),
+		check:      getLatestReleaseInfo,
+		fetch:      fetchVerifiedUpdate,
+		now:        time.Now,
+		poll:       updateDeferralPoll,
+	}
+	tracker.OnConfigChange(func(*AppConfig) {
+		s.Wake()
+	})
+	return s
+}
+
+// Wake makes the scheduler work out when the next check is due again
+func (s *UpdateScheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks for updates until done is closed
+func (s *UpdateScheduler) Run(done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	for {
+		timer := time.NewTimer(s.nextCheckDelay(rand.Float64()))
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+		if s.config.Load().UpdateMode == UpdateModeOff {
+			continue
+		}
+		s.checkNow(ctx, done)
+	}
+}
+
+// nextCheckDelay returns how long until the next check is due: the jittered
+// interval after the last recorded check, but not before the UI has loaded
+func (s *UpdateScheduler) nextCheckDelay(r float64) time.Duration {
+	config := s.config.Load()
+	interval := jitterInterval(config.UpdateInterval, r)
+	if config.UpdateMode == UpdateModeOff {
+		return interval
+	}
+	status := loadUpdateStatus(s.statusPath)
+	delay := status.LastChecked.Add(interval).Sub(s.now())
+	if delay < updateStartupDelay {
+		delay = updateStartupDelay
+	}
+	return delay
+}
+
+// checkNow checks for an update and hands it on as the update mode says
+func (s *UpdateScheduler) checkNow(ctx context.Context, done <-chan struct{}) {
+	config := s.config.Load()
+	info, err := s.check(config)
+	status := recordUpdateCheck(s.statusPath, info, err)
+	if err != nil {
+		logActivity(fmt.Sprintf("Scheduled update check failed: %v", err))
+		return
+	}
+	if info == nil {
+		return
+	}
+	logActivity(fmt.Sprintf("Update available: %s (current: %s)", info.Version, Version))
+	if s.OnFound != nil {
+		s.OnFound(info)
+	}
+
+	auto := config.UpdateMode == UpdateModeAuto && isSelfInstallable(info.Package)
+	var path string
+	if auto || info.Security {
+		path, err = s.fetch(ctx, info, nil)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The update is still available, and asking lets the user try
+			// the download again
+			logActivity(fmt.Sprintf("Could not download update %s in the background: %v", info.Version, err))
+			status.DownloadError = err.Error()
+			auto, path = false, ""
+		} else {
+			logActivity(fmt.Sprintf("Update %s downloaded and verified in the background", info.Version))
+			status.Result = UpdateResultDownloaded
+		}
+		saveUpdateStatus(s.statusPath, status)
+	}
+
+	if !s.waitUntilAway(done) {
+		return
+	}
+	if auto {
+		if s.OnInstall != nil {
+			s.OnInstall(info, path)
+		}
+	} else if s.OnPrompt != nil {
+		s.OnPrompt(info, path)
+	}
+}
+
+// waitUntilAway blocks until the user is away, returning false if done is
+// closed first
+func (s *UpdateScheduler) waitUntilAway(done <-chan struct{}) bool {
+	if s.userAway() {
+		return true
+	}
+	logActivity("Waiting until you are checked out or idle to continue the update")
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return false
+		case <-ticker.C:
+			if s.userAway() {
+				return true
+			}
+		}
+	}
+}
+
+// userAway reports whether the user can be interrupted: they are checked
+// out, idle or locked, or have been inactive for the idle timeout even
+// though auto mode did not check them out
+func (s *UpdateScheduler) userAway() bool {
+	state, _ := s.state.State()
+	switch state {
+	case StateCheckedOut, StateIdle, StateLocked:
+		return true
+	}
+	return s.state.IdleTime() >= s.config.Load().IdleTimeout
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestScheduler returns a scheduler that finds info and downloads it to
+// a fake path, counting downloads
+func newTestScheduler(t *testing.T, info *UpdateInfo) (*UpdateScheduler, *int) {
+	t.Helper()
+	config := NewSharedConfig(NewAppConfig())
+	fetched := 0
+	s := &UpdateScheduler{
+		config:     config,
+		state:      NewAttendanceStateMachine(config, time.Now()),
+		statusPath: filepath.Join(t.TempDir(), "update-status.json"),
+		wake:       make(chan struct{}, 1),
+		check: func(*AppConfig) (*UpdateInfo, error) {
+			return info, nil
+		},
+		fetch: func(context.Context, *UpdateInfo, func(DownloadProgress)) (string, error) {
+			fetched++
+			return "/tmp/update", nil
+		},
+		now:  time.Now,
+		poll: 10 * time.Millisecond,
+	}
+	return s, &fetched
+}
+
+func TestJitterInterval(t *testing.T) {
+	for _, r := range []float64{0, 0.25, 0.5, 0.999} {
+		got := jitterInterval(24*time.Hour, r)
+		if got < 21*time.Hour+36*time.Minute || got > 26*time.Hour+24*time.Minute {
+			t.Errorf("jitter(24h, %v) = %s, want within 10%%", r, got)
+		}
+	}
+	if got := jitterInterval(time.Hour, 0.5); got != time.Hour {
+		t.Errorf("jitter(1h, 0.5) = %s, want 1h", got)
+	}
+}
+
+func TestNextCheckDelay(t *testing.T) {
+	s, _ := newTestScheduler(t, nil)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// Never checked: shortly after startup
+	if got := s.nextCheckDelay(0.5); got != updateStartupDelay {
+		t.Errorf("first delay = %s, want %s", got, updateStartupDelay)
+	}
+
+	// The interval runs from the recorded check, across restarts
+	saveUpdateStatus(s.statusPath, UpdateStatus{LastChecked: now.Add(-time.Hour), Result: UpdateResultUpToDate})
+	if got := s.nextCheckDelay(0.5); got != 23*time.Hour {
+		t.Errorf("delay after a check an hour ago = %s, want 23h", got)
+	}
+
+	// Overdue checks still wait for startup
+	saveUpdateStatus(s.statusPath, UpdateStatus{LastChecked: now.Add(-72 * time.Hour)})
+	if got := s.nextCheckDelay(0.5); got != updateStartupDelay {
+		t.Errorf("overdue delay = %s, want %s", got, updateStartupDelay)
+	}
+}
+
+func TestUpdateSchedulerModes(t *testing.T) {
+	cases := []struct {
+		name       string
+		mode       string
+		info       UpdateInfo
+		wantFetch  bool
+		wantPrompt bool // Otherwise installed
+		wantResult string
+	}{
+		{"notify", UpdateModeNotify, UpdateInfo{Version: "9.0.0", Package: PackageBinary}, false, true, UpdateResultAvailable},
+		{"security", UpdateModeNotify, UpdateInfo{Version: "9.0.0", Package: PackageBinary, Security: true}, true, true, UpdateResultDownloaded},
+		{"auto", UpdateModeAuto, UpdateInfo{Version: "9.0.0", Package: PackageBinary}, true, false, UpdateResultDownloaded},
+		{"auto package", UpdateModeAuto, UpdateInfo{Version: "9.0.0", Package: PackageDeb}, false, true, UpdateResultAvailable},
+	}
+	for _, c := range cases {
+		s, fetched := newTestScheduler(t, &c.info)
+		config := *s.config.Load()
+		config.UpdateMode = c.mode
+		s.config.Store(&config)
+
+		var prompted, installed string
+		s.OnPrompt = func(info *UpdateInfo, path string) { prompted = info.Version + " " + path }
+		s.OnInstall = func(info *UpdateInfo, path string) { installed = info.Version + " " + path }
+		s.checkNow(context.Background(), make(chan struct{}))
+
+		if (*fetched > 0) != c.wantFetch {
+			t.Errorf("%s: downloaded %d times", c.name, *fetched)
+		}
+		wantPath := ""
+		if c.wantFetch {
+			wantPath = "/tmp/update"
+		}
+		if c.wantPrompt && (prompted != "9.0.0 "+wantPath || installed != "") {
+			t.Errorf("%s: prompted %q, installed %q, want a prompt", c.name, prompted, installed)
+		}
+		if !c.wantPrompt && (installed != "9.0.0 "+wantPath || prompted != "") {
+			t.Errorf("%s: prompted %q, installed %q, want an install", c.name, prompted, installed)
+		}
+		if status := loadUpdateStatus(s.statusPath); status.Result != c.wantResult || status.Version != "9.0.0" {
+			t.Errorf("%s: recorded %+v, want %s", c.name, status, c.wantResult)
+		}
+	}
+}
+
+func TestUpdateSchedulerRecordsFailure(t *testing.T) {
+	s, _ := newTestScheduler(t, nil)
+	s.check = func(*AppConfig) (*UpdateInfo, error) {
+		return nil, errors.New("the update server answered with status 502")
+	}
+	s.OnPrompt = func(*UpdateInfo, string) { t.Error("prompted after a failed check") }
+	s.checkNow(context.Background(), make(chan struct{}))
+
+	status := loadUpdateStatus(s.statusPath)
+	if status.Result != UpdateResultFailed || status.LastChecked.IsZero() {
+		t.Errorf("recorded %+v, want a failure", status)
+	}
+	if got := describeUpdateStatus(status, UpdateModeNotify); got == "" {
+		t.Error("no description of the failed check")
+	}
+}
+
+func TestUpdateSchedulerKeepsUpdateAfterFailedDownload(t *testing.T) {
+	s, _ := newTestScheduler(t, &UpdateInfo{Version: "9.0.0", Package: PackageBinary, Security: true})
+	s.fetch = func(context.Context, *UpdateInfo, func(DownloadProgress)) (string, error) {
+		return "", errors.New("connection reset")
+	}
+	var prompted string
+	s.OnPrompt = func(info *UpdateInfo, path string) { prompted = info.Version + " " + path }
+	s.checkNow(context.Background(), make(chan struct{}))
+
+	if prompted != "9.0.0 " {
+		t.Errorf("prompted %q, want a prompt to download 9.0.0", prompted)
+	}
+	status := loadUpdateStatus(s.statusPath)
+	if status.Result != UpdateResultAvailable || status.Version != "9.0.0" || status.DownloadError != "connection reset" {
+		t.Errorf("recorded %+v, want 9.0.0 available with the download error", status)
+	}
+	if got := describeUpdateStatus(status, UpdateModeNotify); !strings.Contains(got, "9.0.0 is available") {
+		t.Errorf("description %q does not offer the update", got)
+	}
+}
+
+func TestUpdateSchedulerWaitsUntilAway(t *testing.T) {
+	s, _ := newTestScheduler(t, &UpdateInfo{Version: "9.0.0", Package: PackageBinary})
+	if err := s.state.CheckIn(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	prompted := make(chan struct{})
+	s.OnPrompt = func(*UpdateInfo, string) { close(prompted) }
+	done := make(chan struct{})
+	defer close(done)
+	go s.checkNow(context.Background(), done)
+
+	select {
+	case <-prompted:
+		t.Fatal("prompted while checked in")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := s.state.CheckOut(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-prompted:
+	case <-time.After(time.Second):
+		t.Fatal("not prompted after checking out")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Update channels, each of which also receives the releases of the ones
+// before it
+const (
+	ChannelStable  = "stable"
+	ChannelBeta    = "beta"
+	ChannelNightly = "nightly"
+)
+
+// updateChannels lists the channels from most to least stable
+var updateChannels = []string{ChannelStable, ChannelBeta, ChannelNightly}
+
+// SemVer is a parsed Semantic Versioning 2.0 version
+type SemVer struct {
+	Major, Minor, Patch uint64
+	Pre                 []string // Pre-release identifiers, e.g. ["rc", "1"]
+	Build               string   // Build metadata, ignored for precedence
+}
+
+// parseSemVer parses a version such as "1.2.3", "v1.10.0-rc.1" or
+// "1.2.3-beta+exp.sha.5114f85". A missing minor or patch number counts as
+// zero, as older releases were tagged "1.1".
+func parseSemVer(version string) (SemVer, error) {
+	var v SemVer
+	text := strings.TrimPrefix(strings.TrimSpace(version), "v")
+
+	if i := strings.Index(text, "+"); i >= 0 {
+		v.Build = text[i+1:]
+		text = text[:i]
+		if err := checkSemVerIdentifiers(v.Build, false); err != nil {
+			return SemVer{}, fmt.Errorf("invalid version %q: build metadata %v", version, err)
+		}
+	}
+	if i := strings.Index(text, "-"); i >= 0 {
+		pre := text[i+1:]
+		text = text[:i]
+		if err := checkSemVerIdentifiers(pre, true); err != nil {
+			return SemVer{}, fmt.Errorf("invalid version %q: pre-release %v", version, err)
+		}
+		v.Pre = strings.Split(pre, ".")
+	}
+
+	parts := strings.Split(text, ".")
+	if len(parts) > 3 {
+		return SemVer{}, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH", version)
+	}
+	numbers := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := parseSemVerNumber(part)
+		if err != nil {
+			return SemVer{}, fmt.Errorf("invalid version %q: %v", version, err)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// parseSemVerNumber parses a numeric identifier, which may not have
+// leading zeros
+func parseSemVerNumber(part string) (uint64, error) {
+	if part == "" {
+		return 0, errors.New("empty number")
+	}
+	if len(part) > 1 && part[0] == '0' {
+		return 0, fmt.Errorf("%q has a leading zero", part)
+	}
+	n, err := strconv.ParseUint(part, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", part)
+	}
+	return n, nil
+}
+
+// checkSemVerIdentifiers checks dot-separated identifiers of ASCII letters,
+// digits and hyphens. Numeric pre-release identifiers may not have leading
+// zeros.
+func checkSemVerIdentifiers(text string, pre bool) error {
+	for _, id := range strings.Split(text, ".") {
+		if id == "" {
+			return errors.New("has an empty identifier")
+		}
+		numeric := true
+		for _, r := range id {
+			switch {
+			case r >= '0' && r <= '9':
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-':
+				numeric = false
+			default:
+				return fmt.Errorf("%q may only contain letters, digits and hyphens", id)
+			}
+		}
+		if pre && numeric && len(id) > 1 && id[0] == '0' {
+			return fmt.Errorf("%q has a leading zero", id)
+		}
+	}
+	return nil
+}
+
+// String formats the version without a "v" prefix
+func (v SemVer) String() string {
+	text := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		text += "-" + strings.Join(v.Pre, ".")
+	}
+	if v.Build != "" {
+		text += "+" + v.Build
+	}
+	return text
+}
+
+// Compare returns -1, 0 or 1 as v has lower, equal or higher precedence
+// than other. A pre-release comes before its release, and build metadata
+// is ignored.
+func (v SemVer) Compare(other SemVer) int {
+	for _, pair := range [][2]uint64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(v.Pre) == 0 && len(other.Pre) == 0:
+		return 0
+	case len(v.Pre) == 0:
+		return 1
+	case len(other.Pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Pre) && i < len(other.Pre); i++ {
+		if c := compareSemVerIdentifiers(v.Pre[i], other.Pre[i]); c != 0 {
+			return c
+		}
+	}
+	// A longer set of identifiers wins when all before are equal
+	switch {
+	case len(v.Pre) < len(other.Pre):
+		return -1
+	case len(v.Pre) > len(other.Pre):
+		return 1
+	}
+	return 0
+}
+
+// compareSemVerIdentifiers compares pre-release identifiers: numbers
+// numerically and below any alphanumeric identifier, which compare in
+// ASCII order
+func compareSemVerIdentifiers(a, b string) int {
+	aNum, aErr := strconv.ParseUint(a, 10, 64)
+	bNum, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		if aNum < bNum {
+			return -1
+		} else if aNum > bNum {
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Channel returns the update channel a version is published on: nightly
+// for "nightly" and "dev" pre-releases, beta for other pre-releases and
+// stable for releases
+func (v SemVer) Channel() string {
+	if len(v.Pre) == 0 {
+		return ChannelStable
+	}
+	first := strings.ToLower(v.Pre[0])
+	if strings.HasPrefix(first, "nightly") || strings.HasPrefix(first, "dev") {
+		return ChannelNightly
+	}
+	return ChannelBeta
+}
+
+// channelIncludes reports whether subscribers to channel receive releases
+// published on released
+func channelIncludes(channel, released string) bool {
+	return channelRank(released) <= channelRank(channel)
+}
+
+// channelRank orders channels from most to least stable; unknown channels
+// count as stable
+func channelRank(channel string) int {
+	for i, c := range updateChannels {
+		if c == channel {
+			return i
+		}
+	}
+	return 0
+}
+
+// isValidUpdateChannel reports whether channel is a known update channel
+func isValidUpdateChannel(channel string) bool {
+	for _, c := range updateChannels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
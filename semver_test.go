@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestSemVerPrecedence(t *testing.T) {
+	// In increasing precedence, from the SemVer 2.0 specification and our
+	// own tags
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.1.0-test",
+		"v1.1.0",
+		"1.2.0",
+		"1.10.0-rc1",
+		"1.10.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, err := parseSemVer(ordered[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := parseSemVer(ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := a.Compare(b); got != want {
+				t.Errorf("compare(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	// Older tags leave out the patch number, and build metadata is ignored
+	for _, pair := range [][2]string{{"1.1", "v1.1.0"}, {"1.0.0+build.1", "1.0.0+build.2"}} {
+		a, _ := parseSemVer(pair[0])
+		b, _ := parseSemVer(pair[1])
+		if a.Compare(b) != 0 {
+			t.Errorf("compare(%s, %s) = %d, want 0", pair[0], pair[1], a.Compare(b))
+		}
+	}
+}
+
+func TestParseSemVerRejects(t *testing.T) {
+	for _, version := range []string{"", "1.01.0", "1.0.0-01", "1.0.0-", "1.0.0-a..b", "1.0.0.0", "1.x.0", "1.0.0+b_1"} {
+		if v, err := parseSemVer(version); err == nil {
+			t.Errorf("parseSemVer(%q) = %v, want an error", version, v)
+		}
+	}
+}
+
+func TestSemVerChannel(t *testing.T) {
+	cases := map[string]string{
+		"1.2.0":                ChannelStable,
+		"1.2.0+20240101":       ChannelStable,
+		"1.2.0-beta.1":         ChannelBeta,
+		"1.2.0-rc.2":           ChannelBeta,
+		"1.2.0-nightly.202405": ChannelNightly,
+		"1.2.0-dev":            ChannelNightly,
+	}
+	for version, want := range cases {
+		v, _ := parseSemVer(version)
+		if got := v.Channel(); got != want {
+			t.Errorf("%s: channel = %s, want %s", version, got, want)
+		}
+	}
+}
+
+func TestChooseGitHubRelease(t *testing.T) {
+	releases := []githubRelease{
+		{TagName: "v1.0.1"},
+		{TagName: "v1.1.0"},
+		{TagName: "v1.2.0-beta.1", Prerelease: true},
+		{TagName: "v1.2.0-rc1", Prerelease: true},
+		{TagName: "v1.3.0-nightly.5", Prerelease: true},
+		{TagName: "v1.4.0", Draft: true},
+		{TagName: "v1.2.0-preview", Prerelease: false},
+	}
+	cases := []struct {
+		name   string
+		config AppConfig
+		want   string
+	}{
+		{"stable", AppConfig{UpdateChannel: ChannelStable}, "1.1.0"},
+		{"beta", AppConfig{UpdateChannel: ChannelBeta}, "1.2.0-rc1"},
+		{"nightly", AppConfig{UpdateChannel: ChannelNightly}, "1.3.0-nightly.5"},
+		{"skipped", AppConfig{UpdateChannel: ChannelStable, SkippedVersion: "1.1.0"}, "1.0.1"},
+		{"pinned", AppConfig{UpdateChannel: ChannelStable, PinnedVersion: "v1.2.0-beta.1"}, "1.2.0-beta.1"},
+		{"pinned older", AppConfig{UpdateChannel: ChannelStable, PinnedVersion: "0.9.0"}, ""},
+		{"all skipped", AppConfig{UpdateChannel: ChannelStable, PinnedVersion: "1.0.1", SkippedVersion: "1.0.1"}, ""},
+	}
+	for _, c := range cases {
+		_, got, ok := chooseGitHubRelease(releases, &c.config)
+		if ok != (c.want != "") || got != c.want {
+			t.Errorf("%s: chose %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Accepted ranges for the timing settings
+const (
+	minIdleTimeout    = 10 * time.Second
+	maxIdleTimeout    = 8 * time.Hour
+	minCheckInterval  = 100 * time.Millisecond
+	maxCheckInterval  = 60 * time.Second
+	minUpdateInterval = 15 * time.Minute
+	maxUpdateInterval = 30 * 24 * time.Hour
+)
+
+// How long the connection test waits for the server
+const serverTestTimeout = 5 * time.Second
+
+// Names of the config fields as shown in Settings
+var configFieldLabels = map[string]string{
+	"server_endpoint":        "Server URL",
+	"device_id":              "Device ID",
+	"user_id":                "User ID",
+	"idle_timeout":           "Idle timeout",
+	"check_interval":         "Check interval",
+	"bind_device_to_machine": "Bind device ID to this computer",
+	"update_channel":         "Update channel",
+	"pinned_version":         "Pinned version",
+	"skipped_version":        "Skipped version",
+	"update_mode":            "Updates",
+	"update_check_interval":  "Update check interval",
+}
+
+// validateConfig checks every field and returns one problem per invalid field
+func validateConfig(config *AppConfig) []ConfigProblem {
+	var problems []ConfigProblem
+
+	if err := validateServerEndpoint(config.ServerEndpoint); err != nil {
+		problems = append(problems, ConfigProblem{"server_endpoint", err.Error()})
+	}
+	if strings.TrimSpace(config.UserID) == "" {
+		problems = append(problems, ConfigProblem{"user_id", "must not be empty"})
+	}
+	if strings.TrimSpace(config.DeviceID) == "" {
+		problems = append(problems, ConfigProblem{"device_id", "must not be empty"})
+	}
+	if problem := validateDuration(config.IdleTimeout, minIdleTimeout, maxIdleTimeout); problem != "" {
+		problems = append(problems, ConfigProblem{"idle_timeout", problem})
+	}
+	if problem := validateDuration(config.CheckInterval, minCheckInterval, maxCheckInterval); problem != "" {
+		problems = append(problems, ConfigProblem{"check_interval", problem})
+	} else if config.CheckInterval >= config.IdleTimeout {
+		problems = append(problems, ConfigProblem{"check_interval", "must be shorter than the idle timeout"})
+	}
+	if !isValidUpdateChannel(config.UpdateChannel) {
+		problems = append(problems, ConfigProblem{"update_channel", fmt.Sprintf("must be one of %s", strings.Join(updateChannels, ", "))})
+	}
+	if !isValidUpdateMode(config.UpdateMode) {
+		problems = append(problems, ConfigProblem{"update_mode", fmt.Sprintf("must be one of %s", strings.Join(updateModes, ", "))})
+	}
+	if problem := validateDuration(config.UpdateInterval, minUpdateInterval, maxUpdateInterval); problem != "" {
+		problems = append(problems, ConfigProblem{"update_check_interval", problem})
+	}
+	for _, field := range []struct{ name, version string }{
+		{"pinned_version", config.PinnedVersion},
+		{"skipped_version", config.SkippedVersion},
+	} {
+		if field.version == "" {
+			continue
+		}
+		if _, err := parseSemVer(field.version); err != nil {
+			problems = append(problems, ConfigProblem{field.name, "must be empty or a version such as 1.2.0"})
+		}
+	}
+
+	return problems
+}
+
+// validateDuration checks that d lies within [min, max]. Zero and negative
+// values are called out, as they would make the polling loop spin.
+func validateDuration(d, min, max time.Duration) string {
+	if d <= 0 {
+		return "must be greater than zero"
+	}
+	if d < min || d > max {
+		return fmt.Sprintf("must be between %s and %s", formatConfigDuration(min), formatConfigDuration(max))
+	}
+	return ""
+}
+
+// configFieldLabel returns the Settings label for a config field
+func configFieldLabel(field string) string {
+	if label, ok := configFieldLabels[field]; ok {
+		return label
+	}
+	return field
+}
+
+// describeConfigProblem formats a problem using the field's Settings label
+func describeConfigProblem(problem ConfigProblem) string {
+	return fmt.Sprintf("%s: %s", configFieldLabel(problem.Field), problem.Message)
+}
+
+// validateServerEndpoint checks that endpoint is an absolute http(s) URL
+func validateServerEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("must start with http:// or https://")
+	}
+	if u.Host == "" {
+		return errors.New("must include a host name")
+	}
+	return nil
+}
+
+// checkServerReachable tests whether the server answers at endpoint.
+// Any HTTP response counts, as the events endpoint only accepts POSTs.
+func checkServerReachable(endpoint string) error {
+	if err := validateServerEndpoint(endpoint); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("HEAD", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "AttendanceTracker/"+Version)
+
+	client := &http.Client{Timeout: serverTestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// applySettings saves config and makes the running tracker use it
+func applySettings(tracker *Tracker, config *AppConfig) error {
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("could not save settings: %v", err)
+	}
+
+	previous := tracker.CurrentConfig()
+	runAtStartupChanged := config.RunAtStartup != previous.RunAtStartup
+	previousDeviceID := previous.DeviceID
+	developerMode = config.DeveloperMode
+	tracker.ApplyConfig(config)
+
+	if config.DeviceID != previousDeviceID {
+		tracker.announceDeviceChange(previousDeviceID, SourceManual, "changed in settings")
+	}
+
+	if runAtStartupChanged {
+		if err := setupAutostart(config.RunAtStartup); err != nil {
+			return fmt.Errorf("settings saved, but run at startup could not be changed: %v", err)
+		}
+	}
+	return nil
+}
+
+// settingsForm edits a copy of the tracker's configuration.
+// Nothing changes until Apply; Cancel restores the current values.
+type settingsForm struct {
+	window  fyne.Window
+	tracker *Tracker
+
+	endpoint      *widget.Entry
+	userID        *widget.Entry
+	deviceID      *widget.Entry
+	idleTimeout   *widget.Entry
+	checkInterval *widget.Entry
+	autoMode      *widget.Check
+	runAtStartup  *widget.Check
+	showIdleTime  *widget.Check
+	showLog       *widget.Check
+	developer     *widget.Check
+	bindDevice    *widget.Check
+	channel       *widget.Select
+	pinned        *widget.Entry
+	skipped       *widget.Entry
+	updateMode    *widget.Select
+	updateEvery   *widget.Entry
+
+	fields      map[string]fyne.Disableable // Widget for each config field
+	lockedLabel *widget.Label
+
+	accountLabel  *widget.Label
+	signInButton  *widget.Button
+	signOutButton *widget.Button
+}
+
+// newSettingsForm creates the settings form filled from the tracker's configuration
+func newSettingsForm(w fyne.Window, tracker *Tracker) *settingsForm {
+	f := &settingsForm{
+		window:        w,
+		tracker:       tracker,
+		endpoint:      widget.NewEntry(),
+		userID:        widget.NewEntry(),
+		deviceID:      widget.NewEntry(),
+		idleTimeout:   newDurationEntry("e.g. 20m or 90s"),
+		checkInterval: newDurationEntry("e.g. 2s or 500ms"),
+		autoMode:      widget.NewCheck("Check in and out automatically", nil),
+		runAtStartup:  widget.NewCheck("Run at startup", nil),
+		showIdleTime:  widget.NewCheck("Show idle time", nil),
+		showLog:       widget.NewCheck("Show activity log", nil),
+		developer:     widget.NewCheck("Developer mode", nil),
+		bindDevice:    widget.NewCheck("Bind device ID to this computer", nil),
+		channel:       widget.NewSelect(updateChannels, nil),
+		pinned:        widget.NewEntry(),
+		skipped:       widget.NewEntry(),
+		updateMode:    widget.NewSelect(updateModes, nil),
+		updateEvery:   widget.NewEntry(),
+	}
+	f.fields = map[string]fyne.Disableable{
+		"server_endpoint":        f.endpoint,
+		"user_id":                f.userID,
+		"device_id":              f.deviceID,
+		"idle_timeout":           f.idleTimeout,
+		"check_interval":         f.checkInterval,
+		"auto_mode":              f.autoMode,
+		"run_at_startup":         f.runAtStartup,
+		"show_idle_time":         f.showIdleTime,
+		"show_activity_log":      f.showLog,
+		"developer_mode":         f.developer,
+		"bind_device_to_machine": f.bindDevice,
+		"update_channel":         f.channel,
+		"pinned_version":         f.pinned,
+		"skipped_version":        f.skipped,
+		"update_mode":            f.updateMode,
+		"update_check_interval":  f.updateEvery,
+	}
+	f.pinned.SetPlaceHolder("None, follow the channel")
+	f.skipped.SetPlaceHolder("None")
+	f.lockedLabel = widget.NewLabel("")
+	f.lockedLabel.Wrapping = fyne.TextWrapWord
+	f.accountLabel = widget.NewLabel("")
+	f.accountLabel.Wrapping = fyne.TextWrapWord
+	f.signInButton = widget.NewButton("Sign In...", f.signIn)
+	f.signOutButton = widget.NewButton("Sign Out", f.signOut)
+
+	f.load(tracker.CurrentConfig())
+	return f
+}
+
+// newDurationEntry creates an entry for a duration string
+func newDurationEntry(placeholder string) *widget.Entry {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder(placeholder)
+	return entry
+}
+
+// load fills the form from config
+func (f *settingsForm) load(config *AppConfig) {
+	f.endpoint.SetText(config.ServerEndpoint)
+	f.userID.SetText(config.UserID)
+	f.deviceID.SetText(config.DeviceID)
+	f.idleTimeout.SetText(formatConfigDuration(config.IdleTimeout))
+	f.checkInterval.SetText(formatConfigDuration(config.CheckInterval))
+	f.autoMode.SetChecked(config.AutoMode)
+	f.runAtStartup.SetChecked(config.RunAtStartup)
+	f.showIdleTime.SetChecked(config.ShowIdleTime)
+	f.showLog.SetChecked(config.ShowActivityLog)
+	f.developer.SetChecked(config.DeveloperMode)
+	f.bindDevice.SetChecked(config.BindDevice)
+	f.channel.SetSelected(config.UpdateChannel)
+	f.pinned.SetText(config.PinnedVersion)
+	f.skipped.SetText(config.SkippedVersion)
+	f.updateMode.SetSelected(config.UpdateMode)
+	f.updateEvery.SetText(formatConfigDuration(config.UpdateInterval))
+
+	// Fields locked by an admin policy or overridden at startup are shown
+	// but cannot be edited
+	policies := f.tracker.Policies()
+	for field, w := range f.fields {
+		if policies.LockedBy(field) != "" || overriddenBy(field) != "" {
+			w.Disable()
+		} else {
+			w.Enable()
+		}
+	}
+
+	var notes []string
+	for _, note := range []string{describeLockedFields(policies), describeOverriddenFields(policies)} {
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+	f.lockedLabel.SetText(strings.Join(notes, "\n"))
+	if f.lockedLabel.Text == "" {
+		f.lockedLabel.Hide()
+	} else {
+		f.lockedLabel.Show()
+	}
+
+	f.refreshAccount()
+}
+
+// refreshAccount shows whether the device is signed in to the configured server
+func (f *settingsForm) refreshAccount() {
+	credentials := f.tracker.Credentials()
+	f.accountLabel.SetText(describeCredentials(credentials, f.tracker.CurrentConfig().ServerEndpoint, f.tracker.Keyring))
+	if credentials == nil {
+		f.signInButton.SetText("Sign In...")
+		f.signOutButton.Disable()
+	} else {
+		f.signInButton.SetText("Sign In Again...")
+		f.signOutButton.Enable()
+	}
+}
+
+// newDeviceID re-enrolls the device under a new random ID after confirmation
+func (f *settingsForm) newDeviceID() {
+	dialog.ShowConfirm("New Device ID",
+		fmt.Sprintf("Replace the device ID %s with a new random one?\n\nThe server is told the old and new IDs, so its records can be linked.", f.tracker.CurrentConfig().DeviceID),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			id, err := f.tracker.ReenrollDevice(SourceManual, "reset by user")
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("could not change the device ID: %v", err), f.window)
+				return
+			}
+			dialog.ShowInformation("New Device ID", fmt.Sprintf("This device is now %s.", id), f.window)
+		}, f.window)
+}
+
+// signIn asks for the user's password or enrollment code and enrolls the
+// device with the saved server URL
+func (f *settingsForm) signIn() {
+	password := widget.NewPasswordEntry()
+	password.SetPlaceHolder("Password or enrollment code")
+
+	config := f.tracker.CurrentConfig()
+	items := []*widget.FormItem{
+		widget.NewFormItem("Server", widget.NewLabel(serverOrigin(config.ServerEndpoint))),
+		widget.NewFormItem("User ID", widget.NewLabel(config.UserID)),
+		widget.NewFormItem("Password", password),
+	}
+	dialog.ShowForm("Sign In", "Sign In", "Cancel", items, func(ok bool) {
+		if !ok || password.Text == "" {
+			return
+		}
+		progress := dialog.NewCustomWithoutButtons("Signing In",
+			widget.NewLabel(fmt.Sprintf("Contacting %s...", serverOrigin(f.tracker.CurrentConfig().ServerEndpoint))), f.window)
+		progress.Show()
+
+		go func() {
+			err := f.tracker.SignIn(password.Text)
+			progress.Hide()
+			f.refreshAccount()
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("could not sign in: %v", err), f.window)
+				return
+			}
+			dialog.ShowInformation("Signed In", "Events are now sent with your credentials.", f.window)
+		}()
+	}, f.window)
+}
+
+// signOut removes the stored credentials after confirmation
+func (f *settingsForm) signOut() {
+	dialog.ShowConfirm("Sign Out",
+		"Remove the stored credentials? Events will be sent without authentication and may be refused by the server.",
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := f.tracker.SignOut(); err != nil {
+				dialog.ShowError(err, f.window)
+			}
+			f.refreshAccount()
+		}, f.window)
+}
+
+// read builds a configuration from the form, returning every invalid field
+func (f *settingsForm) read() (*AppConfig, []string) {
+	config := *f.tracker.CurrentConfig()
+	var problems []string
+
+	config.ServerEndpoint = strings.TrimSpace(f.endpoint.Text)
+	config.UserID = strings.TrimSpace(f.userID.Text)
+	config.DeviceID = strings.TrimSpace(f.deviceID.Text)
+
+	if d, err := time.ParseDuration(strings.TrimSpace(f.idleTimeout.Text)); err != nil {
+		problems = append(problems, "Idle timeout: must be a duration such as 20m or 90s")
+	} else {
+		config.IdleTimeout = d
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(f.checkInterval.Text)); err != nil {
+		problems = append(problems, "Check interval: must be a duration such as 2s or 500ms")
+	} else {
+		config.CheckInterval = d
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(f.updateEvery.Text)); err != nil {
+		problems = append(problems, "Update check interval: must be a duration such as 24h or 30m")
+	} else {
+		config.UpdateInterval = d
+	}
+
+	config.AutoMode = f.autoMode.Checked
+	config.RunAtStartup = f.runAtStartup.Checked
+	config.ShowIdleTime = f.showIdleTime.Checked
+	config.ShowActivityLog = f.showLog.Checked
+	config.DeveloperMode = f.developer.Checked
+	config.BindDevice = f.bindDevice.Checked
+	config.UpdateChannel = f.channel.Selected
+	config.PinnedVersion = strings.TrimSpace(f.pinned.Text)
+	config.SkippedVersion = strings.TrimSpace(f.skipped.Text)
+	config.UpdateMode = f.updateMode.Selected
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	for _, problem := range validateConfig(&config) {
+		problems = append(problems, describeConfigProblem(problem))
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return &config, nil
+}
+
+// testConnection checks the entered server URL and reports the outcome
+func (f *settingsForm) testConnection() {
+	endpoint := strings.TrimSpace(f.endpoint.Text)
+	progress := dialog.NewCustomWithoutButtons("Testing Connection",
+		widget.NewLabel(fmt.Sprintf("Contacting %s...", endpoint)), f.window)
+	progress.Show()
+
+	go func() {
+		err := checkServerReachable(endpoint)
+		progress.Hide()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("server unreachable: %v", err), f.window)
+			return
+		}
+		dialog.ShowInformation("Connection OK", "The server is reachable.", f.window)
+	}()
+}
+
+// apply validates the form and applies it. A new server URL is tested
+// first, and saving an unreachable one needs confirmation.
+func (f *settingsForm) apply() {
+	config, problems := f.read()
+	if len(problems) > 0 {
+		dialog.ShowError(errors.New(strings.Join(problems, "\n")), f.window)
+		return
+	}
+
+	save := func() {
+		if err := applySettings(f.tracker, config); err != nil {
+			dialog.ShowError(err, f.window)
+			return
+		}
+		logActivity("Settings saved")
+		dialog.ShowInformation("Settings", "Settings saved.", f.window)
+	}
+
+	if config.ServerEndpoint == f.tracker.CurrentConfig().ServerEndpoint {
+		save()
+		return
+	}
+
+	go func() {
+		err := checkServerReachable(config.ServerEndpoint)
+		if err == nil {
+			save()
+			return
+		}
+		dialog.ShowConfirm("Server Unreachable",
+			fmt.Sprintf("%s could not be reached:\n%v\n\nSave anyway? Events will be queued until it is reachable.", config.ServerEndpoint, err),
+			func(ok bool) {
+				if ok {
+					save()
+				}
+			}, f.window)
+	}()
+}
+
+// content lays out the form with its Apply and Cancel buttons
+func (f *settingsForm) content() fyne.CanvasObject {
+	testButton := widget.NewButton("Test Connection", f.testConnection)
+	newIDButton := widget.NewButton("New ID...", f.newDeviceID)
+
+	form := widget.NewForm(
+		widget.NewFormItem("Server URL", container.NewBorder(nil, nil, nil, testButton, f.endpoint)),
+		widget.NewFormItem("User ID", f.userID),
+		widget.NewFormItem("Device ID", container.NewBorder(nil, nil, nil, newIDButton, f.deviceID)),
+		widget.NewFormItem("Idle timeout", f.idleTimeout),
+		widget.NewFormItem("Check interval", f.checkInterval),
+		widget.NewFormItem("Updates", f.updateMode),
+		widget.NewFormItem("Update check interval", f.updateEvery),
+		widget.NewFormItem("Update channel", f.channel),
+		widget.NewFormItem("Pinned version", f.pinned),
+		widget.NewFormItem("Skipped version", f.skipped),
+	)
+
+	applyButton := widget.NewButton("Apply", f.apply)
+	applyButton.Importance = widget.HighImportance
+	cancelButton := widget.NewButton("Cancel", func() {
+		f.load(f.tracker.CurrentConfig())
+	})
+
+	return container.NewVBox(
+		f.lockedLabel,
+		form,
+		f.autoMode,
+		f.runAtStartup,
+		f.showIdleTime,
+		f.showLog,
+		f.developer,
+		f.bindDevice,
+		widget.NewSeparator(),
+		container.NewHBox(layout.NewSpacer(), cancelButton, applyButton),
+		widget.NewSeparator(),
+		widget.NewLabelWithStyle("Account", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		f.accountLabel,
+		container.NewHBox(f.signInButton, f.signOutButton),
+	)
+}
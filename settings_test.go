@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestValidateConfigAcceptsDefaults(t *testing.T) {
+	if problems := validateConfig(NewAppConfig()); len(problems) > 0 {
+		t.Errorf("default config rejected: %v", problems)
+	}
+}
+
+func TestValidateConfigListsEveryProblem(t *testing.T) {
+	config := NewAppConfig()
+	config.ServerEndpoint = "ftp://example.com/events"
+	config.UserID = " "
+	config.IdleTimeout = 0
+	config.CheckInterval = 5 * time.Minute
+
+	problems := validateConfig(config)
+	for _, field := range []string{"server_endpoint", "user_id", "idle_timeout", "check_interval"} {
+		found := false
+		for _, problem := range problems {
+			if problem.Field == field {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no problem reported for %s in %v", field, problems)
+		}
+	}
+	if len(problems) != 4 {
+		t.Errorf("got %d problems, want 4: %v", len(problems), problems)
+	}
+}
+
+func TestValidateConfigCheckIntervalBelowIdleTimeout(t *testing.T) {
+	config := NewAppConfig()
+	config.IdleTimeout = time.Minute
+	config.CheckInterval = time.Minute
+
+	problems := validateConfig(config)
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "shorter than the idle timeout") {
+		t.Errorf("problems = %v, want check interval shorter than idle timeout", problems)
+	}
+}
+
+func TestValidateConfigRejectsNonPositiveDurations(t *testing.T) {
+	config := NewAppConfig()
+	config.IdleTimeout = -time.Minute
+	config.CheckInterval = 0
+
+	problems := validateConfig(config)
+	if len(problems) != 2 {
+		t.Fatalf("problems = %v, want both timing fields rejected", problems)
+	}
+	for _, problem := range problems {
+		if problem.Message != "must be greater than zero" {
+			t.Errorf("%s: %q, want must be greater than zero", problem.Field, problem.Message)
+		}
+	}
+}
+
+func TestCheckServerReachable(t *testing.T) {
+	// Any response counts, even one rejecting the method
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	endpoint := server.URL + "/api/v1/events"
+
+	if err := checkServerReachable(endpoint); err != nil {
+		t.Errorf("reachable server reported as unreachable: %v", err)
+	}
+
+	server.Close()
+	if err := checkServerReachable(endpoint); err == nil {
+		t.Error("closed server reported as reachable")
+	}
+
+	if err := checkServerReachable("not a url"); err == nil {
+		t.Error("invalid URL reported as reachable")
+	}
+}
+
+func TestSettingsFormReadsEveryField(t *testing.T) {
+	test.NewApp()
+	config := NewSharedConfig(NewAppConfig())
+	f := newSettingsForm(nil, &Tracker{Sender: NewEventSender(config), config: config})
+
+	f.channel.SetSelected(ChannelBeta)
+	f.updateMode.SetSelected(UpdateModeAuto)
+	f.updateEvery.SetText("12h")
+	f.autoMode.SetChecked(false)
+
+	got, problems := f.read()
+	if len(problems) > 0 {
+		t.Fatalf("read() problems: %v", problems)
+	}
+	if got.UpdateChannel != ChannelBeta || got.UpdateMode != UpdateModeAuto || got.UpdateInterval != 12*time.Hour || got.AutoMode {
+		t.Errorf("read() = %+v, want the beta channel, auto updates every 12h and no auto mode", got)
+	}
+}
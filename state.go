@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AttendanceState is the user's current attendance status
+type AttendanceState string
+
+// Attendance states tracked by the state machine
+const (
+	StateCheckedOut AttendanceState = "checked_out"
+	StateCheckedIn  AttendanceState = "checked_in"
+	StateIdle       AttendanceState = "idle"
+	StateOnBreak    AttendanceState = "on_break"
+	StateLocked     AttendanceState = "locked"
+)
+
+// Transition records a change of attendance state and the event it produces
+type Transition struct {
+	From   AttendanceState
+	To     AttendanceState
+	Event  string    // Event type sent to the server
+	Source string    // SourceManual or SourceAuto
+	At     time.Time // When the change actually happened
+}
+
+// AttendanceStateMachine turns activity samples into attendance transitions.
+//
+//	checked_out --activity--> checked_in   (check_in)
+//	checked_in  --idle > IdleTimeout--> idle (check_out, back-dated)
+//	checked_in  --session locked--> locked   (check_out, back-dated)
+//	idle/locked --activity--> checked_in   (check_in)
+//	checked_in  --break--> on_break         (idle)
+//	on_break    --resume--> checked_in      (active)
+//
+// Automatic transitions only happen when AutoMode is enabled. Check-outs
+// are dated to when activity actually stopped, not when the timeout fired.
+// A manual check-out holds auto mode off until the user checks in again
+// or a new day starts.
+type AttendanceStateMachine struct {
+	config *SharedConfig
+
+	mu        sync.Mutex
+	state     AttendanceState
+	since     time.Time
+	idle      time.Duration
+	hold      bool
+	holdDay   string
+	worked    time.Duration
+	workedDay string
+	listeners []func(Transition)
+}
+
+// NewAttendanceStateMachine creates a state machine starting checked out at now
+func NewAttendanceStateMachine(config *SharedConfig, now time.Time) *AttendanceStateMachine {
+	return &AttendanceStateMachine{
+		config: config,
+		state:  StateCheckedOut,
+		since:  now,
+	}
+}
+
+// OnTransition registers a callback invoked for every state change
+func (sm *AttendanceStateMachine) OnTransition(listener func(Transition)) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.listeners = append(sm.listeners, listener)
+}
+
+// State returns the current state and when it was entered
+func (sm *AttendanceStateMachine) State() (AttendanceState, time.Time) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.state, sm.since
+}
+
+// IdleTime returns the idle time from the most recent activity sample
+func (sm *AttendanceStateMachine) IdleTime() time.Duration {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.idle
+}
+
+// WorkedToday returns the time spent checked in since midnight
+func (sm *AttendanceStateMachine) WorkedToday(now time.Time) time.Duration {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var worked time.Duration
+	if sm.workedDay == now.Format("2006-01-02") {
+		worked = sm.worked
+	}
+	if sm.state == StateCheckedIn {
+		worked += now.Sub(laterOf(sm.since, startOfDay(now)))
+	}
+	return worked
+}
+
+// SeedWorked sets the time already worked on day, e.g. from earlier runs
+func (sm *AttendanceStateMachine) SeedWorked(day string, worked time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.worked = worked
+	sm.workedDay = day
+}
+
+// Update feeds one activity sample into the state machine.
+// idle is how long the system has been without input at time now.
+func (sm *AttendanceStateMachine) Update(now time.Time, idle time.Duration, locked bool) {
+	sm.mu.Lock()
+	sm.idle = idle
+	config := sm.config.Load()
+	if !config.AutoMode {
+		sm.mu.Unlock()
+		return
+	}
+
+	// Activity happened since the previous sample
+	active := idle < config.CheckInterval && !locked
+	// The moment input stopped (or resumed, when active)
+	lastInput := now.Add(-idle)
+
+	// A manual check-out only holds until the next day
+	if sm.hold && sm.holdDay != now.Format("2006-01-02") {
+		sm.hold = false
+	}
+
+	var transition *Transition
+	switch sm.state {
+	case StateCheckedOut, StateIdle, StateLocked:
+		if active && !sm.hold {
+			transition = sm.enter(StateCheckedIn, EventCheckIn, SourceAuto, lastInput)
+		} else if locked && sm.state == StateIdle {
+			transition = sm.enter(StateLocked, "", SourceAuto, sm.since)
+		}
+
+	case StateCheckedIn:
+		if locked {
+			transition = sm.enter(StateLocked, EventCheckOut, SourceAuto, lastInput)
+		} else if idle >= config.IdleTimeout {
+			transition = sm.enter(StateIdle, EventCheckOut, SourceAuto, lastInput)
+		}
+
+	case StateOnBreak:
+		// Breaks only end when the user resumes
+	}
+	sm.mu.Unlock()
+
+	sm.emit(transition)
+}
+
+// CheckIn manually checks the user in
+func (sm *AttendanceStateMachine) CheckIn(now time.Time) error {
+	sm.mu.Lock()
+	if sm.state == StateCheckedIn || sm.state == StateOnBreak {
+		state := sm.state
+		sm.mu.Unlock()
+		return fmt.Errorf("already checked in (%s)", state)
+	}
+	sm.hold = false
+	transition := sm.enter(StateCheckedIn, EventCheckIn, SourceManual, now)
+	sm.mu.Unlock()
+
+	sm.emit(transition)
+	return nil
+}
+
+// CheckOut manually checks the user out and pauses auto check-in for the day
+func (sm *AttendanceStateMachine) CheckOut(now time.Time) error {
+	sm.mu.Lock()
+	if sm.state == StateCheckedOut {
+		sm.mu.Unlock()
+		return fmt.Errorf("already checked out")
+	}
+
+	// Idle and locked sessions were already checked out on the server
+	event := EventCheckOut
+	if sm.state == StateIdle || sm.state == StateLocked {
+		event = ""
+	}
+	sm.hold = true
+	sm.holdDay = now.Format("2006-01-02")
+	transition := sm.enter(StateCheckedOut, event, SourceManual, now)
+	sm.mu.Unlock()
+
+	sm.emit(transition)
+	return nil
+}
+
+// Stop checks the user out because the tracker is shutting down.
+// Unlike a manual check-out this does not hold auto mode off.
+func (sm *AttendanceStateMachine) Stop(now time.Time) {
+	sm.mu.Lock()
+	var transition *Transition
+	if sm.state == StateCheckedIn || sm.state == StateOnBreak {
+		transition = sm.enter(StateCheckedOut, EventCheckOut, SourceAuto, now)
+	}
+	sm.mu.Unlock()
+
+	sm.emit(transition)
+}
+
+// Toggle checks the user out if they are working, otherwise checks them in
+func (sm *AttendanceStateMachine) Toggle(now time.Time) error {
+	state, _ := sm.State()
+	if state == StateCheckedIn || state == StateOnBreak {
+		return sm.CheckOut(now)
+	}
+	return sm.CheckIn(now)
+}
+
+// StartBreak pauses idle tracking without closing the session
+func (sm *AttendanceStateMachine) StartBreak(now time.Time) error {
+	sm.mu.Lock()
+	if sm.state != StateCheckedIn {
+		state := sm.state
+		sm.mu.Unlock()
+		return fmt.Errorf("cannot start a break while %s", state)
+	}
+	transition := sm.enter(StateOnBreak, EventIdle, SourceManual, now)
+	sm.mu.Unlock()
+
+	sm.emit(transition)
+	return nil
+}
+
+// EndBreak resumes the session after a break
+func (sm *AttendanceStateMachine) EndBreak(now time.Time) error {
+	sm.mu.Lock()
+	if sm.state != StateOnBreak {
+		state := sm.state
+		sm.mu.Unlock()
+		return fmt.Errorf("cannot end a break while %s", state)
+	}
+	transition := sm.enter(StateCheckedIn, EventActive, SourceManual, now)
+	sm.mu.Unlock()
+
+	sm.emit(transition)
+	return nil
+}
+
+// enter switches to a new state; the caller must hold sm.mu.
+// An empty event changes state without notifying the server.
+func (sm *AttendanceStateMachine) enter(to AttendanceState, event string, source string, at time.Time) *Transition {
+	// Back-dated transitions never reach before the current state began
+	at = laterOf(at, sm.since)
+
+	if sm.state == StateCheckedIn {
+		sm.addWorked(sm.since, at)
+	}
+
+	transition := &Transition{From: sm.state, To: to, Event: event, Source: source, At: at}
+	sm.state = to
+	sm.since = at
+	return transition
+}
+
+// addWorked adds a checked-in interval to today's total; the caller must hold sm.mu
+func (sm *AttendanceStateMachine) addWorked(from, to time.Time) {
+	day := to.Format("2006-01-02")
+	if sm.workedDay != day {
+		sm.worked = 0
+		sm.workedDay = day
+	}
+	if from = laterOf(from, startOfDay(to)); to.After(from) {
+		sm.worked += to.Sub(from)
+	}
+}
+
+// emit notifies listeners about a transition
+func (sm *AttendanceStateMachine) emit(transition *Transition) {
+	if transition == nil {
+		return
+	}
+
+	sm.mu.Lock()
+	listeners := append([]func(Transition){}, sm.listeners...)
+	sm.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(*transition)
+	}
+}
+
+// runAutoMode takes one activity sample every CheckInterval and drives the state machine
+func runAutoMode(monitor *SystemActivityMonitor, sm *AttendanceStateMachine, config *SharedConfig, done <-chan struct{}) {
+	interval := config.Load().CheckInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sample := monitor.Sample()
+			sm.Update(sample.Time, sample.Idle, isSessionLocked())
+
+			// Follow changes to the check interval made in Settings
+			if current := config.Load().CheckInterval; current != interval {
+				interval = current
+				ticker.Reset(interval)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// startOfDay returns local midnight at the start of t's day
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// laterOf returns the later of two times
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// formatDuration formats a duration as H:MM:SS for display
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	seconds := int(d.Seconds()) % 60
+	return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+}
+
+// describeState returns a human readable name for a state
+func describeState(state AttendanceState) string {
+	switch state {
+	case StateCheckedIn:
+		return "Checked in"
+	case StateIdle:
+		return "Idle (checked out)"
+	case StateOnBreak:
+		return "On break"
+	case StateLocked:
+		return "Locked (checked out)"
+	default:
+		return "Checked out"
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// simulation drives a state machine from a scripted activity timeline
+type simulation struct {
+	t           *testing.T
+	config      *SharedConfig
+	clock       *fakeClock
+	provider    *fakeIdleProvider
+	monitor     *SystemActivityMonitor
+	sm          *AttendanceStateMachine
+	locked      []timelineSpan
+	transitions []Transition
+}
+
+func newSimulation(t *testing.T, start time.Time) *simulation {
+	config := NewAppConfig()
+	config.AutoMode = true
+	config.IdleTimeout = 20 * time.Minute
+	config.CheckInterval = 2 * time.Second
+
+	shared := NewSharedConfig(config)
+	clock := newFakeClock(start)
+	provider := newFakeIdleProvider(clock)
+	s := &simulation{
+		t:        t,
+		config:   shared,
+		clock:    clock,
+		provider: provider,
+		monitor:  NewSystemActivityMonitorWith(shared, provider, clock),
+		sm:       NewAttendanceStateMachine(shared, start),
+	}
+	s.sm.OnTransition(func(tr Transition) {
+		s.transitions = append(s.transitions, tr)
+	})
+	return s
+}
+
+// runUntil polls the monitor every CheckInterval until end
+func (s *simulation) runUntil(end time.Time) {
+	for s.clock.Now().Before(end) {
+		s.clock.Advance(s.config.Load().CheckInterval)
+		locked := false
+		for _, span := range s.locked {
+			locked = locked || span.contains(s.clock.Now())
+		}
+		sample := s.monitor.Sample()
+		s.sm.Update(sample.Time, sample.Idle, locked)
+	}
+}
+
+// expect checks the recorded transitions against (state, event, time) triples
+func (s *simulation) expect(want ...Transition) {
+	s.t.Helper()
+	if len(s.transitions) != len(want) {
+		for _, tr := range s.transitions {
+			s.t.Logf("got %s -> %s %q at %s", tr.From, tr.To, tr.Event, tr.At.Format("15:04:05"))
+		}
+		s.t.Fatalf("got %d transitions, want %d", len(s.transitions), len(want))
+	}
+	for i, w := range want {
+		got := s.transitions[i]
+		if got.To != w.To || got.Event != w.Event || !got.At.Equal(w.At) {
+			s.t.Errorf("transition %d = %s %q at %s, want %s %q at %s", i,
+				got.To, got.Event, got.At.Format("15:04:05"),
+				w.To, w.Event, w.At.Format("15:04:05"))
+		}
+	}
+}
+
+func TestAutoModeWorkday(t *testing.T) {
+	s := newSimulation(t, at(8, 30))
+	s.provider.
+		Active(at(9, 0), at(10, 30)).
+		// A ten minute pause is shorter than the idle timeout
+		Active(at(10, 40), at(12, 0)).
+		Active(at(13, 0), at(17, 30))
+
+	s.runUntil(at(18, 0))
+
+	s.expect(
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(9, 0)},
+		// Check-outs are back-dated to when input stopped
+		Transition{To: StateIdle, Event: EventCheckOut, At: at(12, 0)},
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(13, 0)},
+		Transition{To: StateIdle, Event: EventCheckOut, At: at(17, 30)},
+	)
+
+	if got, want := s.sm.WorkedToday(at(18, 0)), 7*time.Hour+30*time.Minute; got != want {
+		t.Errorf("WorkedToday() = %v, want %v", got, want)
+	}
+	for _, tr := range s.transitions {
+		if tr.Source != SourceAuto {
+			t.Errorf("transition at %s has source %q, want %q", tr.At.Format("15:04"), tr.Source, SourceAuto)
+		}
+	}
+}
+
+func TestAutoModeLockChecksOut(t *testing.T) {
+	s := newSimulation(t, at(8, 59))
+	s.provider.
+		Active(at(9, 0), at(11, 0)).
+		Active(at(11, 15), at(12, 0))
+	s.locked = []timelineSpan{{Start: at(11, 0), End: at(11, 15)}}
+
+	s.runUntil(at(11, 30))
+
+	s.expect(
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(9, 0)},
+		Transition{To: StateLocked, Event: EventCheckOut, At: at(11, 0)},
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(11, 15)},
+	)
+}
+
+func TestAutoModeDisabled(t *testing.T) {
+	s := newSimulation(t, at(8, 59))
+	config := *s.config.Load()
+	config.AutoMode = false
+	s.config.Store(&config)
+	s.provider.Active(at(9, 0), at(10, 0))
+
+	s.runUntil(at(11, 0))
+
+	s.expect()
+	if got, want := s.sm.IdleTime(), time.Hour; got != want {
+		t.Errorf("IdleTime() = %v, want %v even without auto mode", got, want)
+	}
+}
+
+func TestManualCheckOutHoldsUntilNextDay(t *testing.T) {
+	s := newSimulation(t, at(8, 59))
+	s.provider.
+		Active(at(9, 0), at(18, 0)).
+		Active(at(24+9, 0), at(24+10, 0))
+
+	s.runUntil(at(17, 0))
+	if err := s.sm.CheckOut(s.clock.Now()); err != nil {
+		t.Fatalf("CheckOut() error: %v", err)
+	}
+	s.runUntil(at(24+9, 30))
+
+	s.expect(
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(9, 0)},
+		Transition{To: StateCheckedOut, Event: EventCheckOut, At: at(17, 0)},
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(24+9, 0)},
+	)
+	if s.transitions[1].Source != SourceManual {
+		t.Errorf("manual check-out has source %q, want %q", s.transitions[1].Source, SourceManual)
+	}
+}
+
+func TestBreakSuspendsIdleTimeout(t *testing.T) {
+	s := newSimulation(t, at(8, 59))
+	s.provider.
+		Active(at(9, 0), at(12, 0)).
+		Active(at(13, 0), at(14, 0))
+
+	s.runUntil(at(12, 0))
+	if err := s.sm.StartBreak(s.clock.Now()); err != nil {
+		t.Fatalf("StartBreak() error: %v", err)
+	}
+	s.runUntil(at(13, 0))
+	if err := s.sm.EndBreak(s.clock.Now()); err != nil {
+		t.Fatalf("EndBreak() error: %v", err)
+	}
+	s.runUntil(at(13, 30))
+
+	s.expect(
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(9, 0)},
+		Transition{To: StateOnBreak, Event: EventIdle, At: at(12, 0)},
+		Transition{To: StateCheckedIn, Event: EventActive, At: at(13, 0)},
+	)
+	if got, want := s.sm.WorkedToday(at(13, 30)), 3*time.Hour+30*time.Minute; got != want {
+		t.Errorf("WorkedToday() = %v, want %v excluding the break", got, want)
+	}
+}
+
+func TestWorkedTimeSplitsAtMidnight(t *testing.T) {
+	s := newSimulation(t, at(21, 59))
+	s.provider.Active(at(22, 0), at(24+1, 0))
+
+	s.runUntil(at(24+2, 0))
+
+	s.expect(
+		Transition{To: StateCheckedIn, Event: EventCheckIn, At: at(22, 0)},
+		Transition{To: StateIdle, Event: EventCheckOut, At: at(24+1, 0)},
+	)
+	if got, want := s.sm.WorkedToday(at(24+2, 0)), time.Hour; got != want {
+		t.Errorf("WorkedToday() after midnight = %v, want %v", got, want)
+	}
+}
+
+// Run with -race: Settings may apply a config while auto mode is sampling
+// and events are being sent
+func TestApplyConfigWhileAutoModeRuns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	config := NewAppConfig()
+	config.AutoMode = true
+	config.CheckInterval = time.Millisecond
+	config.ServerEndpoint = server.URL
+	shared := NewSharedConfig(config)
+	clock := newFakeClock(at(9, 0))
+	monitor := NewSystemActivityMonitorWith(shared, newFakeIdleProvider(clock).Active(at(8, 0), at(10, 0)), clock)
+	tracker := &Tracker{
+		Sender:  NewEventSender(shared),
+		Monitor: monitor,
+		State:   NewAttendanceStateMachine(shared, clock.Now()),
+		config:  shared,
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		runAutoMode(monitor, tracker.State, shared, done)
+		close(stopped)
+	}()
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			tracker.Sender.Send(NewStatusPayload(tracker.CurrentConfig(), EventActive, SourceAuto, time.Now()))
+		}
+		close(sent)
+	}()
+
+	for i := 0; i < 50; i++ {
+		next := *tracker.CurrentConfig()
+		next.CheckInterval = time.Duration(1+i%3) * time.Millisecond
+		next.IdleTimeout = time.Duration(10+i) * time.Minute
+		tracker.ApplyConfig(&next)
+		time.Sleep(time.Millisecond)
+	}
+	close(done)
+	<-stopped
+	<-sent
+
+	if got := tracker.CurrentConfig().IdleTimeout; got != 59*time.Minute {
+		t.Errorf("IdleTimeout = %v, want the last applied 59m", got)
+	}
+	if state, _ := tracker.State.State(); state != StateCheckedIn {
+		t.Errorf("state = %s, want auto mode to have checked in", state)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracker ties together activity monitoring, attendance state and event delivery
+type Tracker struct {
+	Sender  *EventSender
+	Outbox  *Outbox
+	Monitor *SystemActivityMonitor
+	State   *AttendanceStateMachine
+	History *HistoryStore
+	Keyring CredentialStore
+
+	config          *SharedConfig
+	mu              sync.Mutex
+	policies        ConfigPolicies
+	configListeners []func(*AppConfig)
+}
+
+// NewTracker creates the tracking components for config.
+// Every state transition is queued in the outbox for delivery.
+func NewTracker(initial *AppConfig) (*Tracker, error) {
+	config := NewSharedConfig(initial)
+	sender := NewEventSender(config)
+
+	// Events are queued on disk first and delivered by a background worker
+	outbox, err := OpenOutbox(getOutboxDir(), sender)
+	if err != nil {
+		logActivity(fmt.Sprintf("Error opening event outbox: %v", err))
+		outbox, err = OpenOutbox(filepath.Join(os.TempDir(), "attendance-tracker-outbox"), sender)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The keyring also holds the key that signs the local history
+	keyring := openCredentialStore()
+	history, err := OpenHistoryStore(getHistoryFilePath(), openHistoryKey(keyring))
+	if err != nil {
+		return nil, err
+	}
+
+	monitor := NewSystemActivityMonitor(config)
+	t := &Tracker{
+		Sender:  sender,
+		Outbox:  outbox,
+		Monitor: monitor,
+		State:   NewAttendanceStateMachine(config, monitor.Now()),
+		History: history,
+		Keyring: keyring,
+
+		config:   config,
+		policies: loadConfigPolicies(),
+	}
+
+	// Carry today's worked time over from earlier runs
+	now := time.Now()
+	if days, err := history.Days(now, now, now); err != nil {
+		logActivity(fmt.Sprintf("Error reading attendance history: %v", err))
+	} else if len(days) > 0 {
+		t.State.SeedWorked(days[0].Date, days[0].Worked)
+	}
+
+	t.State.OnTransition(func(tr Transition) {
+		logActivity(fmt.Sprintf("State changed: %s -> %s at %s (%s)", tr.From, tr.To, tr.At.Format("15:04:05"), tr.Source))
+		if err := t.History.Append(tr); err != nil {
+			logActivity(fmt.Sprintf("Error recording attendance history: %v", err))
+		}
+		if tr.Event == "" {
+			return
+		}
+		payload := NewStatusPayload(t.CurrentConfig(), tr.Event, tr.Source, tr.At)
+		payload.Payload.Activity = t.Monitor.Stats(activityStatsWindow).Summary()
+		head := t.History.Head()
+		payload.Chain = &head
+		t.Outbox.Enqueue(payload)
+	})
+
+	// The server may manage settings through its responses
+	sender.OnPolicy(t.applyServerPolicy)
+
+	t.loadCredentials()
+	t.announceReplacedDeviceID()
+	t.checkDeviceBinding()
+
+	return t, nil
+}
+
+// Run starts event delivery and auto mode until done is closed
+func (t *Tracker) Run(done <-chan struct{}) {
+	go t.Outbox.Run(done)
+	go runAutoMode(t.Monitor, t.State, t.config, done)
+}
+
+// CurrentConfig returns the config in force. It is a snapshot that must not
+// be modified; ApplyConfig replaces it.
+func (t *Tracker) CurrentConfig() *AppConfig {
+	return t.config.Load()
+}
+
+// Toggle manually checks in or out
+func (t *Tracker) Toggle() error {
+	return t.State.Toggle(time.Now())
+}
+
+// OnConfigChange registers a callback invoked after new settings are applied
+func (t *Tracker) OnConfigChange(listener func(*AppConfig)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.configListeners = append(t.configListeners, listener)
+}
+
+// ApplyConfig switches the running tracker to a copy of config. Components
+// read the config in force whenever they use it, so they pick up the new
+// values from their next sample, event or update check on.
+func (t *Tracker) ApplyConfig(config *AppConfig) {
+	serverChanged := serverOrigin(config.ServerEndpoint) != serverOrigin(t.CurrentConfig().ServerEndpoint)
+	t.config.Store(config)
+	if serverChanged {
+		t.loadCredentials()
+	}
+
+	t.mu.Lock()
+	listeners := append([]func(*AppConfig){}, t.configListeners...)
+	t.mu.Unlock()
+
+	current := t.CurrentConfig()
+	for _, listener := range listeners {
+		listener(current)
+	}
+}
+
+// Policies returns the admin policies currently in force
+func (t *Tracker) Policies() ConfigPolicies {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.policies
+}
+
+// applyServerPolicy stores a policy pushed by the server and applies it
+// to the running tracker
+func (t *Tracker) applyServerPolicy(policy *ConfigPolicy) {
+	t.mu.Lock()
+	current := t.policies
+	t.mu.Unlock()
+
+	// Servers typically repeat the same policy in every response
+	if previous := current.serverPolicy(); previous != nil {
+		oldData, _ := json.Marshal(previous)
+		newData, _ := json.Marshal(policy)
+		if bytes.Equal(oldData, newData) {
+			return
+		}
+	}
+
+	policies := current.withServerPolicy(policy)
+	config, _, problems := policies.resolve(ConfigLayer{Source: "running config", Values: configValues(t.CurrentConfig())})
+	if len(problems) > 0 {
+		logActivity(fmt.Sprintf("Not applying config from server: %v", &ConfigError{Path: serverPolicySource, Problems: problems}))
+		return
+	}
+
+	if err := saveServerPolicy(policy); err != nil {
+		logActivity(fmt.Sprintf("Error saving config from server: %v", err))
+	}
+
+	t.mu.Lock()
+	t.policies = policies
+	t.mu.Unlock()
+
+	locked := strings.Join(ConfigPolicies{policy}.LockedFields(), ", ")
+	if locked == "" {
+		locked = "none"
+	}
+	logActivity(fmt.Sprintf("Applied config from server (locked: %s)", locked))
+	t.ApplyConfig(config)
+}
+
+// loadCredentials makes the sender use the stored credentials for the
+// configured server, if the device has signed in to it
+func (t *Tracker) loadCredentials() {
+	credentials, err := loadCredentials(t.Keyring, serverOrigin(t.CurrentConfig().ServerEndpoint))
+	if err != nil {
+		logActivity(fmt.Sprintf("Error reading credentials from %s: %v", t.Keyring.Name(), err))
+	}
+	if credentials != nil && credentials.Expired(time.Now()) {
+		logActivity(fmt.Sprintf("Sign-in to %s has expired; sign in again", credentials.Server))
+	}
+	t.Sender.SetCredentials(credentials)
+}
+
+// Credentials returns the credentials used for the configured server, or nil
+func (t *Tracker) Credentials() *Credentials {
+	return t.Sender.credentialsFor(t.CurrentConfig().ServerEndpoint)
+}
+
+// SignIn enrolls this device with the configured server using the user's
+// password or an enrollment code, and stores the issued credentials
+func (t *Tracker) SignIn(password string) error {
+	config := t.CurrentConfig()
+	credentials, err := enrollDevice(config.ServerEndpoint, config.UserID, config.DeviceID, password)
+	if err != nil {
+		return err
+	}
+	if err := saveCredentials(t.Keyring, credentials); err != nil {
+		return fmt.Errorf("signed in, but the credentials could not be stored in %s: %v", t.Keyring.Name(), err)
+	}
+	t.Sender.SetCredentials(credentials)
+	logActivity(fmt.Sprintf("Signed in to %s as %s", credentials.Server, credentials.UserID))
+
+	// Events held back while signed out can go now
+	t.Outbox.Wake()
+	return nil
+}
+
+// SignOut forgets the credentials for the configured server
+func (t *Tracker) SignOut() error {
+	server := serverOrigin(t.CurrentConfig().ServerEndpoint)
+	if err := t.Keyring.Delete(server); err != nil {
+		return fmt.Errorf("could not remove credentials from %s: %v", t.Keyring.Name(), err)
+	}
+	t.Sender.SetCredentials(nil)
+	logActivity(fmt.Sprintf("Signed out of %s", server))
+	return nil
+}
+
+// announceDeviceChange tells the server that this device now reports as
+// the configured device ID instead of previous
+func (t *Tracker) announceDeviceChange(previous, source, reason string) {
+	config := t.CurrentConfig()
+	payload := NewStatusPayload(config, EventDeviceChanged, source, time.Now())
+	payload.Payload.PreviousDeviceID = previous
+	payload.Payload.Reason = reason
+	head := t.History.Head()
+	payload.Chain = &head
+
+	logActivity(fmt.Sprintf("Device ID changed from %s to %s (%s)", previous, config.DeviceID, reason))
+	t.Outbox.Enqueue(payload)
+}
+
+// ReenrollDevice replaces the device ID with a new random one, saves it and
+// tells the server the old and new IDs. It fails if the device ID is set
+// by a policy or override, as the new one would not take effect.
+func (t *Tracker) ReenrollDevice(source, reason string) (string, error) {
+	if locked := t.Policies().LockedBy("device_id"); locked != "" {
+		return "", fmt.Errorf("the device ID is managed by %s", locked)
+	}
+	if overridden := overriddenBy("device_id"); overridden != "" {
+		return "", fmt.Errorf("the device ID is set by the %s", overridden)
+	}
+
+	identity, err := newDeviceIdentity()
+	if err != nil {
+		return "", err
+	}
+	if err := saveCurrentDeviceIdentity(identity); err != nil {
+		return "", fmt.Errorf("could not save the new device identity: %v", err)
+	}
+
+	config := *t.CurrentConfig()
+	previous := config.DeviceID
+	config.DeviceID = identity.DeviceID
+	if err := saveConfig(&config); err != nil {
+		return "", fmt.Errorf("could not save settings: %v", err)
+	}
+	t.ApplyConfig(&config)
+	t.announceDeviceChange(previous, source, reason)
+	return identity.DeviceID, nil
+}
+
+// announceReplacedDeviceID tells the server, once, that the host name based
+// ID of an older version was replaced by the device's random ID
+func (t *Tracker) announceReplacedDeviceID() {
+	identity, err := loadDeviceIdentity(getDeviceIdentityPath())
+	if err != nil {
+		logActivity(fmt.Sprintf("Error reading device identity: %v", err))
+		return
+	}
+	if identity.Replaces == "" || t.CurrentConfig().DeviceID != identity.DeviceID {
+		// Nothing was replaced, or a policy or override still sets the ID
+		return
+	}
+
+	// Rewrite the config without the old ID, so loading it does not
+	// replace it again
+	path, err := getConfigFilePath()
+	if err == nil {
+		_, err = migrateConfigFile(path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logActivity(fmt.Sprintf("Error migrating the config to drop the host name based device ID: %v", err))
+		return
+	}
+
+	t.announceDeviceChange(identity.Replaces, SourceAuto, "replaced host name based ID")
+	identity.Replaces = ""
+	if err := saveCurrentDeviceIdentity(identity); err != nil {
+		logActivity(fmt.Sprintf("Error saving device identity: %v", err))
+	}
+}
+
+// checkDeviceBinding gives the device a new ID if binding is enabled and
+// its identity was created on another machine, so copied profiles and
+// cloned disk images do not share an ID
+func (t *Tracker) checkDeviceBinding() {
+	if !t.CurrentConfig().BindDevice {
+		return
+	}
+	identity, err := loadDeviceIdentity(getDeviceIdentityPath())
+	if err != nil {
+		logActivity(fmt.Sprintf("Error checking device binding: %v", err))
+		return
+	}
+
+	fingerprint := machineFingerprint()
+	if fingerprint == "" {
+		logActivity("Device binding: the machine ID cannot be read, keeping the device ID")
+		return
+	}
+	if identity.Machine == "" {
+		// Created where the machine ID could not be read; bind it now
+		identity.Machine = fingerprint
+		if err := saveCurrentDeviceIdentity(identity); err != nil {
+			logActivity(fmt.Sprintf("Error saving device identity: %v", err))
+		}
+		return
+	}
+	if !deviceMovedMachines(identity, fingerprint) {
+		return
+	}
+
+	if _, err := t.ReenrollDevice(SourceAuto, "machine changed"); err != nil {
+		logActivity(fmt.Sprintf("This device's identity was created on another machine, but it could not be replaced: %v", err))
+	}
+}
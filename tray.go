@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/systray"
+	"golang.org/x/image/draw"
+)
+
+// trayIconSource is the application icon the tray variants are drawn from
+//
+//go:embed icon.png
+var trayIconSource []byte
+
+// Edge length of the rendered tray icon in pixels
+const trayIconSize = 64
+
+// trayBadge is the status shown as a coloured dot on the tray icon
+type trayBadge int
+
+const (
+	trayBadgeCheckedOut trayBadge = iota
+	trayBadgeCheckedIn
+	trayBadgeIdle
+	trayBadgeOffline // Events are queued because the server cannot be reached
+)
+
+// Badge colours
+var (
+	trayBadgeColors = map[trayBadge]color.RGBA{
+		trayBadgeCheckedOut: {0x80, 0x80, 0x80, 0xff},
+		trayBadgeCheckedIn:  {0x2e, 0xa0, 0x43, 0xff},
+		trayBadgeIdle:       {0xf0, 0xa0, 0x20, 0xff},
+		trayBadgeOffline:    {0xd0, 0x30, 0x30, 0xff},
+	}
+	trayUpdateColor = color.RGBA{0x20, 0x70, 0xe0, 0xff}
+)
+
+// trayIconKey identifies one rendered variant of the tray icon
+type trayIconKey struct {
+	badge  trayBadge
+	update bool
+}
+
+// SystemTray keeps the tray icon, tooltip and menu in step with the tracker
+type SystemTray struct {
+	app     fyne.App
+	desk    desktop.App
+	window  fyne.Window
+	tracker *Tracker
+
+	menu       *fyne.Menu
+	stateItem  *fyne.MenuItem
+	workedItem *fyne.MenuItem
+	toggleItem *fyne.MenuItem
+	updateItem *fyne.MenuItem
+
+	mu      sync.Mutex
+	update  *UpdateInfo
+	icons   map[trayIconKey]fyne.Resource
+	current *trayIconKey
+}
+
+// setupSystemTray adds a tray icon with attendance controls and makes
+// closing the window hide it to the tray. It returns nil when the
+// platform has no system tray.
+func setupSystemTray(a fyne.App, w fyne.Window, tracker *Tracker) *SystemTray {
+	desk, ok := a.(desktop.App)
+	if !ok {
+		return nil
+	}
+
+	t := &SystemTray{
+		app:     a,
+		desk:    desk,
+		window:  w,
+		tracker: tracker,
+		icons:   make(map[trayIconKey]fyne.Resource),
+	}
+	t.buildMenu()
+
+	// Keep tracking all day; only Quit ends the app
+	w.SetCloseIntercept(func() {
+		w.Hide()
+	})
+
+	tracker.State.OnTransition(func(Transition) {
+		t.refresh()
+	})
+	tracker.Outbox.OnChange(func(OutboxStats) {
+		t.refresh()
+	})
+	tracker.Sender.OnResult(func(EventResult) {
+		t.refresh()
+	})
+	t.refresh()
+
+	// Worked time is shown to the minute
+	go func() {
+		for range time.Tick(time.Minute) {
+			t.refresh()
+		}
+	}()
+
+	return t
+}
+
+// buildMenu creates the tray menu, mirroring the main menu
+func (t *SystemTray) buildMenu() {
+	t.stateItem = fyne.NewMenuItem("", nil)
+	t.stateItem.Disabled = true
+
+	t.workedItem = fyne.NewMenuItem("", nil)
+	t.workedItem.Disabled = true
+
+	t.toggleItem = fyne.NewMenuItem("Check In", func() {
+		if err := t.tracker.Toggle(); err != nil {
+			t.withWindow(func(w fyne.Window) {
+				dialog.ShowError(err, w)
+			})
+		}
+	})
+
+	openItem := fyne.NewMenuItem("Open Window", func() {
+		t.withWindow(func(fyne.Window) {})
+	})
+
+	settingsItem := fyne.NewMenuItem("Settings", func() {
+		t.withWindow(func(w fyne.Window) {
+			showSettingsDialog(w, t.tracker)
+		})
+	})
+
+	t.updateItem = fyne.NewMenuItem("Check for Updates", func() {
+		t.withWindow(func(w fyne.Window) {
+			checkForUpdates(w, t.tracker)
+		})
+	})
+
+	aboutItem := fyne.NewMenuItem("About", func() {
+		t.withWindow(func(w fyne.Window) {
+			showAboutDialog(w, t.tracker)
+		})
+	})
+
+	uninstallItem := fyne.NewMenuItem("Uninstall", func() {
+		t.withWindow(confirmUninstall)
+	})
+
+	quitItem := fyne.NewMenuItem("Quit", func() {
+		t.app.Quit()
+	})
+	quitItem.IsQuit = true
+
+	t.menu = fyne.NewMenu("Attendance Tracker",
+		t.stateItem,
+		t.workedItem,
+		t.toggleItem,
+		fyne.NewMenuItemSeparator(),
+		openItem,
+		settingsItem,
+		fyne.NewMenuItemSeparator(),
+		t.updateItem,
+		aboutItem,
+		fyne.NewMenuItemSeparator(),
+		uninstallItem,
+		quitItem,
+	)
+}
+
+// withWindow brings the main window forward, then runs fn with it.
+// Dialogs need a visible parent window.
+func (t *SystemTray) withWindow(fn func(w fyne.Window)) {
+	t.window.Show()
+	t.window.RequestFocus()
+	fn(t.window)
+}
+
+// SetUpdateAvailable marks the tray icon and menu with a pending update
+func (t *SystemTray) SetUpdateAvailable(info *UpdateInfo) {
+	t.mu.Lock()
+	t.update = info
+	t.mu.Unlock()
+	t.refresh()
+}
+
+// refresh updates the menu labels, tooltip and icon from the tracker
+func (t *SystemTray) refresh() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	state, since := t.tracker.State.State()
+	worked := formatHoursMinutes(t.tracker.State.WorkedToday(now))
+
+	t.stateItem.Label = fmt.Sprintf("%s since %s", describeState(state), since.Format("15:04"))
+	t.workedItem.Label = fmt.Sprintf("Worked today: %s", worked)
+	if state == StateCheckedIn || state == StateOnBreak {
+		t.toggleItem.Label = "Check Out"
+	} else {
+		t.toggleItem.Label = "Check In"
+	}
+	if t.update != nil {
+		t.updateItem.Label = fmt.Sprintf("Update Available: v%s", t.update.Version)
+	} else {
+		t.updateItem.Label = "Check for Updates"
+	}
+	t.desk.SetSystemTrayMenu(t.menu)
+
+	stats := t.tracker.Outbox.Stats()
+	offline := false
+	if result := t.tracker.Sender.LastResult(); result != nil && result.Err != nil {
+		offline = stats.Depth > 0
+	}
+
+	tooltip := fmt.Sprintf("Attendance Tracker - %s, worked today %s", describeState(state), worked)
+	if offline {
+		tooltip += fmt.Sprintf(" (offline, %d queued)", stats.Depth)
+	}
+	systray.SetTooltip(tooltip)
+
+	key := trayIconKey{badge: trayBadgeFor(state, offline), update: t.update != nil}
+	if t.current != nil && *t.current == key {
+		return
+	}
+	icon, err := t.icon(key)
+	if err != nil {
+		logActivity(fmt.Sprintf("Error drawing tray icon: %v", err))
+		icon = fyne.NewStaticResource("icon.png", trayIconSource)
+	}
+	t.desk.SetSystemTrayIcon(icon)
+	t.current = &key
+}
+
+// icon returns the tray icon for key, rendering it on first use
+func (t *SystemTray) icon(key trayIconKey) (fyne.Resource, error) {
+	if icon, ok := t.icons[key]; ok {
+		return icon, nil
+	}
+
+	content, err := renderTrayIcon(trayIconSource, key.badge, key.update)
+	if err != nil {
+		return nil, err
+	}
+	icon := fyne.NewStaticResource(fmt.Sprintf("tray-%d-%t.png", key.badge, key.update), content)
+	t.icons[key] = icon
+	return icon, nil
+}
+
+// trayBadgeFor picks the badge for an attendance state.
+// Being offline takes precedence, as queued events need attention.
+func trayBadgeFor(state AttendanceState, offline bool) trayBadge {
+	if offline {
+		return trayBadgeOffline
+	}
+	switch state {
+	case StateCheckedIn:
+		return trayBadgeCheckedIn
+	case StateIdle, StateOnBreak, StateLocked:
+		return trayBadgeIdle
+	default:
+		return trayBadgeCheckedOut
+	}
+}
+
+// renderTrayIcon scales the PNG icon down to tray size and draws the status
+// badge in the bottom right corner, plus a smaller update dot in the top
+// right when update is set
+func renderTrayIcon(base []byte, badge trayBadge, update bool) ([]byte, error) {
+	src, err := png.Decode(bytes.NewReader(base))
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, trayIconSize, trayIconSize))
+	draw.CatmullRom.Scale(img, img.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	radius := trayIconSize * 22 / 100
+	drawBadge(img, trayIconSize-radius-1, trayIconSize-radius-1, radius, trayBadgeColors[badge])
+	if update {
+		radius = trayIconSize * 16 / 100
+		drawBadge(img, trayIconSize-radius-1, radius, radius, trayUpdateColor)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawBadge fills a circle with a white outline so it stands out on any icon
+func drawBadge(img *image.RGBA, cx, cy, radius int, fill color.RGBA) {
+	outline := radius / 5
+	if outline < 1 {
+		outline = 1
+	}
+	inner := (radius - outline) * (radius - outline)
+	outer := radius * radius
+
+	for y := cy - radius; y <= cy+radius; y++ {
+		for x := cx - radius; x <= cx+radius; x++ {
+			d := (x-cx)*(x-cx) + (y-cy)*(y-cy)
+			switch {
+			case d <= inner:
+				img.SetRGBA(x, y, fill)
+			case d <= outer:
+				img.SetRGBA(x, y, color.RGBA{0xff, 0xff, 0xff, 0xff})
+			}
+		}
+	}
+}
+
+// formatHoursMinutes formats a duration as H:MM
+func formatHoursMinutes(d time.Duration) string {
+	d = d.Truncate(time.Minute)
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
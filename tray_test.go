@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestTrayBadgeFollowsState(t *testing.T) {
+	cases := []struct {
+		state   AttendanceState
+		offline bool
+		want    trayBadge
+	}{
+		{StateCheckedOut, false, trayBadgeCheckedOut},
+		{StateCheckedIn, false, trayBadgeCheckedIn},
+		{StateIdle, false, trayBadgeIdle},
+		{StateOnBreak, false, trayBadgeIdle},
+		{StateLocked, false, trayBadgeIdle},
+		{StateCheckedIn, true, trayBadgeOffline},
+		{StateCheckedOut, true, trayBadgeOffline},
+	}
+	for _, c := range cases {
+		if got := trayBadgeFor(c.state, c.offline); got != c.want {
+			t.Errorf("trayBadgeFor(%s, %t) = %d, want %d", c.state, c.offline, got, c.want)
+		}
+	}
+}
+
+func TestRenderTrayIconDrawsBadges(t *testing.T) {
+	content, err := renderTrayIcon(trayIconSource, trayBadgeCheckedIn, true)
+	if err != nil {
+		t.Fatalf("renderTrayIcon: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("decoding rendered icon: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != trayIconSize || size.Y != trayIconSize {
+		t.Fatalf("icon size = %v, want %dx%d", size, trayIconSize, trayIconSize)
+	}
+
+	// Centre of the status badge
+	radius := trayIconSize * 22 / 100
+	got := color.RGBAModel.Convert(img.At(trayIconSize-radius-1, trayIconSize-radius-1))
+	if got != trayBadgeColors[trayBadgeCheckedIn] {
+		t.Errorf("status badge colour = %v, want %v", got, trayBadgeColors[trayBadgeCheckedIn])
+	}
+
+	// Centre of the update dot
+	radius = trayIconSize * 16 / 100
+	got = color.RGBAModel.Convert(img.At(trayIconSize-radius-1, radius))
+	if got != trayUpdateColor {
+		t.Errorf("update dot colour = %v, want %v", got, trayUpdateColor)
+	}
+}
+
+func TestFormatHoursMinutes(t *testing.T) {
+	if got := formatHoursMinutes(7*time.Hour + 5*time.Minute + 59*time.Second); got != "7:05" {
+		t.Errorf("formatHoursMinutes = %q, want 7:05", got)
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpdateSigningKey is the base64 ed25519 public key that release manifests
+// must be signed with. Release builds set it with
+// -ldflags "-X main.UpdateSigningKey=<key>"; builds without one refuse to
+// install updates.
+var UpdateSigningKey = ""
+
+// Names of the signed manifest and its signature among the release assets
+const (
+	updateManifestName  = "manifest.json"
+	updateSignatureName = "manifest.json.sig"
+)
+
+// UpdateManifest lists the files of a release with their checksums. Its
+// ed25519 signature ties the checksums to the release signing key, so a
+// compromised download host cannot serve a different binary.
+type UpdateManifest struct {
+	Version string            `json:"version"`
+	Files   map[string]string `json:"files"` // Asset name to hex SHA-256
+}
+
+// DownloadProgress reports how far a download has got
+type DownloadProgress struct {
+	Downloaded int64   // Bytes on disk, including any resumed part
+	Total      int64   // 0 if the server did not say
+	Rate       float64 // Bytes per second since this download started
+}
+
+// Fraction returns how much of the download is done, from 0 to 1
+func (p DownloadProgress) Fraction() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return float64(p.Downloaded) / float64(p.Total)
+}
+
+// String formats the progress as "42.0% (10.3/24.5 MB) - 2.5 MB/s, 6s left"
+func (p DownloadProgress) String() string {
+	const mb = 1024 * 1024
+	if p.Total <= 0 {
+		return fmt.Sprintf("%.1f MB - %.1f MB/s", float64(p.Downloaded)/mb, p.Rate/mb)
+	}
+	text := fmt.Sprintf("%.1f%% (%.1f/%.1f MB) - %.1f MB/s",
+		p.Fraction()*100, float64(p.Downloaded)/mb, float64(p.Total)/mb, p.Rate/mb)
+	if p.Rate > 0 && p.Downloaded < p.Total {
+		left := time.Duration(float64(p.Total-p.Downloaded) / p.Rate * float64(time.Second))
+		text += fmt.Sprintf(", %s left", left.Round(time.Second))
+	}
+	return text
+}
+
+// How often a running download reports its progress
+const downloadProgressInterval = 200 * time.Millisecond
+
+// Limits for the small files fetched alongside an update
+const maxUpdateMetadataSize = 1 << 20
+
+// updateHTTPClient has no overall timeout because downloads can take long on
+// slow connections; callers bound requests with their context instead
+var updateHTTPClient = &http.Client{}
+
+// fetchVerifiedUpdate returns the path of the update described by info in
+// the update cache, downloading it first unless an intact copy is already
+// there. The release manifest's signature and the published .sha256 asset
+// are checked before downloading and the file's hash after, so nothing is
+// returned that the release key did not vouch for.
+func fetchVerifiedUpdate(ctx context.Context, info *UpdateInfo, progress func(DownloadProgress)) (string, error) {
+	expected, err := fetchExpectedChecksum(ctx, info)
+	if err != nil {
+		return "", err
+	}
+
+	cachePath := getUpdateCachePath(info)
+	if fileExists(cachePath) {
+		if sum, err := hashFile(cachePath); err == nil && sum == expected {
+			logActivity(fmt.Sprintf("Using verified update %s from cache", info.Version))
+			return cachePath, nil
+		}
+		logActivity(fmt.Sprintf("Cached update %s does not match its checksum, downloading it again", info.Version))
+		os.Remove(cachePath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return "", fmt.Errorf("could not create update cache directory: %v", err)
+	}
+
+	// Patching the running version downloads much less; anything going
+	// wrong falls back to the full download
+	if len(info.Patches) > 0 {
+		source, err := updateTarget()
+		if err == nil {
+			err = fetchPatchedUpdate(ctx, info, source, cachePath, expected, progress)
+		}
+		if err == nil {
+			logActivity(fmt.Sprintf("Update %s patched from %s and verified: %s", info.Version, Version, cachePath))
+			return cachePath, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		logActivity(fmt.Sprintf("Could not patch to %s, downloading it in full: %v", info.Version, err))
+	}
+
+	partPath := cachePath + ".part"
+	if err := downloadUpdate(ctx, info.DownloadURL, partPath, progress); err != nil {
+		return "", err
+	}
+
+	sum, err := hashFile(partPath)
+	if err != nil {
+		return "", err
+	}
+	if sum != expected {
+		// Start from scratch next time rather than resuming a bad file
+		os.Remove(partPath)
+		return "", fmt.Errorf("downloaded file has SHA-256 %s, but the release lists %s", sum, expected)
+	}
+	if err := os.Rename(partPath, cachePath); err != nil {
+		return "", err
+	}
+	logActivity(fmt.Sprintf("Update %s downloaded and verified: %s", info.Version, cachePath))
+	return cachePath, nil
+}
+
+// fetchExpectedChecksum returns the SHA-256 of the update's asset after
+// checking the manifest's signature and that the .sha256 asset agrees
+func fetchExpectedChecksum(ctx context.Context, info *UpdateInfo) (string, error) {
+	if info.ManifestURL == "" || info.SignatureURL == "" {
+		return "", errors.New("the release has no signed manifest")
+	}
+	if info.SHA256 == "" && info.ChecksumURL == "" {
+		return "", errors.New("the release has no .sha256 checksum")
+	}
+
+	key, err := updateVerificationKey()
+	if err != nil {
+		return "", err
+	}
+	manifestData, err := fetchUpdateFile(ctx, info.ManifestURL)
+	if err != nil {
+		return "", fmt.Errorf("could not download the release manifest: %v", err)
+	}
+	signature, err := fetchUpdateFile(ctx, info.SignatureURL)
+	if err != nil {
+		return "", fmt.Errorf("could not download the manifest signature: %v", err)
+	}
+	manifest, err := verifyUpdateManifest(manifestData, signature, key)
+	if err != nil {
+		return "", err
+	}
+	if manifest.Version != info.Version {
+		return "", fmt.Errorf("the signed manifest is for version %s, not %s", manifest.Version, info.Version)
+	}
+	expected, ok := manifest.Files[info.AssetName]
+	if !ok {
+		return "", fmt.Errorf("the signed manifest does not list %s", info.AssetName)
+	}
+	expected = strings.ToLower(expected)
+
+	// The update server may list the checksum itself
+	published := info.SHA256
+	if published == "" {
+		checksumData, err := fetchUpdateFile(ctx, info.ChecksumURL)
+		if err != nil {
+			return "", fmt.Errorf("could not download the .sha256 checksum: %v", err)
+		}
+		if published, err = parseChecksumFile(checksumData, info.AssetName); err != nil {
+			return "", err
+		}
+	}
+	if published != expected {
+		return "", fmt.Errorf("the .sha256 checksum %s does not match the signed manifest's %s", published, expected)
+	}
+	return expected, nil
+}
+
+// updateVerificationKey returns the key release manifests are checked
+// against. Only the key built in can be used, so nothing in the
+// environment can make the app accept a manifest signed by someone else.
+func updateVerificationKey() (ed25519.PublicKey, error) {
+	encoded := UpdateSigningKey
+	if encoded == "" {
+		return nil, errors.New("this build has no update signing key; download new versions from the releases page")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("the update signing key is not a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyUpdateManifest checks signature over data and parses the manifest.
+// The signature may be raw or base64 encoded.
+func verifyUpdateManifest(data, signature []byte, key ed25519.PublicKey) (*UpdateManifest, error) {
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return nil, errors.New("the manifest signature is neither raw nor base64")
+		}
+		signature = decoded
+	}
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(key, data, signature) {
+		return nil, errors.New("the release manifest is not signed with the update signing key")
+	}
+
+	var manifest UpdateManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("could not parse the release manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+// parseChecksumFile reads the checksum for name from a .sha256 file in
+// sha256sum format ("<hex>  <name>" per line) or one holding just the hash
+func parseChecksumFile(data []byte, name string) (string, error) {
+	var sums []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		sum := strings.ToLower(fields[0])
+		if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+			continue
+		}
+		if len(fields) > 1 && strings.TrimPrefix(strings.Join(fields[1:], " "), "*") == name {
+			return sum, nil
+		}
+		sums = append(sums, sum)
+	}
+	// A file with a single checksum belongs to its asset whatever name it gives
+	if len(sums) == 1 {
+		return sums[0], nil
+	}
+	return "", fmt.Errorf("the .sha256 checksum has no entry for %s", name)
+}
+
+// fetchUpdateFile downloads one of the small files published with a release
+func fetchUpdateFile(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "AttendanceTracker/"+Version)
+	resp, err := updateHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateMetadataSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUpdateMetadataSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxUpdateMetadataSize)
+	}
+	return data, nil
+}
+
+// downloadUpdate streams url into partPath, reporting progress as it goes.
+// If partPath already holds the start of the file, for example after a
+// cancelled download or a dropped connection, only the rest is requested.
+// The partial file is kept when ctx is cancelled so a later call resumes.
+func downloadUpdate(ctx context.Context, url, partPath string, progress func(DownloadProgress)) error {
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "AttendanceTracker/"+Version)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := updateHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return fmt.Errorf("server resumed the download at the wrong place (%q)", resp.Header.Get("Content-Range"))
+		}
+		total = size
+		logActivity(fmt.Sprintf("Resuming update download at %d bytes", offset))
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file is as long as the file or longer; hashing decides
+		// whether it is complete
+		return nil
+
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range or nothing was downloaded yet
+		if offset > 0 {
+			logActivity("Update server does not support resuming, restarting download")
+		}
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		offset = 0
+		total = resp.ContentLength
+
+	default:
+		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+
+	report := DownloadProgress{Downloaded: offset}
+	if total > 0 {
+		report.Total = total
+	}
+	started := time.Now()
+	lastReport := time.Time{}
+	buffer := make([]byte, 32*1024)
+	for {
+		n, readErr := resp.Body.Read(buffer)
+		if n > 0 {
+			if _, err := file.Write(buffer[:n]); err != nil {
+				return err
+			}
+			report.Downloaded += int64(n)
+		}
+
+		done := readErr == io.EOF
+		if progress != nil && (done || time.Since(lastReport) >= downloadProgressInterval) {
+			if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+				report.Rate = float64(report.Downloaded-offset) / elapsed
+			}
+			progress(report)
+			lastReport = time.Now()
+		}
+		if done {
+			break
+		}
+		if readErr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return readErr
+		}
+	}
+
+	if total > 0 && report.Downloaded != total {
+		return fmt.Errorf("download ended after %d of %d bytes", report.Downloaded, total)
+	}
+	return file.Sync()
+}
+
+// parseContentRange reads "bytes <start>-<end>/<size>", where size may be
+// "*" (returned as -1)
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value = strings.TrimPrefix(value, "bytes ")
+	span, sizeText, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startText, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if sizeText == "*" {
+		return start, -1, true
+	}
+	size, err = strconv.ParseInt(sizeText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// hashFile returns the hex SHA-256 of the file at path
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// updateAssetName returns the file name at the end of a download URL
+func updateAssetName(downloadURL string) string {
+	if u, err := url.Parse(downloadURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(downloadURL)
+}
+
+// githubRelease is a release as returned by the GitHub releases API
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Name       string `json:"name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
+		Size        int64  `json:"size"`
+		Name        string `json:"name"`
+		DownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+	PublishedAt string `json:"published_at"`
+	Body        string `json:"body"`
+}
+
+// securityReleaseTag marks a GitHub release as fixing a security problem
+// when it appears in the release's name or notes
+const securityReleaseTag = "[security]"
+
+// isSecurityRelease reports whether a GitHub release is tagged as a
+// security release
+func isSecurityRelease(name, body string) bool {
+	return strings.Contains(strings.ToLower(name), securityReleaseTag) ||
+		strings.Contains(strings.ToLower(body), securityReleaseTag)
+}
+
+// channelUpdateURL returns the URL to check for updates on config's channel.
+// GitHub only lists pre-releases, and releases other than the latest, under
+// /releases; custom servers are told the channel as a query parameter.
+func channelUpdateURL(serverURL string, config *AppConfig) string {
+	if config.UpdateChannel == ChannelStable && config.PinnedVersion == "" {
+		return serverURL
+	}
+	if strings.Contains(serverURL, "api.github.com") {
+		return strings.TrimSuffix(serverURL, "/latest")
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil || config.UpdateChannel == ChannelStable {
+		return serverURL
+	}
+	query := u.Query()
+	query.Set("channel", config.UpdateChannel)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// chooseGitHubRelease returns the newest release that isUpdateCandidate
+// allows, with its version
+func chooseGitHubRelease(releases []githubRelease, config *AppConfig) (*githubRelease, string, bool) {
+	var best *githubRelease
+	var bestVersion SemVer
+	for i := range releases {
+		release := &releases[i]
+		if release.Draft {
+			continue
+		}
+		version := strings.TrimPrefix(release.TagName, "v")
+		if !isUpdateCandidate(version, release.Prerelease, config) {
+			continue
+		}
+		parsed, _ := parseSemVer(version)
+		if best == nil || parsed.Compare(bestVersion) > 0 {
+			best, bestVersion = release, parsed
+		}
+	}
+	if best == nil {
+		return nil, "", false
+	}
+	return best, strings.TrimPrefix(best.TagName, "v"), true
+}
+
+// isUpdateCandidate reports whether version may be offered as an update:
+// it must be newer than this build and not skipped, and either be the
+// pinned version or, when nothing is pinned, be published on a channel the
+// user follows. Releases marked as pre-releases count as beta at least.
+func isUpdateCandidate(version string, prerelease bool, config *AppConfig) bool {
+	if !isVersionNewer(version, Version) {
+		return false
+	}
+	parsed, _ := parseSemVer(version)
+
+	if config.SkippedVersion != "" {
+		if skipped, err := parseSemVer(config.SkippedVersion); err == nil && parsed.Compare(skipped) == 0 {
+			logActivity(fmt.Sprintf("Skipping version %s as requested", version))
+			return false
+		}
+	}
+	if config.PinnedVersion != "" {
+		pinned, err := parseSemVer(config.PinnedVersion)
+		return err == nil && parsed.Compare(pinned) == 0
+	}
+
+	channel := parsed.Channel()
+	if prerelease && channel == ChannelStable {
+		channel = ChannelBeta
+	}
+	return channelIncludes(config.UpdateChannel, channel)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRelease serves an update and its signed manifest the way a release does
+type testRelease struct {
+	binary    []byte
+	manifest  []byte
+	signature []byte
+	checksum  string
+	ranges    []string // Range headers of the binary's requests
+	key       ed25519.PrivateKey
+}
+
+func newTestRelease(t *testing.T, version string) (*testRelease, *UpdateInfo) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtIn := UpdateSigningKey
+	UpdateSigningKey = base64.StdEncoding.EncodeToString(public)
+	t.Cleanup(func() { UpdateSigningKey = builtIn })
+	// Keep the update cache out of the real one
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	release := &testRelease{binary: bytes.Repeat([]byte("attendance tracker update "), 20000), key: private}
+	sum := sha256.Sum256(release.binary)
+	release.checksum = hex.EncodeToString(sum[:]) + "  attendance-tracker\n"
+	release.manifest, _ = json.Marshal(UpdateManifest{
+		Version: version,
+		Files:   map[string]string{"attendance-tracker": hex.EncodeToString(sum[:])},
+	})
+	release.signature = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, release.manifest)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/attendance-tracker":
+			release.ranges = append(release.ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, "attendance-tracker", time.Time{}, bytes.NewReader(release.binary))
+		case "/attendance-tracker.sha256":
+			w.Write([]byte(release.checksum))
+		case "/manifest.json":
+			w.Write(release.manifest)
+		case "/manifest.json.sig":
+			w.Write(release.signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return release, &UpdateInfo{
+		Version:      version,
+		DownloadURL:  server.URL + "/attendance-tracker",
+		AssetName:    "attendance-tracker",
+		ChecksumURL:  server.URL + "/attendance-tracker.sha256",
+		ManifestURL:  server.URL + "/manifest.json",
+		SignatureURL: server.URL + "/manifest.json.sig",
+	}
+}
+
+func TestFetchVerifiedUpdateResumes(t *testing.T) {
+	release, info := newTestRelease(t, "9.0.0")
+
+	// A cancelled download left the first part behind
+	partPath := getUpdateCachePath(info) + ".part"
+	if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partPath, release.binary[:100000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var last DownloadProgress
+	path, err := fetchVerifiedUpdate(context.Background(), info, func(p DownloadProgress) { last = p })
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(data, release.binary) {
+		t.Fatalf("downloaded file differs from the release (%v)", err)
+	}
+	if len(release.ranges) != 1 || release.ranges[0] != "bytes=100000-" {
+		t.Errorf("range requests = %q, want one resuming at 100000", release.ranges)
+	}
+	if last.Downloaded != int64(len(release.binary)) || last.Total != int64(len(release.binary)) {
+		t.Errorf("last progress = %+v, want the whole file", last)
+	}
+
+	// A second fetch uses the verified copy in the cache
+	if _, err := fetchVerifiedUpdate(context.Background(), info, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(release.ranges) != 1 {
+		t.Errorf("cached update was downloaded again")
+	}
+}
+
+func TestFetchVerifiedUpdateRejectsTampering(t *testing.T) {
+	cases := map[string]func(release *testRelease){
+		"binary": func(release *testRelease) {
+			release.binary = append(release.binary, '!')
+		},
+		"checksum": func(release *testRelease) {
+			release.checksum = strings.Repeat("0", 64) + "  attendance-tracker\n"
+		},
+		"manifest": func(release *testRelease) {
+			release.manifest = bytes.Replace(release.manifest, []byte("9.0.0"), []byte("9.0.1"), 1)
+		},
+		"signature": func(release *testRelease) {
+			release.signature = []byte(base64.StdEncoding.EncodeToString(make([]byte, ed25519.SignatureSize)))
+		},
+	}
+
+	for name, tamper := range cases {
+		release, info := newTestRelease(t, "9.0.0")
+		tamper(release)
+
+		if _, err := fetchVerifiedUpdate(context.Background(), info, nil); err == nil {
+			t.Errorf("%s: tampered update was accepted", name)
+		}
+		if fileExists(getUpdateCachePath(info)) {
+			t.Errorf("%s: tampered update was cached", name)
+		}
+	}
+}
+
+func TestFetchExpectedChecksumReadsReleaseWorkflowFiles(t *testing.T) {
+	workflow, err := os.ReadFile(filepath.Join(".github", "workflows", "release.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := regexp.MustCompile(`(?m)^\s*EXE: (.+)$`).FindSubmatch(workflow)
+	if match == nil {
+		t.Fatal("release.yml does not name the executable in EXE")
+	}
+	exe := strings.TrimSpace(string(match[1]))
+
+	// GitHub lists the asset under its uploaded name, which must be one the
+	// app picks for Windows
+	asset := ReleaseAsset{Name: exe}
+	if !classifyAsset(&asset) || asset.OS != "windows" || asset.Arch != "amd64" || asset.Package != PackageBinary {
+		t.Errorf("%s classified as %+v, want a windows/amd64 executable", exe, asset)
+	}
+
+	// The workflow writes the checksum with sha256sum and the manifest with printf
+	release, info := newTestRelease(t, "9.0.0")
+	sum := sha256.Sum256(release.binary)
+	hexSum := hex.EncodeToString(sum[:])
+	release.checksum = hexSum + "  " + exe + "\n"
+	release.manifest = []byte(fmt.Sprintf(`{"version": "%s", "files": {"%s": "%s", "%s": "%s"}}`+"\n",
+		"9.0.0", exe, hexSum, "Attendance-Tracker-9.0.0-windows.zip", strings.Repeat("ab", 32)))
+	release.signature = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(release.key, release.manifest)))
+	info.AssetName = asset.Name
+
+	got, err := fetchExpectedChecksum(context.Background(), info)
+	if err != nil || got != hexSum {
+		t.Errorf("expected checksum = %s, %v, want %s", got, err, hexSum)
+	}
+}
+
+func TestDownloadUpdateCancel(t *testing.T) {
+	release, info := newTestRelease(t, "9.0.0")
+	partPath := filepath.Join(t.TempDir(), "update.part")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := downloadUpdate(ctx, info.DownloadURL, partPath, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("download error = %v, want context.Canceled", err)
+	}
+
+	// Resuming after a cancel completes the file
+	if err := downloadUpdate(context.Background(), info.DownloadURL, partPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sum, _ := hashFile(partPath); !strings.HasPrefix(release.checksum, sum) {
+		t.Errorf("resumed download has SHA-256 %s", sum)
+	}
+}
+
+func TestParseChecksumFile(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	other := strings.Repeat("cd", 32)
+	cases := []struct {
+		data string
+		want string
+	}{
+		{sum + "\n", sum},
+		{strings.ToUpper(sum) + "  Attendance Tracker.exe\n", sum},
+		{sum + " *Attendance Tracker.exe\n", sum},
+		{other + "  README.md\n" + sum + "  Attendance Tracker.exe\n", sum},
+		{other + "  README.md\n" + sum + "  attendance-tracker\n", ""},
+		{"not a checksum\n", ""},
+	}
+	for _, c := range cases {
+		got, err := parseChecksumFile([]byte(c.data), "Attendance Tracker.exe")
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%q: got %s, want an error", c.data, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("%q: got %s, %v, want %s", c.data, got, err, c.want)
+		}
+	}
+}